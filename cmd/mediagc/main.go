@@ -0,0 +1,131 @@
+/*
+Mediagc is the garbage collector of the media store: it removes the media files that the database doesn't reference
+anymore, and reports the photos whose file is missing. See the `service/mediagc` package for the rules.
+
+It uses the same database and media store configuration of `webapi`, so it can be run (e.g., periodically, by cron) on
+the same environment.
+
+Usage:
+
+	mediagc [flags]
+
+Flags:
+
+	--gc-min-age/$CFG_GC_MIN_AGE    orphan files newer than this are kept (default: 24h)
+	--gc-dry-run/$CFG_GC_DRY_RUN    only report the orphan files (default: false)
+
+Return values (exit codes):
+
+	0
+		The collection ended successfully
+
+	> 0
+		The collection ended due to an error
+*/
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"new-wasa/service/database"
+	"new-wasa/service/mediagc"
+	"new-wasa/service/mediastore"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/conf"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// Configuration of the garbage collector: the database and media store settings match the ones of webapi
+type configuration struct {
+	DB struct {
+		Filename string `conf:"default:/tmp/wasa.db"`
+	}
+	Media struct {
+		Backend string `conf:"default:local"`
+		Root    string `conf:"default:/tmp/media"`
+		S3      struct {
+			Endpoint  string `conf:"env:MEDIA_S3_ENDPOINT,flag:media-s3-endpoint"`
+			Region    string `conf:"default:us-east-1,env:MEDIA_S3_REGION,flag:media-s3-region"`
+			Bucket    string `conf:"env:MEDIA_S3_BUCKET,flag:media-s3-bucket"`
+			AccessKey string `conf:"env:MEDIA_S3_ACCESS_KEY,flag:media-s3-access-key"`
+			SecretKey string `conf:"mask,env:MEDIA_S3_SECRET_KEY,flag:media-s3-secret-key"`
+			PathStyle bool   `conf:"default:true,env:MEDIA_S3_PATH_STYLE,flag:media-s3-path-style"`
+		}
+	}
+	GC struct {
+		MinAge time.Duration `conf:"default:24h"`
+		DryRun bool          `conf:"default:false"`
+	}
+}
+
+func main() {
+	if err := run(); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var cfg configuration
+	if err := conf.Parse(os.Args[1:], "CFG", &cfg); err != nil {
+		if errors.Is(err, conf.ErrHelpWanted) {
+			usage, err := conf.Usage("CFG", &cfg)
+			if err != nil {
+				return fmt.Errorf("generating config usage: %w", err)
+			}
+			fmt.Println(usage) //nolint:forbidigo
+			return nil
+		}
+		return fmt.Errorf("parsing config: %w", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	// The foreign keys are enabled in the DSN, so that they hold on every connection of the pool
+	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename+"?_foreign_keys=on")
+	if err != nil {
+		return fmt.Errorf("opening SQLite: %w", err)
+	}
+	defer func() { _ = dbconn.Close() }()
+	db, err := database.New(dbconn)
+	if err != nil {
+		return fmt.Errorf("creating AppDatabase: %w", err)
+	}
+
+	store, err := mediastore.Open(cfg.Media.Backend, cfg.Media.Root, mediastore.S3Config{
+		Endpoint:  cfg.Media.S3.Endpoint,
+		Region:    cfg.Media.S3.Region,
+		Bucket:    cfg.Media.S3.Bucket,
+		AccessKey: cfg.Media.S3.AccessKey,
+		SecretKey: cfg.Media.S3.SecretKey,
+		PathStyle: cfg.Media.S3.PathStyle,
+	})
+	if err != nil {
+		return fmt.Errorf("opening the media store: %w", err)
+	}
+
+	report, err := mediagc.Run(context.Background(), db, store, mediagc.Config{
+		MinAge: cfg.GC.MinAge,
+		DryRun: cfg.GC.DryRun,
+		Logger: logger,
+	})
+	if err != nil {
+		return fmt.Errorf("collecting media: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"scanned":       report.Scanned,
+		"orphans":       report.Orphans,
+		"removed":       report.Removed,
+		"removed_bytes": report.RemovedBytes,
+		"missing":       report.Missing,
+		"dry_run":       cfg.GC.DryRun,
+	}).Info("media garbage collection completed")
+	return nil
+}
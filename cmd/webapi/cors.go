@@ -16,7 +16,7 @@ func applyCORSHandler(h http.Handler) http.Handler {
 			"Content-Type",
 			"Authorization",
 		}),
-		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT", "PATCH"}),
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.MaxAge(1),
 	)(h)
@@ -23,11 +23,63 @@ type WebAPIConfiguration struct {
 		ReadTimeout     time.Duration `conf:"default:5s"`
 		WriteTimeout    time.Duration `conf:"default:5s"`
 		ShutdownTimeout time.Duration `conf:"default:5s"`
+		// ExportTimeout replaces the read and write timeouts for the exports, which stream whole conversations
+		ExportTimeout time.Duration `conf:"default:5m"`
 	}
 	Debug bool
 	DB    struct {
 		Filename string `conf:"default:/tmp/wasa.db"`
 	}
+	Chat struct {
+		MultipleReactions bool `conf:"default:false"`
+	}
+	LinkPreview struct {
+		Enabled      bool          `conf:"default:true"`
+		Timeout      time.Duration `conf:"default:5s"`
+		MaxBodyBytes int64         `conf:"default:524288"`
+		CacheTTL     time.Duration `conf:"default:24h"`
+	}
+	Comments struct {
+		// MaxLength is the maximum length (in characters) of the comments
+		MaxLength int `conf:"default:500"`
+	}
+	Moderation struct {
+		// Moderators are the identifiers (separated by ";") of the users that triage the reports. Identifiers, unlike
+		// nicknames, can't be changed by the users
+		Moderators []string
+	}
+	Accounts struct {
+		// AnonymizeGroupMessages keeps the group messages of the deleted accounts (as sent by "Deleted user") instead
+		// of deleting them
+		AnonymizeGroupMessages bool `conf:"default:false"`
+	}
+	Media struct {
+		// Backend is "local" (files in Root) or "s3" (objects in an S3-compatible bucket)
+		Backend string `conf:"default:local"`
+		Root    string `conf:"default:/tmp/media"`
+		S3      struct {
+			Endpoint  string `conf:"env:MEDIA_S3_ENDPOINT,flag:media-s3-endpoint"`
+			Region    string `conf:"default:us-east-1,env:MEDIA_S3_REGION,flag:media-s3-region"`
+			Bucket    string `conf:"env:MEDIA_S3_BUCKET,flag:media-s3-bucket"`
+			AccessKey string `conf:"env:MEDIA_S3_ACCESS_KEY,flag:media-s3-access-key"`
+			SecretKey string `conf:"mask,env:MEDIA_S3_SECRET_KEY,flag:media-s3-secret-key"`
+			PathStyle bool   `conf:"default:true,env:MEDIA_S3_PATH_STYLE,flag:media-s3-path-style"`
+		}
+		// Limits of the uploads
+		MaxImageSize   int64         `conf:"default:20971520"`
+		MaxImagePixels int64         `conf:"default:40000000"`
+		MaxGIFSize     int64         `conf:"default:15728640"`
+		MaxVideoSize   int64         `conf:"default:52428800"`
+		MaxDuration    time.Duration `conf:"default:60s"`
+		MaxPostItems   int           `conf:"default:10"`
+		// UploadTimeout replaces the Web timeouts for the uploads: it bounds the time to receive, process (posters
+		// included) and answer an upload
+		UploadTimeout time.Duration `conf:"default:5m"`
+		// DownloadTimeout replaces the Web timeouts for the media files served (videos are large)
+		DownloadTimeout time.Duration `conf:"default:5m"`
+		// FFmpeg extracts the posters of videos. If empty or not found, videos get a placeholder poster
+		FFmpeg string `conf:"default:ffmpeg,env:MEDIA_FFMPEG,flag:media-ffmpeg"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
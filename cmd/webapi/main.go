@@ -33,6 +33,8 @@ import (
 	"new-wasa/service/api"
 	"new-wasa/service/database"
 	"new-wasa/service/globaltime"
+	"new-wasa/service/linkpreview"
+	"new-wasa/service/mediastore"
 	"os"
 	"os/signal"
 	"syscall"
@@ -83,7 +85,8 @@ func run() error {
 
 	// Start Database
 	logger.Println("initializing database support")
-	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename)
+	// The foreign keys are enabled in the DSN, so that they hold on every connection of the pool
+	dbconn, err := sql.Open("sqlite3", cfg.DB.Filename+"?_foreign_keys=on")
 	if err != nil {
 		logger.WithError(err).Error("error opening SQLite DB")
 		return fmt.Errorf("opening SQLite: %w", err)
@@ -98,6 +101,27 @@ func run() error {
 		return fmt.Errorf("creating AppDatabase: %w", err)
 	}
 
+	// The configuration decides who the moderators are
+	err = db.SetModerators(cfg.Moderation.Moderators)
+	if err != nil {
+		logger.WithError(err).Error("error setting the moderators")
+		return fmt.Errorf("setting the moderators: %w", err)
+	}
+
+	// Open the media store
+	media, err := mediastore.Open(cfg.Media.Backend, cfg.Media.Root, mediastore.S3Config{
+		Endpoint:  cfg.Media.S3.Endpoint,
+		Region:    cfg.Media.S3.Region,
+		Bucket:    cfg.Media.S3.Bucket,
+		AccessKey: cfg.Media.S3.AccessKey,
+		SecretKey: cfg.Media.S3.SecretKey,
+		PathStyle: cfg.Media.S3.PathStyle,
+	})
+	if err != nil {
+		logger.WithError(err).Error("error opening the media store")
+		return fmt.Errorf("opening the media store: %w", err)
+	}
+
 	// Start (main) API server
 	logger.Info("initializing API server")
 
@@ -110,10 +134,35 @@ func run() error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
+	// Link previews are fetched by the API server in background
+	var previews *linkpreview.Fetcher
+	if cfg.LinkPreview.Enabled {
+		previews = linkpreview.New(linkpreview.Config{
+			Timeout:      cfg.LinkPreview.Timeout,
+			MaxBodyBytes: cfg.LinkPreview.MaxBodyBytes,
+		})
+	}
+
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:                 logger,
+		Database:               db,
+		Media:                  media,
+		MultipleReactions:      cfg.Chat.MultipleReactions,
+		LinkPreviews:           previews,
+		LinkPreviewTTL:         cfg.LinkPreview.CacheTTL,
+		MaxImageSize:           cfg.Media.MaxImageSize,
+		MaxImagePixels:         cfg.Media.MaxImagePixels,
+		MaxGIFSize:             cfg.Media.MaxGIFSize,
+		MaxVideoSize:           cfg.Media.MaxVideoSize,
+		MaxMediaDuration:       cfg.Media.MaxDuration,
+		MaxPostItems:           cfg.Media.MaxPostItems,
+		UploadTimeout:          cfg.Media.UploadTimeout,
+		DownloadTimeout:        cfg.Media.DownloadTimeout,
+		ExportTimeout:          cfg.Web.ExportTimeout,
+		MaxCommentLength:       cfg.Comments.MaxLength,
+		FFmpeg:                 cfg.Media.FFmpeg,
+		AnonymizeGroupMessages: cfg.Accounts.AnonymizeGroupMessages,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -140,6 +189,8 @@ func run() error {
 		ReadTimeout:       cfg.Web.ReadTimeout,
 		ReadHeaderTimeout: cfg.Web.ReadTimeout,
 		WriteTimeout:      cfg.Web.WriteTimeout,
+		// The uploads extend the timeouts of their connection
+		ConnContext: api.ConnContext,
 	}
 
 	// Start the service listening for requests in a separate goroutine
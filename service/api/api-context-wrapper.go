@@ -1,11 +1,13 @@
 package api
 
 import (
+	"encoding/json"
 	"github.com/gofrs/uuid"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
 )
 
 // httpRouterHandler is the signature for functions that accepts a reqcontext.RequestContext in addition to those
@@ -31,6 +33,22 @@ func (rt *_router) wrap(fn httpRouterHandler) func(http.ResponseWriter, *http.Re
 			"remote-ip": r.RemoteAddr,
 		})
 
+		// Suspended users can't use the API, even with a token obtained before the suspension
+		if bearer := extractBearer(r.Header.Get("Authorization")); bearer != "" {
+			suspended, err := rt.db.IsSuspended(database.User{IdUser: bearer})
+			if err != nil {
+				ctx.Logger.WithError(err).Error("can't check if the user is suspended")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if suspended {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: ACCOUNT_SUSPENDED_ERROR_MSG})
+				return
+			}
+		}
+
 		// Call the next handler in chain (usually, the handler function for the path)
 		fn(w, r, ps, ctx)
 	}
@@ -16,28 +16,70 @@ func (rt *_router) Handler() http.Handler {
 	// User Endpoint
 	rt.router.PUT("/users/:id", rt.wrap(rt.putNickname))
 	rt.router.GET("/users/:id", rt.wrap(rt.getUserProfile))
+	rt.router.DELETE("/users/:id", rt.wrap(rt.deleteAccount))
+	rt.router.PATCH("/users/:id", rt.wrap(rt.patchProfile))
+	rt.router.GET("/users/:id/followers", rt.wrap(rt.getFollowersList))
+	rt.router.GET("/users/:id/following", rt.wrap(rt.getFollowingList))
+	rt.router.GET("/users/:id/photos", rt.wrap(rt.getUserPhotos))
+	rt.router.POST("/users/:id/export", rt.wrap(rt.requestDataExport))
+	rt.router.GET("/users/:id/export", rt.wrap(rt.getDataExport))
+	rt.router.GET("/users/:id/export/archive", rt.wrap(rt.downloadDataExport))
 	rt.router.PUT("/users/:id/photo", rt.wrap(rt.setMyPhoto))
 	rt.router.GET("/users/:id/photo", rt.wrap(rt.getUserPhoto))
 
 	// Ban endpoint
+	rt.router.GET("/users/:id/banned_users", rt.wrap(rt.getBannedUsers))
+	rt.router.POST("/users/:id/reports", rt.wrap(rt.reportUser))
 	rt.router.PUT("/users/:id/banned_users/:banned_id", rt.wrap(rt.putBan))
 	rt.router.DELETE("/users/:id/banned_users/:banned_id", rt.wrap(rt.deleteBan))
 
+	// Mute and restrict endpoints
+	rt.router.GET("/users/:id/muted_users", rt.wrap(rt.getMutedUsers))
+	rt.router.PUT("/users/:id/muted_users/:muted_id", rt.wrap(rt.putMute))
+	rt.router.DELETE("/users/:id/muted_users/:muted_id", rt.wrap(rt.deleteMute))
+	rt.router.GET("/users/:id/restricted_users", rt.wrap(rt.getRestrictedUsers))
+	rt.router.PUT("/users/:id/restricted_users/:restricted_id", rt.wrap(rt.putRestrict))
+	rt.router.DELETE("/users/:id/restricted_users/:restricted_id", rt.wrap(rt.deleteRestrict))
+
 	// Followers endpoint
 	rt.router.PUT("/users/:id/followers/:follower_id", rt.wrap(rt.putFollow))
 	rt.router.DELETE("/users/:id/followers/:follower_id", rt.wrap(rt.deleteFollow))
 
+	// Private accounts and follow requests endpoints
+	rt.router.PUT("/users/:id/privacy", rt.wrap(rt.putPrivacy))
+	rt.router.GET("/users/:id/follow_requests", rt.wrap(rt.getFollowRequests))
+	rt.router.PUT("/users/:id/follow_requests/:requester_id", rt.wrap(rt.approveFollowRequest))
+	rt.router.DELETE("/users/:id/follow_requests/:requester_id", rt.wrap(rt.deleteFollowRequest))
+
 	// Stream endpoint
 	rt.router.GET("/users/:id/home", rt.wrap(rt.getHome))
 
+	// Discovery endpoints
+	rt.router.GET("/users/:id/suggestions", rt.wrap(rt.getFollowSuggestions))
+	rt.router.GET("/photos/trending", rt.wrap(rt.getTrendingPhotos))
+
 	// Chat endpoints
 	rt.router.GET("/users/:id/chats", rt.wrap(rt.listChats))
 	rt.router.GET("/users/:id/chats/:peer/messages", rt.wrap(rt.listMessages))
+	rt.router.GET("/users/:id/chats/:peer/export", rt.wrap(rt.exportChat))
 	rt.router.POST("/users/:id/chats/:peer/messages", rt.wrap(rt.sendMessage))
 	rt.router.DELETE("/users/:id/chats/:peer/messages/:message_id", rt.wrap(rt.deleteMessage))
+	rt.router.GET("/users/:id/chats/:peer/messages/:message_id/comments", rt.wrap(rt.listMessageReactions))
 	rt.router.POST("/users/:id/chats/:peer/messages/:message_id/comments", rt.wrap(rt.commentMessage))
+	rt.router.POST("/users/:id/chats/:peer/messages/:message_id/reports", rt.wrap(rt.reportMessage))
 	rt.router.DELETE("/users/:id/chats/:peer/messages/:message_id/comments", rt.wrap(rt.uncommentMessage))
 	rt.router.POST("/users/:id/chats/:peer/messages/:message_id/forward", rt.wrap(rt.forwardMessage))
+	rt.router.PUT("/users/:id/chats/:peer/messages/:message_id/votes/:option", rt.wrap(rt.votePoll))
+	rt.router.DELETE("/users/:id/chats/:peer/messages/:message_id/votes/:option", rt.wrap(rt.unvotePoll))
+	rt.router.POST("/users/:id/chats/:peer/messages/:message_id/close", rt.wrap(rt.closePoll))
+	rt.router.GET("/users/:id/mentions", rt.wrap(rt.listMentions))
+
+	// Direct messages privacy and message requests endpoints
+	rt.router.GET("/users/:id/message_privacy", rt.wrap(rt.getMessagePrivacy))
+	rt.router.PUT("/users/:id/message_privacy", rt.wrap(rt.putMessagePrivacy))
+	rt.router.GET("/users/:id/message_requests", rt.wrap(rt.listMessageRequests))
+	rt.router.PUT("/users/:id/message_requests/:peer", rt.wrap(rt.acceptMessageRequest))
+	rt.router.DELETE("/users/:id/message_requests/:peer", rt.wrap(rt.deleteMessageRequest))
 
 	// Group endpoints
 	rt.router.POST("/users/:id/groups", rt.wrap(rt.createGroup))
@@ -46,20 +88,43 @@ func (rt *_router) Handler() http.Handler {
 	rt.router.PUT("/groups/:group_id", rt.wrap(rt.setGroupName))
 	rt.router.PUT("/groups/:group_id/photo", rt.wrap(rt.setGroupPhoto))
 	rt.router.GET("/groups/:group_id/photo", rt.wrap(rt.getGroupPhoto))
+	rt.router.PUT("/groups/:group_id/mute", rt.wrap(rt.muteGroup))
+	rt.router.DELETE("/groups/:group_id/mute", rt.wrap(rt.unmuteGroup))
 
 	// Photo Endpoint
 	rt.router.POST("/users/:id/photos", rt.wrap(rt.postPhoto))
 	rt.router.DELETE("/users/:id/photos/:photo_id", rt.wrap(rt.deletePhoto))
 	rt.router.GET("/users/:id/photos/:photo_id", rt.wrap(rt.getPhoto))
+	rt.router.PATCH("/users/:id/photos/:photo_id", rt.wrap(rt.patchPhoto))
+
+	// Tags and caption search endpoints
+	rt.router.GET("/tags/:tag/photos", rt.wrap(rt.getTagPhotos))
+	rt.router.GET("/photos", rt.wrap(rt.searchPhotos))
 
 	// Comments endpoint
+	rt.router.GET("/users/:id/photos/:photo_id/comments", rt.wrap(rt.getComments))
 	rt.router.POST("/users/:id/photos/:photo_id/comments", rt.wrap(rt.postComment))
+	rt.router.PATCH("/users/:id/photos/:photo_id/comments/:comment_id", rt.wrap(rt.patchComment))
+	rt.router.POST("/users/:id/photos/:photo_id/comments/:comment_id/approve", rt.wrap(rt.approveComment))
+	rt.router.POST("/users/:id/photos/:photo_id/comments/:comment_id/reports", rt.wrap(rt.reportComment))
+	rt.router.POST("/users/:id/photos/:photo_id/reports", rt.wrap(rt.reportPhoto))
 	rt.router.DELETE("/users/:id/photos/:photo_id/comments/:comment_id", rt.wrap(rt.deleteComment))
+	rt.router.PUT("/users/:id/photos/:photo_id/comments/:comment_id/likes/:like_id", rt.wrap(rt.putCommentLike))
+	rt.router.DELETE("/users/:id/photos/:photo_id/comments/:comment_id/likes/:like_id", rt.wrap(rt.deleteCommentLike))
 
 	// Likes endpoint
+	rt.router.GET("/users/:id/photos/:photo_id/likes", rt.wrap(rt.getLikes))
 	rt.router.PUT("/users/:id/photos/:photo_id/likes/:like_id", rt.wrap(rt.putLike))
 	rt.router.DELETE("/users/:id/photos/:photo_id/likes/:like_id", rt.wrap(rt.deleteLike))
 
+	// Moderation endpoints
+	rt.router.GET("/reports", rt.wrap(rt.listReports))
+	rt.router.GET("/reports/:report_id", rt.wrap(rt.getReport))
+	rt.router.POST("/reports/:report_id/resolve", rt.wrap(rt.resolveReport))
+	rt.router.PUT("/suspended_users/:user_id", rt.wrap(rt.suspendUser))
+	rt.router.DELETE("/suspended_users/:user_id", rt.wrap(rt.unsuspendUser))
+	rt.router.GET("/moderation_log", rt.wrap(rt.getModerationLog))
+
 	// Special routes
 	rt.router.GET("/liveness", rt.liveness)
 
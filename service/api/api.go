@@ -11,6 +11,7 @@ Example:
 	apirouter, err := api.New(api.Config{
 		Logger:   logger,
 		Database: appdb,
+		Media:    media,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
@@ -40,15 +41,15 @@ import (
 	"errors"
 	"net/http"
 	"new-wasa/service/database"
-	"path/filepath"
+	"new-wasa/service/linkpreview"
+	"new-wasa/service/mediastore"
+	"os/exec"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
 
-// Photo media folder
-var photoFolder = filepath.Join("/tmp", "media")
-
 // Config is used to provide dependencies and configuration to the New function.
 type Config struct {
 	// Logger where log entries are sent
@@ -56,6 +57,57 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// Media is where photos (with their renditions), profile photos and group photos are saved
+	Media mediastore.MediaStore
+
+	// MultipleReactions allows a user to leave more than one reaction on the same message
+	MultipleReactions bool
+
+	// LinkPreviews fetches the previews of links sent in messages. If nil, link previews are disabled
+	LinkPreviews *linkpreview.Fetcher
+
+	// LinkPreviewTTL is how long a fetched preview is cached before being fetched again
+	LinkPreviewTTL time.Duration
+
+	// MaxImageSize, MaxGIFSize and MaxVideoSize are the maximum sizes (in bytes) of the uploaded images (photos,
+	// profile and group photos), GIFs and videos. Larger uploads are rejected with 413
+	MaxImageSize int64
+	MaxGIFSize   int64
+	MaxVideoSize int64
+
+	// MaxImagePixels is the maximum number of pixels (width*height) of the uploaded images and GIFs, checked before
+	// decoding them
+	MaxImagePixels int64
+
+	// MaxMediaDuration is the maximum duration of the uploaded GIFs and videos
+	MaxMediaDuration time.Duration
+
+	// MaxPostItems is the maximum number of media items (images, GIFs and videos) of a post
+	MaxPostItems int
+
+	// UploadTimeout is the time allowed to the uploads to be received, processed and answered, in place of the
+	// timeouts of the server (which must use ConnContext)
+	UploadTimeout time.Duration
+
+	// DownloadTimeout is the time allowed to the media files to be served, in place of the timeouts of the server
+	// (which must use ConnContext)
+	DownloadTimeout time.Duration
+
+	// ExportTimeout is the time allowed to the exports to be streamed, in place of the timeouts of the server (which
+	// must use ConnContext)
+	ExportTimeout time.Duration
+
+	// MaxCommentLength is the maximum length (in characters) of the comments
+	MaxCommentLength int
+
+	// AnonymizeGroupMessages keeps the group messages of the deleted accounts, attributed to a "Deleted user"
+	// placeholder, instead of deleting them with the account
+	AnonymizeGroupMessages bool
+
+	// FFmpeg is the ffmpeg executable (a path, or a name looked up in PATH) used to extract the posters of videos. If
+	// empty or not found, videos get a placeholder poster
+	FFmpeg string
 }
 
 // Router is the package API interface representing an API handler builder
@@ -76,6 +128,9 @@ func New(cfg Config) (Router, error) {
 	if cfg.Database == nil {
 		return nil, errors.New("database is required")
 	}
+	if cfg.Media == nil {
+		return nil, errors.New("media store is required")
+	}
 
 	// Create a new router where we will register HTTP endpoints. The server will pass requests to this router to be
 	// handled.
@@ -83,10 +138,85 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
+	var previews *linkPreviewQueue
+	if cfg.LinkPreviews != nil {
+		ttl := cfg.LinkPreviewTTL
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		previews = newLinkPreviewQueue(cfg.LinkPreviews, cfg.Database, cfg.Logger, ttl)
+	}
+
+	limits := mediaLimits{
+		maxImageSize: cfg.MaxImageSize,
+		maxGIFSize:   cfg.MaxGIFSize,
+		maxVideoSize: cfg.MaxVideoSize,
+		maxPixels:    cfg.MaxImagePixels,
+		maxDuration:  cfg.MaxMediaDuration,
+		maxPostItems: cfg.MaxPostItems,
+		timeout:      cfg.UploadTimeout,
+	}
+	if limits.maxImageSize <= 0 {
+		limits.maxImageSize = defaultMaxImageSize
+	}
+	if limits.maxGIFSize <= 0 {
+		limits.maxGIFSize = defaultMaxGIFSize
+	}
+	if limits.maxVideoSize <= 0 {
+		limits.maxVideoSize = defaultMaxVideoSize
+	}
+	if limits.maxPixels <= 0 {
+		limits.maxPixels = defaultMaxImagePixels
+	}
+	if limits.maxDuration <= 0 {
+		limits.maxDuration = defaultMaxMediaDuration
+	}
+	if limits.maxPostItems <= 0 {
+		limits.maxPostItems = defaultMaxPostItems
+	}
+	if limits.timeout <= 0 {
+		limits.timeout = defaultUploadTimeout
+	}
+	if cfg.FFmpeg != "" {
+		ffmpeg, err := exec.LookPath(cfg.FFmpeg)
+		if err != nil {
+			cfg.Logger.WithError(err).Warning("ffmpeg not found, videos will have a placeholder poster")
+		}
+		limits.ffmpeg = ffmpeg
+	}
+
+	maxCommentLength := cfg.MaxCommentLength
+	if maxCommentLength <= 0 {
+		maxCommentLength = defaultMaxCommentLength
+	}
+	downloadTimeout := cfg.DownloadTimeout
+	if downloadTimeout <= 0 {
+		downloadTimeout = defaultDownloadTimeout
+	}
+	exportTimeout := cfg.ExportTimeout
+	if exportTimeout <= 0 {
+		exportTimeout = defaultExportTimeout
+	}
+
+	// The exports interrupted by the previous shutdown are generated again
+	dataExports := newDataExportQueue(cfg.Database, cfg.Media, cfg.Logger)
+	dataExports.resume()
+	mediaRemovals := newMediaRemovalQueue(cfg.Media, dataExports, cfg.Logger)
+
 	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
+		router:            router,
+		baseLogger:        cfg.Logger,
+		db:                cfg.Database,
+		media:             cfg.Media,
+		multipleReactions: cfg.MultipleReactions,
+		linkPreviews:      previews,
+		mediaLimits:       limits,
+		maxCommentLength:  maxCommentLength,
+		downloadTimeout:   downloadTimeout,
+		exportTimeout:     exportTimeout,
+		anonymizeMessages: cfg.AnonymizeGroupMessages,
+		dataExports:       dataExports,
+		mediaRemovals:     mediaRemovals,
 	}, nil
 }
 
@@ -98,4 +228,33 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	media mediastore.MediaStore
+
+	// multipleReactions is true when users can leave more than one reaction per message
+	multipleReactions bool
+
+	// linkPreviews fetches link previews in background. It's nil if link previews are disabled
+	linkPreviews *linkPreviewQueue
+
+	// mediaLimits are the limits of the uploads
+	mediaLimits mediaLimits
+
+	// maxCommentLength is the maximum length (in characters) of the comments
+	maxCommentLength int
+
+	// downloadTimeout is the time allowed to a media file to be served
+	downloadTimeout time.Duration
+
+	// exportTimeout is the time allowed to an export to be streamed
+	exportTimeout time.Duration
+
+	// anonymizeMessages keeps the group messages of the deleted accounts
+	anonymizeMessages bool
+
+	// dataExports generates the archives of the data exports in background
+	dataExports *dataExportQueue
+
+	// mediaRemovals removes the media folders of the deleted accounts in background
+	mediaRemovals *mediaRemovalQueue
 }
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that approves a comment of a restricted user on a photo of the user, making it visible to everyone
+func (rt *_router) approveComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+
+	// Only the owner of the photo can approve its comments
+	valid := validateRequestingUser(ps.ByName("id"), requestingUserId)
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	photoId, ok := rt.commentedPhoto(w, ps, requestingUserId, ctx, "approve-comment")
+	if !ok {
+		return
+	}
+
+	commentId, err := strconv.ParseInt(ps.ByName("comment_id"), 10, 64)
+	if err != nil || commentId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.ApproveComment(PhotoId{IdPhoto: photoId}.ToDatabase(), CommentId{IdComment: commentId}.ToDatabase())
+	if errors.Is(err, database.ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("approve-comment/db.ApproveComment: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
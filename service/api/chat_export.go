@@ -0,0 +1,426 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Number of messages loaded from the database at once while exporting a conversation
+const exportBatchSize = 500
+
+// Default time allowed to an export to be streamed (see Config.ExportTimeout)
+const defaultExportTimeout = 5 * time.Minute
+
+// exportConversation is the conversation described at the beginning of an export
+type exportConversation struct {
+	Peer       string    `json:"peer"`
+	Name       string    `json:"name"`
+	IsGroup    bool      `json:"is_group"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// exportParticipant is a user that appears in an export. Photo is the path of the profile photo inside the zip
+// archive (zip exports only)
+type exportParticipant struct {
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Photo    string `json:"photo,omitempty"`
+}
+
+// exportEncoder writes an export in a specific format, one message at a time
+type exportEncoder interface {
+	begin(conversation exportConversation) error
+	message(m database.ExportedMessage) error
+	end(participants []exportParticipant) error
+}
+
+// jsonExportEncoder writes a JSON object with the conversation, the messages and the participants
+type jsonExportEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExportEncoder) begin(conversation exportConversation) error {
+	header, err := json.Marshal(conversation)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "{\"conversation\":%s,\"messages\":[", header)
+	return err
+}
+
+func (e *jsonExportEncoder) message(m database.ExportedMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonExportEncoder) end(participants []exportParticipant) error {
+	data, err := json.Marshal(participants)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "],\"participants\":%s}\n", data)
+	return err
+}
+
+// textExportEncoder writes a human readable transcript
+type textExportEncoder struct {
+	w io.Writer
+}
+
+func (e *textExportEncoder) begin(conversation exportConversation) error {
+	_, err := fmt.Fprintf(e.w, "Conversation: %s (%s)\nExported at: %s\n\n",
+		conversation.Name, conversation.Peer, conversation.ExportedAt.Format(time.RFC3339))
+	return err
+}
+
+func (e *textExportEncoder) message(m database.ExportedMessage) error {
+	body := m.Body
+	switch {
+	case m.Deleted:
+		body = "<message deleted>"
+	case m.Type == database.GroupMessagePoll:
+		body = "<poll> " + body
+	case m.Type == database.GroupMessagePollClosed:
+		body = "<" + body + ">"
+	}
+	// Multiline bodies are indented so that every message starts on its own line
+	body = strings.ReplaceAll(body, "\n", "\n    ")
+	if _, err := fmt.Fprintf(e.w, "[%s] %s: %s\n", m.Date.UTC().Format("2006-01-02 15:04:05"), m.SenderNickname, body); err != nil {
+		return err
+	}
+
+	if m.Poll != nil {
+		for _, option := range m.Poll.Options {
+			if _, err := fmt.Fprintf(e.w, "    - %s (%d)\n", option.Text, option.Votes); err != nil {
+				return err
+			}
+		}
+	}
+	if len(m.Reactions) > 0 {
+		reactions := make([]string, 0, len(m.Reactions))
+		for _, r := range m.Reactions {
+			reactions = append(reactions, r.Reaction+" "+r.Nickname)
+		}
+		if _, err := fmt.Fprintf(e.w, "    reactions: %s\n", strings.Join(reactions, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *textExportEncoder) end(participants []exportParticipant) error {
+	if _, err := io.WriteString(e.w, "\nParticipants:\n"); err != nil {
+		return err
+	}
+	for _, p := range participants {
+		line := fmt.Sprintf("- %s (%s)", p.Nickname, p.UserID)
+		if p.Photo != "" {
+			line += " photo: " + p.Photo
+		}
+		if _, err := io.WriteString(e.w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportChat streams the whole history of a conversation as JSON (default) or plain text (?format=txt). With
+// ?zip=true the export is packaged in a zip archive together with the profile photos of the participants (and the
+// photo of the group)
+func (rt *_router) exportChat(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "txt" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	asZip := r.URL.Query().Get("zip") == "true"
+
+	peer := ps.ByName("peer")
+	conversation := exportConversation{Peer: peer, ExportedAt: time.Now().UTC()}
+	var group database.Group
+	if groupID, ok := parseGroupPeer(peer); ok {
+		inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: db.IsUserInGroup error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !inGroup {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		group, err = rt.db.GetGroup(groupID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: db.GetGroup error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		conversation.Name = group.Name
+		conversation.IsGroup = true
+	} else {
+		if strings.HasPrefix(peer, "g-") || !validIdentifier(peer) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if rt.bannedPeer(w, ctx, requester, peer, "exportChat") {
+			return
+		}
+		exists, err := rt.db.CheckUser(database.User{IdUser: peer})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: db.CheckUser error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		conversation.Name, err = rt.db.GetNickname(database.User{IdUser: peer})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: db.GetNickname error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// From now on the response is streamed: errors can only be logged (the client gets a truncated export). Long
+	// conversations take longer than the write timeout of the server
+	extendDeadlines(r, rt.exportTimeout)
+	filename := "chat-" + peer + "." + format
+	var out io.Writer = w
+	var archive *zip.Writer
+	if asZip {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="chat-`+peer+`.zip"`)
+		archive = zip.NewWriter(w)
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: filename, Method: zip.Deflate, Modified: conversation.ExportedAt})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: error creating zip entry")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		out = entry
+	} else {
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+
+	var enc exportEncoder = &jsonExportEncoder{w: out}
+	if format == "txt" {
+		enc = &textExportEncoder{w: out}
+	}
+
+	participants, err := rt.streamExport(w, enc, conversation, group, requester)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("exportChat: error streaming messages")
+		return
+	}
+
+	var media []exportMedia
+	if archive != nil {
+		media, err = rt.listExportMedia(r.Context(), participants, group)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: error listing media")
+			return
+		}
+	}
+	if err := enc.end(participants); err != nil {
+		ctx.Logger.WithError(err).Error("exportChat: error writing participants")
+		return
+	}
+
+	if archive != nil {
+		// The export entry is complete: media files can be added after it
+		for _, m := range media {
+			if err := rt.copyToArchive(r.Context(), archive, m.name, m.key); err != nil {
+				ctx.Logger.WithError(err).Error("exportChat: error adding media")
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			ctx.Logger.WithError(err).Error("exportChat: error closing zip")
+		}
+	}
+}
+
+// Writes the messages of the conversation in batches, flushing the response after each one. Returns the
+// participants of the conversation (senders of the messages, the requester and the direct peer)
+func (rt *_router) streamExport(w http.ResponseWriter, enc exportEncoder, conversation exportConversation, group database.Group, requester string) ([]exportParticipant, error) {
+	if err := enc.begin(conversation); err != nil {
+		return nil, err
+	}
+
+	var participants []exportParticipant
+	seen := make(map[string]bool)
+	addParticipant := func(id string, nickname string) {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, exportParticipant{UserID: id, Nickname: nickname})
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var afterID int64
+	for {
+		var batch []database.ExportedMessage
+		var err error
+		if conversation.IsGroup {
+			batch, err = rt.db.ExportGroupMessages(group.Id, afterID, exportBatchSize)
+			if err == nil {
+				err = rt.attachExportedPolls(batch, group.Id, requester)
+			}
+		} else {
+			batch, err = rt.db.ExportDirectMessages(database.User{IdUser: requester}, database.User{IdUser: conversation.Peer}, afterID, exportBatchSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range batch {
+			addParticipant(m.Sender, m.SenderNickname)
+			if err := enc.message(m); err != nil {
+				return nil, err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if len(batch) < exportBatchSize {
+			break
+		}
+		afterID = batch[len(batch)-1].Id
+	}
+
+	for _, id := range []string{requester, conversation.Peer} {
+		if conversation.IsGroup && id == conversation.Peer {
+			continue
+		}
+		if !seen[id] {
+			nickname, err := rt.db.GetNickname(database.User{IdUser: id})
+			if err != nil {
+				return nil, err
+			}
+			addParticipant(id, nickname)
+		}
+	}
+	return participants, nil
+}
+
+// Sets the polls (with their final or current tally) of the exported group messages
+func (rt *_router) attachExportedPolls(batch []database.ExportedMessage, groupID int64, requester string) error {
+	ids := make([]int64, 0, len(batch))
+	for _, m := range batch {
+		if !m.Deleted && m.Type != database.GroupMessageText {
+			ids = append(ids, m.Id)
+		}
+	}
+	polls, err := rt.db.ListGroupPolls(groupID, ids, database.User{IdUser: requester})
+	if err != nil {
+		return err
+	}
+	for i := range batch {
+		if poll, ok := polls[batch[i].Id]; ok {
+			batch[i].Poll = &poll
+		}
+	}
+	return nil
+}
+
+// exportMedia is a file to copy in the media folder of a zip export
+type exportMedia struct {
+	name string // Path inside the archive
+	key  string // Key in the media store
+}
+
+// Returns the profile photos of the participants and the group photo to include in a zip export, and sets the photo
+// paths of the participants
+func (rt *_router) listExportMedia(ctx context.Context, participants []exportParticipant, group database.Group) ([]exportMedia, error) {
+	var media []exportMedia
+	for i := range participants {
+		photoPath, err := rt.db.GetUserPhotoPath(database.User{IdUser: participants[i].UserID})
+		if errors.Is(err, database.ErrUserPhotoNotFound) || (err == nil && strings.TrimSpace(photoPath) == "") {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		m := exportMedia{
+			name: "media/users/" + participants[i].UserID + filepath.Ext(photoPath),
+			key:  photoPath,
+		}
+		if exists, err := rt.mediaExists(ctx, m.key); err != nil {
+			return nil, err
+		} else if !exists {
+			continue
+		}
+		participants[i].Photo = m.name
+		media = append(media, m)
+	}
+
+	if strings.TrimSpace(group.PhotoPath) != "" {
+		m := exportMedia{
+			name: "media/group" + filepath.Ext(group.PhotoPath),
+			key:  group.PhotoPath,
+		}
+		if exists, err := rt.mediaExists(ctx, m.key); err != nil {
+			return nil, err
+		} else if exists {
+			media = append(media, m)
+		}
+	}
+	return media, nil
+}
+
+// Copies a media file in the archive. Files removed in the meantime are skipped
+func (rt *_router) copyToArchive(ctx context.Context, archive *zip.Writer, name string, key string) error {
+	obj, err := rt.media.Open(ctx, key)
+	if errors.Is(err, mediastore.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = obj.Close() }()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: obj.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, obj)
+	return err
+}
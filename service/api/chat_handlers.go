@@ -2,11 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -59,6 +61,13 @@ func (rt *_router) listMessages(w http.ResponseWriter, r *http.Request, ps httpr
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+		// Polls whose close time passed are closed now, so that their events are part of the list
+		if err := rt.db.CloseExpiredGroupPolls(groupID); err != nil {
+			ctx.Logger.WithError(err).Error("listMessages: db.CloseExpiredGroupPolls error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		// Mark as read all group messages for this user.
 		_ = rt.db.MarkGroupConversationRead(groupID, database.User{IdUser: requester})
 
@@ -67,16 +76,41 @@ func (rt *_router) listMessages(w http.ResponseWriter, r *http.Request, ps httpr
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		ids := make([]int64, 0, len(gmsgs))
+		for _, gm := range gmsgs {
+			ids = append(ids, gm.Id)
+		}
+		reactions, err := rt.db.SummarizeGroupMessageReactions(groupID, ids, database.User{IdUser: requester})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("listMessages: db.SummarizeGroupMessageReactions error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mentions, err := rt.db.ListGroupMessageMentions(groupID, ids)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("listMessages: db.ListGroupMessageMentions error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		polls, err := rt.db.ListGroupPolls(groupID, ids, database.User{IdUser: requester})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("listMessages: db.ListGroupPolls error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		for _, gm := range gmsgs {
 			msg := database.Message{
-				Id:       gm.Id,
-				Sender:   gm.Sender,
-				Receiver: peer,
-				Body:     gm.Body,
-				Date:     gm.Date,
+				Id:        gm.Id,
+				Sender:    gm.Sender,
+				Receiver:  peer,
+				Body:      gm.Body,
+				Date:      gm.Date,
+				Reactions: reactions[gm.Id],
+				Mentions:  mentions[gm.Id],
+				Type:      gm.Type,
 			}
-			if reactions, err := rt.db.ListGroupMessageReactions(groupID, msg.Id); err == nil {
-				msg.Reactions = reactions
+			if poll, ok := polls[gm.Id]; ok {
+				msg.Poll = &poll
 			}
 			if msg.Sender == requester {
 				if status, err := rt.db.GetGroupMessageCheckmarks(groupID, msg.Id); err == nil {
@@ -86,6 +120,9 @@ func (rt *_router) listMessages(w http.ResponseWriter, r *http.Request, ps httpr
 			msgs = append(msgs, msg)
 		}
 	} else {
+		if rt.bannedPeer(w, ctx, requester, peer, "listMessages") {
+			return
+		}
 		// Mark as read all messages sent by peer to requester.
 		_ = rt.db.MarkDirectConversationRead(database.User{IdUser: requester}, database.User{IdUser: peer})
 
@@ -94,10 +131,18 @@ func (rt *_router) listMessages(w http.ResponseWriter, r *http.Request, ps httpr
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		ids := make([]int64, 0, len(directMsgs))
+		for _, m := range directMsgs {
+			ids = append(ids, m.Id)
+		}
+		reactions, err := rt.db.SummarizeDirectMessageReactions(ids, database.User{IdUser: requester})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("listMessages: db.SummarizeDirectMessageReactions error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		for i := range directMsgs {
-			if reactions, err := rt.db.ListDirectMessageReactions(directMsgs[i].Id); err == nil {
-				directMsgs[i].Reactions = reactions
-			}
+			directMsgs[i].Reactions = reactions[directMsgs[i].Id]
 			if directMsgs[i].Sender == requester {
 				if status, err := rt.db.GetDirectMessageCheckmarks(directMsgs[i].Id); err == nil {
 					directMsgs[i].Status = status
@@ -107,6 +152,12 @@ func (rt *_router) listMessages(w http.ResponseWriter, r *http.Request, ps httpr
 		msgs = directMsgs
 	}
 
+	if err := rt.attachLinkPreviews(msgs); err != nil {
+		ctx.Logger.WithError(err).Error("listMessages: db.GetLinkPreviews error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	// Wrap in an object to avoid top-level array responses (OpenAPI lint requirement).
 	type messagesResponse struct {
 		Messages []database.Message `json:"messages"`
@@ -127,13 +178,19 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 	peer := ps.ByName("peer")
 	var body struct {
-		Body string `json:"body"`
+		Body string       `json:"body"`
+		Poll *pollRequest `json:"poll"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Body) == 0 {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (len(body.Body) == 0 && body.Poll == nil) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	peerIsGroup := strings.HasPrefix(peer, "g-")
+	if body.Poll != nil && !peerIsGroup {
+		// Polls are available in group conversations only
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 	if peerIsGroup {
 		groupID, err := strconv.ParseInt(strings.TrimPrefix(peer, "g-"), 10, 64)
 		if err != nil || groupID <= 0 {
@@ -149,28 +206,126 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, ps httpro
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
-		_, err = rt.db.CreateGroupMessage(groupID, database.User{IdUser: requester}, body.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		if body.Poll != nil {
+			poll, errMsg := body.Poll.toDatabase(time.Now())
+			if errMsg != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: errMsg})
+				return
+			}
+			if _, err := rt.db.CreateGroupPoll(groupID, database.User{IdUser: requester}, poll); err != nil {
+				ctx.Logger.WithError(err).Error("sendMessage: db.CreateGroupPoll error")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-	} else {
-		// basic ban check: if requester is banned by peer, disallow
-		banned, err := rt.db.BannedUserCheck(database.User{IdUser: requester}, database.User{IdUser: peer})
+		_, err = rt.db.CreateGroupMessage(groupID, database.User{IdUser: requester}, body.Body)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if banned {
-			w.WriteHeader(http.StatusForbidden)
+	} else {
+		request, ok := rt.sendDirectMessage(w, ctx, requester, peer, body.Body, "sendMessage")
+		if !ok {
 			return
 		}
-		_, err = rt.db.CreateMessage(database.User{IdUser: requester}, database.User{IdUser: peer}, body.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		if request {
+			rt.requestLinkPreview(body.Body)
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(MessageStatus{Status: database.DirectMessageRequest})
 			return
 		}
 	}
+	rt.requestLinkPreview(body.Body)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// sendDirectMessage sends a direct message from requester to peer if peer exists, didn't ban requester and accepts
+// messages from requester; the first messages of a stranger become a message request. It replies with the error and
+// returns ok=false otherwise
+func (rt *_router) sendDirectMessage(w http.ResponseWriter, ctx reqcontext.RequestContext, requester string, peer string, body string, where string) (request bool, ok bool) {
+	from := database.User{IdUser: requester}
+	to := database.User{IdUser: peer}
+
+	if rt.bannedPeer(w, ctx, requester, peer, where) {
+		return false, false
+	}
+
+	policy, err := rt.db.CheckDirectMessage(from, to)
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return false, false
+	} else if errors.Is(err, database.ErrMessagesNotAllowed) {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: MESSAGES_NOT_ALLOWED_ERROR_MSG})
+		return false, false
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.CheckDirectMessage error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false, false
+	}
+
+	request = policy == database.DirectMessageRequest
+	if request {
+		_, err = rt.db.CreateMessageRequest(from, to, body)
+	} else {
+		_, err = rt.db.CreateMessage(from, to, body)
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.CreateMessage error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false, false
+	}
+	return request, true
+}
+
+// bannedPeer replies 403 and returns true if requester or the direct peer banned the other: a ban freezes their
+// conversation in both directions
+func (rt *_router) bannedPeer(w http.ResponseWriter, ctx reqcontext.RequestContext, requester string, peer string, where string) bool {
+	banned, err := rt.db.BanBetween(database.User{IdUser: requester}, database.User{IdUser: peer})
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.BanBetween error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+	if banned {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: BANNED_USER_ERROR_MSG})
+		return true
+	}
+	return false
+}
+
+// listMentions returns the group messages in which the requester was mentioned (only unread ones with ?unread=true)
+func (rt *_router) listMentions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	mentions, err := rt.db.ListUserMentions(database.User{IdUser: requester}, unreadOnly, 100)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("listMentions: db.ListUserMentions error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if mentions == nil {
+		mentions = []database.MentionNotification{}
+	}
+
+	// Wrap in an object to avoid top-level array responses (OpenAPI lint requirement).
+	type mentionsResponse struct {
+		Mentions []database.MentionNotification `json:"mentions"`
+	}
+	if err := json.NewEncoder(w).Encode(mentionsResponse{Mentions: mentions}); err != nil {
+		ctx.Logger.WithError(err).Error("listMentions: failed to encode mentions json")
+	}
+}
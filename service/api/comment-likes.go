@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that adds a like of a user to a comment of a photo
+func (rt *_router) putCommentLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.setCommentLike(w, r, ps, ctx, true)
+}
+
+// Function that removes a like of a user from a comment of a photo
+func (rt *_router) deleteCommentLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.setCommentLike(w, r, ps, ctx, false)
+}
+
+// Function that adds or removes the like of the requesting user (the like_id in the path) to a comment
+func (rt *_router) setCommentLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext, like bool) {
+
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+
+	photoId, ok := rt.commentedPhoto(w, ps, requestingUserId, ctx, "comment-like")
+	if !ok {
+		return
+	}
+
+	// Like id is not consistent with requesting user bearer token
+	if ps.ByName("like_id") != requestingUserId {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	commentId, err := strconv.ParseInt(ps.ByName("comment_id"), 10, 64)
+	if err != nil || commentId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	photo := PhotoId{IdPhoto: photoId}.ToDatabase()
+	comment := CommentId{IdComment: commentId}.ToDatabase()
+	user := User{IdUser: requestingUserId}.ToDatabase()
+	if like {
+		err = rt.db.LikeComment(photo, comment, user)
+	} else {
+		err = rt.db.UnlikeComment(photo, comment, user)
+	}
+	if errors.Is(err, database.ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("comment-like: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
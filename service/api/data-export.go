@@ -0,0 +1,505 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of data exports that can wait to be generated. When the queue is full new requests are rejected
+const dataExportQueueSize = 32
+
+// Description of the files of a data export archive
+const dataExportReadme = `Export of your WASAPhoto data
+
+profile.json         your profile (display name, bio, website), settings, nickname history, followers, following, bans, mutes and restrictions
+photos.json          your photos with their media items, likes and comments
+activity.json        the comments and likes you left on photos and your reactions to messages
+messages/direct.json the direct messages you sent
+messages/groups.json the group messages you sent
+receipts/direct.json the delivery and read receipts of the direct messages you received
+receipts/groups.json the delivery and read receipts of the group messages you received
+media/profile.<ext>  your profile photo
+media/photos/        the media items of your photos, named <photo id>_<position>.<ext>
+`
+
+// dataExportQueue generates the archives of the data exports in a background goroutine, one at a time. The state of
+// the exports is kept in the database: the exports interrupted by a shutdown are resumed by the next start
+type dataExportQueue struct {
+	db     database.AppDatabase
+	media  mediastore.MediaStore
+	logger logrus.FieldLogger
+
+	queue     chan string
+	mu        sync.Mutex
+	pending   map[string]bool
+	cancelled map[string]bool
+
+	// The export in progress: its user, the function that aborts it and a channel closed when it stops
+	current       string
+	currentCancel context.CancelFunc
+	currentDone   chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDataExportQueue(db database.AppDatabase, media mediastore.MediaStore, logger logrus.FieldLogger) *dataExportQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &dataExportQueue{
+		db:        db,
+		media:     media,
+		logger:    logger,
+		queue:     make(chan string, dataExportQueueSize),
+		pending:   make(map[string]bool),
+		cancelled: make(map[string]bool),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// resume enqueues the exports left pending by the previous run
+func (q *dataExportQueue) resume() {
+	users, err := q.db.ListPendingDataExports()
+	if err != nil {
+		q.logger.WithError(err).Error("data export: db.ListPendingDataExports error")
+		return
+	}
+	for _, u := range users {
+		if !q.enqueue(u.IdUser) {
+			q.fail(u.IdUser)
+		}
+	}
+}
+
+// enqueue schedules the generation of the export of a user. It returns false if the queue is full
+func (q *dataExportQueue) enqueue(userID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[userID] {
+		return true
+	}
+	select {
+	case q.queue <- userID:
+		q.pending[userID] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *dataExportQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case userID := <-q.queue:
+			q.mu.Lock()
+			if q.cancelled[userID] {
+				delete(q.cancelled, userID)
+				delete(q.pending, userID)
+				q.mu.Unlock()
+				continue
+			}
+			ctx, cancel := context.WithCancel(q.ctx)
+			q.current, q.currentCancel, q.currentDone = userID, cancel, make(chan struct{})
+			q.mu.Unlock()
+
+			q.generate(ctx, userID)
+			cancel()
+
+			q.mu.Lock()
+			close(q.currentDone)
+			q.current, q.currentCancel, q.currentDone = "", nil, nil
+			delete(q.pending, userID)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// close stops the background goroutine. The export in progress stays pending
+func (q *dataExportQueue) close() {
+	q.cancel()
+	<-q.done
+}
+
+// abort drops the export of a user: a queued export is skipped, the one in progress is stopped. When abort returns
+// the export can't write in the media store anymore
+func (q *dataExportQueue) abort(userID string) {
+	q.mu.Lock()
+	if q.current == userID {
+		q.currentCancel()
+		done := q.currentDone
+		q.mu.Unlock()
+		<-done
+		return
+	}
+	if q.pending[userID] {
+		q.cancelled[userID] = true
+	}
+	q.mu.Unlock()
+}
+
+// fail marks the pending export of a user as failed
+func (q *dataExportQueue) fail(userID string) {
+	if err := q.db.FinishDataExport(database.User{IdUser: userID}, "", 0); err != nil {
+		q.logger.WithError(err).Error("data export: db.FinishDataExport error")
+	}
+}
+
+// generate writes the archive of the export of a user in a temporary file and saves it in the media store. It stops
+// when ctx is canceled (shutdown or deletion of the user)
+func (q *dataExportQueue) generate(ctx context.Context, userID string) {
+	logger := q.logger.WithField("user", userID)
+
+	tmp, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		logger.WithError(err).Error("data export: error creating the temporary file")
+		q.fail(userID)
+		return
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	archive := zip.NewWriter(tmp)
+	err = q.writeArchive(ctx, archive, database.User{IdUser: userID})
+	if err == nil {
+		err = archive.Close()
+	}
+	if errors.Is(err, context.Canceled) {
+		// Shutdown (the export is resumed by the next start) or deletion of the user
+		return
+	} else if err != nil {
+		logger.WithError(err).Error("data export: error writing the archive")
+		q.fail(userID)
+		return
+	}
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	var key string
+	if err == nil {
+		key, err = newMediaVersionKey(path.Join(userID, "exports"), "takeout", "zip")
+	}
+	if err == nil {
+		err = q.media.Put(ctx, key, tmp, size)
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	} else if err != nil {
+		logger.WithError(err).Error("data export: error saving the archive")
+		q.fail(userID)
+		return
+	}
+
+	if err := q.db.FinishDataExport(database.User{IdUser: userID}, key, size); err != nil {
+		logger.WithError(err).Error("data export: db.FinishDataExport error")
+		return
+	}
+	logger.Infof("data export: archive of %d bytes ready", size)
+}
+
+// writeArchive writes the files of the export of a user in the archive
+func (q *dataExportQueue) writeArchive(ctx context.Context, archive *zip.Writer, u database.User) error {
+	now := time.Now().UTC()
+	create := func(name string) (io.Writer, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+
+	w, err := create("README.txt")
+	if err == nil {
+		_, err = io.WriteString(w, dataExportReadme)
+	}
+	if err != nil {
+		return err
+	}
+
+	profile, err := q.db.ExportUserProfile(u)
+	if err != nil {
+		return err
+	}
+	w, err = create("profile.json")
+	if err == nil {
+		err = json.NewEncoder(w).Encode(profile)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The media items are copied after photos.json: a zip archive is written one file at a time
+	var media []exportMedia
+	w, err = create("photos.json")
+	if err != nil {
+		return err
+	}
+	err = q.writeJSONArray(ctx, w, func(after int64) ([]interface{}, int64, error) {
+		photos, err := q.db.ExportUserPhotos(u, after, exportBatchSize)
+		items := make([]interface{}, 0, len(photos))
+		for _, p := range photos {
+			items = append(items, p)
+			photoId := strconv.Itoa(p.PhotoId)
+			for _, item := range p.Media {
+				media = append(media, exportMedia{
+					name: "media/photos/" + photoId + "_" + strconv.Itoa(item.Position),
+					key:  userPhotoKey(u.IdUser, photoItemName(photoId, item.Position)),
+				})
+			}
+			after = int64(p.PhotoId)
+		}
+		return items, after, err
+	})
+	if err != nil {
+		return err
+	}
+
+	activity, err := q.db.ExportUserActivity(u)
+	if err != nil {
+		return err
+	}
+	w, err = create("activity.json")
+	if err == nil {
+		err = json.NewEncoder(w).Encode(activity)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, group := range []bool{false, true} {
+		kind := "direct"
+		if group {
+			kind = "groups"
+		}
+
+		w, err = create("messages/" + kind + ".json")
+		if err != nil {
+			return err
+		}
+		err = q.writeJSONArray(ctx, w, func(after int64) ([]interface{}, int64, error) {
+			msgs, err := q.db.ExportSentMessages(u, group, after, exportBatchSize)
+			items := make([]interface{}, 0, len(msgs))
+			for _, m := range msgs {
+				items = append(items, m)
+				after = m.Id
+			}
+			return items, after, err
+		})
+		if err != nil {
+			return err
+		}
+
+		w, err = create("receipts/" + kind + ".json")
+		if err != nil {
+			return err
+		}
+		err = q.writeJSONArray(ctx, w, func(after int64) ([]interface{}, int64, error) {
+			receipts, err := q.db.ExportReceipts(u, group, after, exportBatchSize)
+			items := make([]interface{}, 0, len(receipts))
+			for _, r := range receipts {
+				items = append(items, r)
+				after = r.MessageId
+			}
+			return items, after, err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if profile.PhotoPath != "" {
+		media = append(media, exportMedia{name: "media/profile", key: profile.PhotoPath})
+	}
+	for _, m := range media {
+		if err := q.copyMedia(ctx, create, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSONArray writes a JSON array whose items are loaded in batches by next, which returns the items after a cursor
+// and the cursor of the last one
+func (q *dataExportQueue) writeJSONArray(ctx context.Context, w io.Writer, next func(after int64) ([]interface{}, int64, error)) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	var after int64
+	count := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		items, last, err := next(after)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			count++
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		if len(items) < exportBatchSize {
+			break
+		}
+		after = last
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// copyMedia copies a media file in the archive, adding the extension of its format to the name. Files removed in the
+// meantime are skipped
+func (q *dataExportQueue) copyMedia(ctx context.Context, create func(name string) (io.Writer, error), m exportMedia) error {
+	obj, err := q.media.Open(ctx, m.key)
+	if errors.Is(err, mediastore.ErrNotFound) || errors.Is(err, mediastore.ErrInvalidKey) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = obj.Close() }()
+
+	r := bufio.NewReader(obj)
+	head, err := r.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	name := m.name
+	if format := sniffMediaFormat(head); format != "" {
+		name += "." + mediaExtension(format)
+	}
+
+	w, err := create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Function that returns the file extension of a format recognized by sniffMediaFormat
+func mediaExtension(format string) string {
+	if format == formatJPEG {
+		return "jpg"
+	}
+	return format
+}
+
+// requestDataExport starts the generation of an archive with all the data of the requesting user. The archive is
+// generated in background: its state is returned by getDataExport. Requesting an export while one is being generated
+// returns the pending one
+func (rt *_router) requestDataExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	pathId := ps.ByName("id")
+	if status := validateRequestingUser(pathId, extractBearer(r.Header.Get("Authorization"))); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	user := database.User{IdUser: pathId}
+	previous, err := rt.db.StartDataExport(user)
+	if err != nil && !errors.Is(err, database.ErrDataExportInProgress) {
+		ctx.Logger.WithError(err).Error("requestDataExport: db.StartDataExport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if previous != "" {
+		rt.removeMedia(previous, ctx)
+	}
+	if !rt.dataExports.enqueue(pathId) {
+		rt.dataExports.fail(pathId)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: EXPORT_QUEUE_FULL_ERROR_MSG})
+		return
+	}
+
+	export, err := rt.db.GetDataExport(user)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("requestDataExport: db.GetDataExport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(export)
+}
+
+// getDataExport returns the state of the last data export of the requesting user
+func (rt *_router) getDataExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	pathId := ps.ByName("id")
+	if status := validateRequestingUser(pathId, extractBearer(r.Header.Get("Authorization"))); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	export, err := rt.db.GetDataExport(database.User{IdUser: pathId})
+	if errors.Is(err, database.ErrDataExportNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("getDataExport: db.GetDataExport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(export)
+}
+
+// downloadDataExport serves the archive of the last data export of the requesting user, once ready. Range requests
+// are answered, so that interrupted downloads can be resumed
+func (rt *_router) downloadDataExport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	pathId := ps.ByName("id")
+	if status := validateRequestingUser(pathId, extractBearer(r.Header.Get("Authorization"))); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	export, err := rt.db.GetDataExport(database.User{IdUser: pathId})
+	if errors.Is(err, database.ErrDataExportNotFound) || (err == nil && export.Status != database.DataExportReady) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("downloadDataExport: db.GetDataExport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="wasaphoto-`+pathId+`.zip"`)
+	// The archives, with the copies of the photos, take longer than the media files
+	rt.serveMedia(w, r, export.ArchivePath, rt.exportTimeout, ctx)
+}
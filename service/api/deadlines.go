@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connContextKey is the key of the connection of a request in its context (see ConnContext)
+type connContextKey struct{}
+
+// ConnContext must be set as the ConnContext of the http.Server: it saves the connection in the context of its
+// requests, so that the handlers can extend its deadlines (see extendDeadlines)
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// Function that moves the read and write deadlines of the connection of a request to timeout from now, overriding the
+// ReadTimeout and WriteTimeout of the server for this request only (the server resets them for the next request on
+// the connection). It does nothing if the server has no ConnContext
+func extendDeadlines(r *http.Request, timeout time.Duration) {
+	c, ok := r.Context().Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	_ = c.SetReadDeadline(deadline)
+	_ = c.SetWriteDeadline(deadline)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// Number of deleted users whose media folders can wait to be removed. When the queue is full the folders are left to
+// the media garbage collector
+const mediaRemovalQueueSize = 32
+
+// Function that deletes the account of the requesting user with all his/her data. The user confirms the deletion by
+// typing his/her nickname in the body
+func (rt *_router) deleteAccount(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+
+	pathId := ps.ByName("id")
+	if status := validateRequestingUser(pathId, extractBearer(r.Header.Get("Authorization"))); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	var confirmation Nickname
+	if err := json.NewDecoder(r.Body).Decode(&confirmation); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	exists, err := rt.db.CheckUser(database.User{IdUser: pathId})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("deleteAccount: db.CheckUser error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	}
+	nickname, err := rt.db.GetNickname(database.User{IdUser: pathId})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("deleteAccount: db.GetNickname error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if strings.TrimSpace(confirmation.Nickname) != nickname {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: DELETION_NOT_CONFIRMED_ERROR_MSG})
+		return
+	}
+
+	err = rt.db.DeleteUser(database.User{IdUser: pathId}, rt.anonymizeMessages)
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("deleteAccount: db.DeleteUser error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Listing the store can take longer than the request: the files are removed in background
+	rt.mediaRemovals.enqueue(pathId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mediaRemovalQueue removes the media folders of the deleted users in a background goroutine. Failures and the
+// removals interrupted by a shutdown are only logged: the files left behind are removed by the media garbage collector
+// (cmd/mediagc)
+type mediaRemovalQueue struct {
+	media   mediastore.MediaStore
+	exports *dataExportQueue
+	logger  logrus.FieldLogger
+
+	queue chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newMediaRemovalQueue(media mediastore.MediaStore, exports *dataExportQueue, logger logrus.FieldLogger) *mediaRemovalQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &mediaRemovalQueue{
+		media:   media,
+		exports: exports,
+		logger:  logger,
+		queue:   make(chan string, mediaRemovalQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue schedules the removal of the media folder of a deleted user
+func (q *mediaRemovalQueue) enqueue(userID string) {
+	select {
+	case q.queue <- userID:
+	default:
+		q.logger.WithField("user", userID).Warning("media: removal queue full, files of a deleted user left behind")
+	}
+}
+
+func (q *mediaRemovalQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case userID := <-q.queue:
+			q.remove(userID)
+		}
+	}
+}
+
+// close stops the background goroutine, aborting the removal in progress
+func (q *mediaRemovalQueue) close() {
+	q.cancel()
+	<-q.done
+}
+
+// remove deletes the media folder of a deleted user ("<user>/": photos, renditions, profile photos and data exports).
+// The data export of the user is aborted first, so that its archive isn't saved after the folder has been listed
+func (q *mediaRemovalQueue) remove(userID string) {
+	logger := q.logger.WithField("user", userID)
+	q.exports.abort(userID)
+
+	var keys []string
+	err := q.media.List(q.ctx, userID+"/", func(info mediastore.ObjectInfo) error {
+		keys = append(keys, info.Key)
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return
+	} else if err != nil {
+		logger.WithError(err).Warning("media: error listing the files of a deleted user")
+		return
+	}
+	for _, key := range keys {
+		err := q.media.Delete(q.ctx, key)
+		if errors.Is(err, context.Canceled) {
+			return
+		} else if err != nil {
+			logger.WithError(err).Warning("media: error removing " + key)
+		}
+	}
+	logger.Infof("media: removed %d files of a deleted user", len(keys))
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Time windows of the recent activity of the suggested users and of the likes and comments of the trending photos
+const suggestionActivityWindow = 30 * 24 * time.Hour
+const trendingWindow = 7 * 24 * time.Hour
+
+// suggestionsList is the list of the users suggested to follow
+type suggestionsList struct {
+	Suggestions []database.Suggestion `json:"suggestions"`
+}
+
+// getFollowSuggestions returns the users suggested to the requesting user, ranked by mutual follows, shared groups and
+// recent activity
+func (rt *_router) getFollowSuggestions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	identifier := extractBearer(r.Header.Get("Authorization"))
+
+	// A user can only see his/her suggestions
+	valid := validateRequestingUser(ps.ByName("id"), identifier)
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	limit, ok := parseLimitParam(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := rt.db.GetFollowSuggestions(User{IdUser: identifier}.ToDatabase(),
+		time.Now().UTC().Add(-suggestionActivityWindow), limit)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getFollowSuggestions: db.GetFollowSuggestions error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(suggestionsList{Suggestions: suggestions}); err != nil {
+		ctx.Logger.WithError(err).Error("getFollowSuggestions/Encode: failed to encode suggestions json")
+	}
+}
+
+// getTrendingPhotos returns the photos with the most likes and comments of the last week, best ranked first. The
+// list isn't paginated: it's made of the first limit photos of the ranking
+func (rt *_router) getTrendingPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	auth := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(auth) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	limit, ok := parseLimitParam(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	photos, err := rt.db.GetTrendingPhotos(User{IdUser: auth}.ToDatabase(), time.Now().UTC().Add(-trendingWindow), limit)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getTrendingPhotos: db.GetTrendingPhotos error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(photosPage{Photos: photos}); err != nil {
+		ctx.Logger.WithError(err).Error("getTrendingPhotos/Encode: failed to encode photos json")
+	}
+}
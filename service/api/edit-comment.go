@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that changes the text of a comment. Only its author can edit it; the response is the edited comment, with
+// its edited_at
+func (rt *_router) patchComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+
+	photoId, ok := rt.commentedPhoto(w, ps, requestingUserId, ctx, "patch-comment")
+	if !ok {
+		return
+	}
+
+	commentId, err := strconv.ParseInt(ps.ByName("comment_id"), 10, 64)
+	if err != nil || commentId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var comment Comment
+	err = json.NewDecoder(r.Body).Decode(&comment)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	comment.Comment, ok = validComment(comment.Comment, rt.maxCommentLength)
+	if !ok {
+		rt.writeInvalidComment(w)
+		return
+	}
+
+	edited, err := rt.db.EditComment(
+		PhotoId{IdPhoto: photoId}.ToDatabase(),
+		User{IdUser: requestingUserId}.ToDatabase(),
+		CommentId{IdComment: commentId}.ToDatabase(),
+		comment.ToDatabase())
+	if errors.Is(err, database.ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: COMMENT_NOT_FOUND_ERROR_MSG})
+		return
+	} else if errors.Is(err, database.ErrForbiddenCommentAction) {
+		// Only the author can edit a comment
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("patch-comment/db.EditComment: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(edited)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum size (in bytes) of a reaction. Long ZWJ sequences (families) and subdivision flags fit comfortably.
+const maxReactionBytes = 64
+
+// Code points that can start an emoji: the Unicode Emoji property, without the code points that only make sense inside
+// a sequence like skin tones, regional indicators and keycap bases. From U+1F300 on, the emoji ranges of the
+// pictographic blocks are taken whole, skipping the plain symbols between them (ornamental dingbats, alchemical and
+// geometric symbols, chess pieces...); the older blocks mix emojis with plain symbols and are listed code by code
+var emojiBase = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00a9, Stride: 1},
+		{Lo: 0x00ae, Hi: 0x00ae, Stride: 1},
+		{Lo: 0x203c, Hi: 0x203c, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23cf, Hi: 0x23cf, Stride: 1},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25b6, Stride: 1},
+		{Lo: 0x25c0, Hi: 0x25c0, Stride: 1},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x2604, Stride: 1},
+		{Lo: 0x260e, Hi: 0x260e, Stride: 1},
+		{Lo: 0x2611, Hi: 0x2611, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2615, Stride: 1},
+		{Lo: 0x2618, Hi: 0x2618, Stride: 1},
+		{Lo: 0x261d, Hi: 0x261d, Stride: 1},
+		{Lo: 0x2620, Hi: 0x2620, Stride: 1},
+		{Lo: 0x2622, Hi: 0x2623, Stride: 1},
+		{Lo: 0x2626, Hi: 0x2626, Stride: 1},
+		{Lo: 0x262a, Hi: 0x262a, Stride: 1},
+		{Lo: 0x262e, Hi: 0x262f, Stride: 1},
+		{Lo: 0x2638, Hi: 0x263a, Stride: 1},
+		{Lo: 0x2640, Hi: 0x2640, Stride: 1},
+		{Lo: 0x2642, Hi: 0x2642, Stride: 1},
+		{Lo: 0x2648, Hi: 0x2653, Stride: 1},
+		{Lo: 0x265f, Hi: 0x2660, Stride: 1},
+		{Lo: 0x2663, Hi: 0x2663, Stride: 1},
+		{Lo: 0x2665, Hi: 0x2666, Stride: 1},
+		{Lo: 0x2668, Hi: 0x2668, Stride: 1},
+		{Lo: 0x267b, Hi: 0x267b, Stride: 1},
+		{Lo: 0x267e, Hi: 0x267f, Stride: 1},
+		{Lo: 0x2692, Hi: 0x2697, Stride: 1},
+		{Lo: 0x2699, Hi: 0x2699, Stride: 1},
+		{Lo: 0x269b, Hi: 0x269c, Stride: 1},
+		{Lo: 0x26a0, Hi: 0x26a1, Stride: 1},
+		{Lo: 0x26a7, Hi: 0x26a7, Stride: 1},
+		{Lo: 0x26aa, Hi: 0x26ab, Stride: 1},
+		{Lo: 0x26b0, Hi: 0x26b1, Stride: 1},
+		{Lo: 0x26bd, Hi: 0x26be, Stride: 1},
+		{Lo: 0x26c4, Hi: 0x26c5, Stride: 1},
+		{Lo: 0x26c8, Hi: 0x26c8, Stride: 1},
+		{Lo: 0x26ce, Hi: 0x26cf, Stride: 1},
+		{Lo: 0x26d1, Hi: 0x26d1, Stride: 1},
+		{Lo: 0x26d3, Hi: 0x26d4, Stride: 1},
+		{Lo: 0x26e9, Hi: 0x26ea, Stride: 1},
+		{Lo: 0x26f0, Hi: 0x26f5, Stride: 1},
+		{Lo: 0x26f7, Hi: 0x26fa, Stride: 1},
+		{Lo: 0x26fd, Hi: 0x26fd, Stride: 1},
+		{Lo: 0x2702, Hi: 0x2702, Stride: 1},
+		{Lo: 0x2705, Hi: 0x2705, Stride: 1},
+		{Lo: 0x2708, Hi: 0x270d, Stride: 1},
+		{Lo: 0x270f, Hi: 0x270f, Stride: 1},
+		{Lo: 0x2712, Hi: 0x2712, Stride: 1},
+		{Lo: 0x2714, Hi: 0x2714, Stride: 1},
+		{Lo: 0x2716, Hi: 0x2716, Stride: 1},
+		{Lo: 0x271d, Hi: 0x271d, Stride: 1},
+		{Lo: 0x2721, Hi: 0x2721, Stride: 1},
+		{Lo: 0x2728, Hi: 0x2728, Stride: 1},
+		{Lo: 0x2733, Hi: 0x2734, Stride: 1},
+		{Lo: 0x2744, Hi: 0x2744, Stride: 1},
+		{Lo: 0x2747, Hi: 0x2747, Stride: 1},
+		{Lo: 0x274c, Hi: 0x274c, Stride: 1},
+		{Lo: 0x274e, Hi: 0x274e, Stride: 1},
+		{Lo: 0x2753, Hi: 0x2755, Stride: 1},
+		{Lo: 0x2757, Hi: 0x2757, Stride: 1},
+		{Lo: 0x2763, Hi: 0x2764, Stride: 1},
+		{Lo: 0x2795, Hi: 0x2797, Stride: 1},
+		{Lo: 0x27a1, Hi: 0x27a1, Stride: 1},
+		{Lo: 0x27b0, Hi: 0x27b0, Stride: 1},
+		{Lo: 0x27bf, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b50, Stride: 1},
+		{Lo: 0x2b55, Hi: 0x2b55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303d, Hi: 0x303d, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1},
+		{Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f004, Hi: 0x1f004, Stride: 1},
+		{Lo: 0x1f0cf, Hi: 0x1f0cf, Stride: 1},
+		{Lo: 0x1f170, Hi: 0x1f171, Stride: 1},
+		{Lo: 0x1f17e, Hi: 0x1f17f, Stride: 1},
+		{Lo: 0x1f18e, Hi: 0x1f18e, Stride: 1},
+		{Lo: 0x1f191, Hi: 0x1f19a, Stride: 1},
+		{Lo: 0x1f201, Hi: 0x1f202, Stride: 1},
+		{Lo: 0x1f21a, Hi: 0x1f21a, Stride: 1},
+		{Lo: 0x1f22f, Hi: 0x1f22f, Stride: 1},
+		{Lo: 0x1f232, Hi: 0x1f23a, Stride: 1},
+		{Lo: 0x1f250, Hi: 0x1f251, Stride: 1},
+		{Lo: 0x1f300, Hi: 0x1f3fa, Stride: 1},
+		{Lo: 0x1f400, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f680, Hi: 0x1f6ff, Stride: 1},
+		{Lo: 0x1f7e0, Hi: 0x1f7eb, Stride: 1},
+		{Lo: 0x1f90c, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x1fa70, Hi: 0x1faff, Stride: 1},
+	},
+}
+
+const (
+	zeroWidthJoiner    = 0x200d
+	variationSelector  = 0xfe0f
+	combiningKeycap    = 0x20e3
+	skinToneFirst      = 0x1f3fb
+	skinToneLast       = 0x1f3ff
+	regionalIndicatorA = 0x1f1e6
+	regionalIndicatorZ = 0x1f1ff
+	tagFirst           = 0xe0020
+	tagLast            = 0xe007e
+	cancelTag          = 0xe007f
+)
+
+// Function that checks if a reaction is exactly one emoji grapheme cluster: a single emoji (optionally with variation
+// selector, skin tone and tag sequence), a ZWJ sequence of emojis, a keycap or a flag
+func validReaction(reaction string) bool {
+	if reaction == "" || len(reaction) > maxReactionBytes || !utf8.ValidString(reaction) {
+		return false
+	}
+	runes := []rune(reaction)
+
+	// Flags: exactly two regional indicators
+	if isRegionalIndicator(runes[0]) {
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	}
+
+	// Keycaps: [0-9#*] followed by an optional variation selector and the combining keycap
+	if runes[0] == '#' || runes[0] == '*' || (runes[0] >= '0' && runes[0] <= '9') {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	}
+
+	// Everything else: emoji elements joined by ZWJ
+	i := 0
+	for {
+		next, ok := emojiElement(runes, i)
+		if !ok {
+			return false
+		}
+		i = next
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+	}
+}
+
+// Parses one emoji element starting at runes[i]. Returns the index right after it and whether it was valid
+func emojiElement(runes []rune, i int) (int, bool) {
+	if i >= len(runes) || !unicode.Is(emojiBase, runes[i]) {
+		return i, false
+	}
+	i++
+	if i < len(runes) && runes[i] == variationSelector {
+		i++
+	}
+	if i < len(runes) && runes[i] >= skinToneFirst && runes[i] <= skinToneLast {
+		i++
+	}
+
+	// Tag sequences (e.g. the flags of England or Scotland) must be terminated by the cancel tag
+	if i < len(runes) && runes[i] >= tagFirst && runes[i] <= tagLast {
+		for i < len(runes) && runes[i] >= tagFirst && runes[i] <= tagLast {
+			i++
+		}
+		if i == len(runes) || runes[i] != cancelTag {
+			return i, false
+		}
+		i++
+	}
+	return i, true
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidReaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction string
+		valid    bool
+	}{
+		{"single emoji", "😀", true},
+		{"emoji from the BMP", "❤", true},
+		{"emoji with variation selector", "❤️", true},
+		{"transport", "🚀", true},
+		{"colored circle", "🟠", true},
+		{"supplemental symbols", "🤌", true},
+		{"extended pictographic", "🫠", true},
+		{"skin tone", "👍🏽", true},
+		{"zwj sequence", "👩‍💻", true},
+		{"family", "👨‍👩‍👧‍👦", true},
+		{"zwj with skin tones", "🧑🏻‍🤝‍🧑🏿", true},
+		{"rainbow flag", "🏳️‍🌈", true},
+		{"keycap", "1️⃣", true},
+		{"keycap without variation selector", "#⃣", true},
+		{"flag", "🇮🇹", true},
+		{"subdivision flag", "🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", true},
+
+		{"empty", "", false},
+		{"text", "ok", false},
+		{"two emojis", "😀😀", false},
+		{"trailing zwj", "👩‍", false},
+		{"leading zwj", "‍👩", false},
+		{"skin tone alone", "🏽", false},
+		{"single regional indicator", "🇮", false},
+		{"three regional indicators", "🇮🇹🇮", false},
+		{"keycap base alone", "1", false},
+		{"keycap with extra characters", "1️⃣1", false},
+		{"unterminated tag sequence", "🏴\U000E0067\U000E0062", false},
+		{"ornamental dingbat", "\U0001F650", false},
+		{"alchemical symbol", "\U0001F700", false},
+		{"geometric shape", "\U0001F780", false},
+		{"supplemental arrow", "\U0001F800", false},
+		{"before the supplemental symbols", "\U0001F90B", false},
+		{"chess symbol", "\U0001FA00", false},
+		{"playing card", "\U0001F0A1", false},
+		{"too long", strings.Repeat("👩‍", 20) + "👩", false},
+		{"invalid utf-8", "\xf0\x9f\x98", false},
+	}
+	for _, tt := range tests {
+		if got := validReaction(tt.reaction); got != tt.valid {
+			t.Errorf("%s: validReaction(%q) = %v, want %v", tt.name, tt.reaction, got, tt.valid)
+		}
+	}
+}
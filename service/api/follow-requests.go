@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that makes the account of the user private or public. Making it public approves the pending follow requests
+func (rt *_router) putPrivacy(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	identifier := ps.ByName("id")
+
+	// Check the user's identity for the operation
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	var privacy Privacy
+	err := json.NewDecoder(r.Body).Decode(&privacy)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+
+	err = rt.db.SetPrivate(User{IdUser: identifier}.ToDatabase(), privacy.Private)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("put-privacy/db.SetPrivate: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(privacy)
+}
+
+// Function that retrieves the pending follow requests of the user, oldest first
+func (rt *_router) getFollowRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	identifier := ps.ByName("id")
+
+	// Only the user can see his/her follow requests
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	requests, err := rt.db.GetFollowRequests(User{IdUser: identifier}.ToDatabase())
+	if err != nil {
+		ctx.Logger.WithError(err).Error("get-follow-requests/db.GetFollowRequests: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(requests)
+}
+
+// Function that approves a pending follow request: the requester becomes a follower of the user
+func (rt *_router) approveFollowRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	identifier := ps.ByName("id")
+
+	// Only the user can approve his/her follow requests
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	err := rt.db.ApproveFollowRequest(
+		User{IdUser: identifier}.ToDatabase(),
+		User{IdUser: ps.ByName("requester_id")}.ToDatabase())
+	if errors.Is(err, database.ErrFollowRequestNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("approve-follow-request/db.ApproveFollowRequest: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Function that removes a pending follow request: the user rejects it, or the requester withdraws it
+func (rt *_router) deleteFollowRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+	identifier := ps.ByName("id")
+	requester := ps.ByName("requester_id")
+
+	if isNotLogged(requestingUserId) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if requestingUserId != identifier && requestingUserId != requester {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := rt.db.RemoveFollowRequest(
+		User{IdUser: identifier}.ToDatabase(),
+		User{IdUser: requester}.ToDatabase())
+	if errors.Is(err, database.ErrFollowRequestNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("delete-follow-request/db.RemoveFollowRequest: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
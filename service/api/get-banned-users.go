@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that retrieves the list of users banned by the user
+func (rt *_router) getBannedUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	identifier := ps.ByName("id")
+
+	// Only the user can see his/her banned list
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	banned, err := rt.db.GetBannedUsers(User{IdUser: identifier}.ToDatabase())
+	if err != nil {
+		ctx.Logger.WithError(err).Error("get-banned-users/db.GetBannedUsers: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(banned)
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// commentsPage is a page of the comments of a photo
+type commentsPage struct {
+	Comments   []database.CompleteComment `json:"comments"`
+	NextCursor string                     `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// Function that checks that the photo in the path exists, belongs to the user in the path and is visible to the
+// requesting user (not banned by the owner, an approved follower if the owner is private). It replies with the error and
+// returns false otherwise
+func (rt *_router) commentedPhoto(w http.ResponseWriter, ps httprouter.Params, requester string, ctx reqcontext.RequestContext, where string) (int64, bool) {
+	photo, ok := rt.visiblePhoto(w, ps, requester, ctx, where)
+	return int64(photo.PhotoId), ok
+}
+
+// Function that performs the checks of commentedPhoto and returns the photo
+func (rt *_router) visiblePhoto(w http.ResponseWriter, ps httprouter.Params, requester string, ctx reqcontext.RequestContext, where string) (database.Photo, bool) {
+
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return database.Photo{}, false
+	}
+
+	photoId, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
+	if err != nil || photoId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return database.Photo{}, false
+	}
+
+	// The owner is checked first, so that a wrong path doesn't tell if the owner banned the requester
+	photo, err := rt.db.GetPhoto(User{IdUser: requester}.ToDatabase(), PhotoId{IdPhoto: photoId}.ToDatabase())
+	if errors.Is(err, database.ErrPhotoDoesntExist) || (photo.Owner != "" && photo.Owner != ps.ByName("id")) {
+		w.WriteHeader(http.StatusNotFound)
+		return database.Photo{}, false
+	} else if errors.Is(err, database.ErrUserBanned) {
+		w.WriteHeader(http.StatusForbidden)
+		return database.Photo{}, false
+	} else if errors.Is(err, database.ErrPrivateAccount) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: PRIVATE_ACCOUNT_ERROR_MSG})
+		return database.Photo{}, false
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error(where + "/db.GetPhoto: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return database.Photo{}, false
+	}
+	return photo, true
+}
+
+// Function that retrieves a page of the comments of a photo (oldest first): the top-level comments, or the replies of
+// the comment in the query parameter parent
+func (rt *_router) getComments(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+
+	photoId, ok := rt.commentedPhoto(w, ps, requestingUserId, ctx, "get-comments")
+	if !ok {
+		return
+	}
+
+	// The cursor is the identifier of the last comment of the previous page
+	afterId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var parent int64
+	if p := r.URL.Query().Get("parent"); p != "" {
+		var err error
+		parent, err = strconv.ParseInt(p, 10, 64)
+		if err != nil || parent <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One extra comment is loaded to know if there's a next page
+	comments, err := rt.db.GetCommentsPage(
+		User{IdUser: requestingUserId}.ToDatabase(),
+		PhotoId{IdPhoto: photoId}.ToDatabase(),
+		CommentId{IdComment: parent}.ToDatabase(),
+		afterId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("get-comments/db.GetCommentsPage: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := commentsPage{Comments: comments}
+	if len(comments) > limit {
+		page.Comments = comments[:limit]
+		page.NextCursor = strconv.FormatInt(comments[limit-1].IdComment, 10)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		ctx.Logger.WithError(err).Error("get-comments/Encode: failed to encode comments json")
+		return
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that retrieves the users that liked a photo, oldest like first
+func (rt *_router) getLikes(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	requestingUserId := extractBearer(r.Header.Get("Authorization"))
+
+	photo, ok := rt.visiblePhoto(w, ps, requestingUserId, ctx, "get-likes")
+	if !ok {
+		return
+	}
+
+	likes, err := rt.db.GetLikesList(
+		User{IdUser: requestingUserId}.ToDatabase(),
+		User{IdUser: photo.Owner}.ToDatabase(),
+		PhotoId{IdPhoto: int64(photo.PhotoId)}.ToDatabase())
+	if err != nil {
+		ctx.Logger.WithError(err).Error("get-likes/db.GetLikesList: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(likes); err != nil {
+		ctx.Logger.WithError(err).Error("get-likes/Encode: failed to encode likes json")
+	}
+}
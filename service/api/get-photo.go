@@ -1,17 +1,111 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"path/filepath"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that serves the requested photo
+// Cache-Control of the photos: the response depends on the requester (bans), so only the browser can cache it, and
+// only for a while, so that a new ban takes effect
+const photoCacheControl = "private, max-age=3600"
+
+// Function that serves the requested photo. The query parameter item selects one of the media items of the post (the
+// first by default) and size one of its renditions or its poster (the original by default). The requester must be
+// logged and not banned by the owner
 func (rt *_router) getPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
-	http.ServeFile(w, r,
-		filepath.Join(photoFolder, ps.ByName("id"), "photos", ps.ByName("photo_id")))
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	exists, err := rt.db.CheckUser(User{IdUser: requester}.ToDatabase())
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getPhoto: db.CheckUser error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	photoId, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
+	if err != nil || photoId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	item := 0
+	if value := r.URL.Query().Get("item"); value != "" {
+		item, err = strconv.Atoi(value)
+		if err != nil || item < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	itemName := photoItemName(strconv.FormatInt(photoId, 10), item)
+	name, ok := photoFileName(itemName, r.URL.Query().Get("size"))
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The photo must exist and belong to the user in the path (checked first, so that a wrong path doesn't tell if the
+	// owner banned the requester), and the owner must not have banned the requester
+	photo, err := rt.db.GetPhoto(User{IdUser: requester}.ToDatabase(), PhotoId{IdPhoto: photoId}.ToDatabase())
+	if errors.Is(err, database.ErrPhotoDoesntExist) || (photo.Owner != "" && photo.Owner != ps.ByName("id")) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, database.ErrUserBanned) || errors.Is(err, database.ErrPrivateAccount) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("getPhoto: db.GetPhoto error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if item >= len(photo.Media) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	obj, err := rt.media.Open(r.Context(), userPhotoKey(photo.Owner, name))
+	if errors.Is(err, mediastore.ErrNotFound) && name != itemName {
+		// Photos uploaded before the renditions were introduced, GIFs and videos only have the original (images have no
+		// poster)
+		name = itemName
+		obj, err = rt.media.Open(r.Context(), userPhotoKey(photo.Owner, name))
+	}
+	if err == nil {
+		// Files of a photo never change (a new upload is a new photo), except when they're regenerated
+		w.Header().Set("ETag", fmt.Sprintf("\"%s-%x\"", name, obj.ModTime().UnixNano()))
+		w.Header().Set("Cache-Control", photoCacheControl)
+		w.Header().Set("Vary", "Authorization")
+	}
+	rt.serveMediaObject(w, r, name, obj, err, rt.downloadTimeout, ctx)
+
+}
 
+// Function that returns the name of the file of a photo for the requested size ("original", or empty, for the
+// original, "poster" for the poster of GIFs and videos). Returns false if the size isn't one of the renditions
+func photoFileName(photoId string, size string) (string, bool) {
+	if size == "" || size == "original" {
+		return photoId, true
+	}
+	if size == photoPosterName {
+		return photoRenditionName(photoId, photoPosterName), true
+	}
+	for _, s := range photoRenditionSizes {
+		if strconv.Itoa(s) == size {
+			return photoRenditionName(photoId, size), true
+		}
+	}
+	return "", false
 }
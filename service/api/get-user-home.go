@@ -4,12 +4,22 @@ import (
 	"encoding/json"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"new-wasa/service/database"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// This function retrieves all the photos of the people that the user is following
+// Stream modes
+const streamModeFollowing = "following"
+const streamModeDiscover = "discover"
+
+// streamPage is a page of the home stream
+type streamPage struct {
+	Mode string `json:"mode"`
+	photosPage
+}
+
+// This function retrieves a page of the photos of the people that the user is following, newest first. If the user
+// doesn't follow anybody the stream falls back to the discover mode (recent photos of all users).
 func (rt *_router) getHome(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -22,66 +32,34 @@ func (rt *_router) getHome(w http.ResponseWriter, r *http.Request, ps httprouter
 		return
 	}
 
-	followers, err := rt.db.GetFollowing(User{IdUser: identifier}.ToDatabase())
+	beforeId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	following, err := rt.db.CountFollowing(User{IdUser: identifier}.ToDatabase())
 	if err != nil {
+		ctx.Logger.WithError(err).Error("getHome: db.CountFollowing error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	page := streamPage{Mode: streamModeFollowing}
+	if following == 0 {
+		page.Mode = streamModeDiscover
+	}
 
-	photos := make([]database.Photo, 0)
-	for _, follower := range followers {
-
-		followerPhoto, err := rt.db.GetPhotosList(
-			User{IdUser: identifier}.ToDatabase(),
-			User{IdUser: follower.IdUser}.ToDatabase())
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// If user doesn't follow anyone or stream is empty, show recent posts from all users
-		if len(photos) == 0 {
-			allUsers, err := rt.db.GetAllUsers()
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for _, u := range allUsers {
-				// skip banned relationships
-				banned, berr := rt.db.BannedUserCheck(User{IdUser: identifier}.ToDatabase(), User{IdUser: u.IdUser}.ToDatabase())
-				if berr != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				if banned {
-					continue
-				}
-				lst, lerr := rt.db.GetPhotosList(User{IdUser: identifier}.ToDatabase(), User{IdUser: u.IdUser}.ToDatabase())
-				if lerr != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				// limit per user
-				for i, p := range lst {
-					if i >= database.PhotosPerUserHome {
-						break
-					}
-					photos = append(photos, p)
-				}
-			}
-		}
-
-		for i, photo := range followerPhoto {
-			if i >= database.PhotosPerUserHome {
-				break
-			}
-			photos = append(photos, photo)
-		}
-
+	// One extra photo is loaded to know if there's a next page
+	photos, err := rt.db.GetStream(User{IdUser: identifier}.ToDatabase(), page.Mode == streamModeDiscover, beforeId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getHome: db.GetStream error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	page.photosPage = newPhotosPage(photos, limit)
 
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(photos); err != nil {
+	if err := json.NewEncoder(w).Encode(page); err != nil {
 		ctx.Logger.WithError(err).Error("getHome/Encode: failed to encode photos json")
 		return
 	}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
@@ -9,16 +10,13 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that retrives all the necessary infos of a profile
+// Function that retrives the infos of a profile and the counters of its lists. The followers, the followed users and
+// the photos are listed by separate paginated endpoints (see profile-lists.go)
 func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	requestingUserId := extractBearer(r.Header.Get("Authorization"))
 	requestedUser := ps.ByName("id")
 
-	var followers []database.User
-	var following []database.User
-	var photos []database.Photo
-
 	// Check if the requesting user is banned by the requested profile owner
 	userBanned, err := rt.db.BannedUserCheck(User{IdUser: requestingUserId}.ToDatabase(),
 		User{IdUser: requestedUser}.ToDatabase())
@@ -45,52 +43,62 @@ func (rt *_router) getUserProfile(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	userExists, err := rt.db.CheckUser(User{IdUser: requestedUser}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("getUserProfile/db.CheckUser: error executing query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if !userExists {
+	profile, err := rt.db.GetProfile(User{IdUser: requestedUser}.ToDatabase())
+	if errors.Is(err, database.ErrUserNotFound) {
 		w.WriteHeader(http.StatusNoContent)
 		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("getUserProfile/db.GetProfile: error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	followers, err = rt.db.GetFollowers(User{IdUser: requestedUser}.ToDatabase())
+	// The lists of private accounts are shown only to the approved followers (see profileListAccess)
+	private, err := rt.db.IsPrivate(User{IdUser: requestedUser}.ToDatabase())
 	if err != nil {
-		ctx.Logger.WithError(err).Error("getUserProfile/db.GetFollowers: error executing query")
+		ctx.Logger.WithError(err).Error("getUserProfile/db.IsPrivate: error executing query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	following, err = rt.db.GetFollowing(User{IdUser: requestedUser}.ToDatabase())
+	followStatus, err := rt.db.GetFollowStatus(User{IdUser: requestingUserId}.ToDatabase(), User{IdUser: requestedUser}.ToDatabase())
 	if err != nil {
-		ctx.Logger.WithError(err).Error("getUserProfile/db.GetFollowing: error executing query")
+		ctx.Logger.WithError(err).Error("getUserProfile/db.GetFollowStatus: error executing query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	photos, err = rt.db.GetPhotosList(User{IdUser: requestingUserId}.ToDatabase(), User{IdUser: requestedUser}.ToDatabase())
+	moderator, err := rt.db.IsModerator(User{IdUser: requestedUser}.ToDatabase())
 	if err != nil {
-		ctx.Logger.WithError(err).Error("getUserProfile/db.GetPhotosList: error executing query")
+		ctx.Logger.WithError(err).Error("getUserProfile/db.IsModerator: error executing query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	nickname, err := rt.db.GetNickname(User{IdUser: requestedUser}.ToDatabase())
+	// Mute and restrict are visible only to who set them
+	muted, restricted, err := rt.db.GetMuteRestrict(User{IdUser: requestingUserId}.ToDatabase(), User{IdUser: requestedUser}.ToDatabase())
 	if err != nil {
-		ctx.Logger.WithError(err).Error("getUserProfile/db.GetNickname: error executing query")
+		ctx.Logger.WithError(err).Error("getUserProfile/db.GetMuteRestrict: error executing query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(CompleteProfile{
-		Name:      requestedUser,
-		Nickname:  nickname,
-		Followers: followers,
-		Following: following,
-		Posts:     photos,
+		Name:        requestedUser,
+		Nickname:    profile.Nickname,
+		DisplayName: profile.DisplayName,
+		Bio:         profile.Bio,
+		Website:     profile.Website,
+
+		FollowersCount: profile.FollowersCount,
+		FollowingCount: profile.FollowingCount,
+		PhotosCount:    profile.PhotosCount,
+
+		Private:      private,
+		FollowStatus: followStatus,
+		Muted:        muted,
+		Restricted:   restricted,
+		Moderator:    moderator,
 	})
 
 }
@@ -7,8 +7,7 @@ import (
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
-	"os"
-	"path/filepath"
+	"path"
 	"strconv"
 	"strings"
 
@@ -64,6 +63,10 @@ func (rt *_router) createGroup(w http.ResponseWriter, r *http.Request, ps httpro
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+		// Users can't put in a group the users they banned, or that banned them
+		if rt.bannedPeer(w, ctx, requester, id, "createGroup") {
+			return
+		}
 		members = append(members, database.User{IdUser: id})
 	}
 
@@ -118,6 +121,9 @@ func (rt *_router) addToGroup(w http.ResponseWriter, r *http.Request, ps httprou
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	if rt.bannedPeer(w, ctx, requester, memberID, "addToGroup") {
+		return
+	}
 
 	err = rt.db.AddUserToGroup(groupID, database.User{IdUser: memberID})
 	if err != nil {
@@ -250,41 +256,34 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
+	// The photo is received in a temporary file, within the limits of the images
+	upload, _, err := rt.receiveUpload(w, r, "photo", imageFormats)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("setGroupPhoto: error reading body")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeUploadError(w, err, ctx, "setGroupPhoto")
 		return
 	}
-	contentType := http.DetectContentType(data)
-	ext := ""
-	switch contentType {
-	case "image/jpeg":
-		ext = "jpg"
-	case "image/png":
+	defer func() { _ = upload.Close() }()
+	ext := "jpg"
+	if upload.format == formatPNG {
 		ext = "png"
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		return
 	}
 
-	groupDir := filepath.Join(photoFolder, "groups", strconv.FormatInt(groupID, 10))
-	if err := os.MkdirAll(groupDir, os.ModePerm); err != nil {
-		ctx.Logger.WithError(err).Error("setGroupPhoto: error creating group dir")
+	// Every version of the photo has its own key: the new file is saved before the database points to it
+	relPath, err := newMediaVersionKey(path.Join("groups", strconv.FormatInt(groupID, 10)), "photo", ext)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("setGroupPhoto: error generating the media key")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	filename := "photo." + ext
-	fullPath := filepath.Join(groupDir, filename)
-	if err := os.WriteFile(fullPath, data, 0o644); err != nil {
-		ctx.Logger.WithError(err).Error("setGroupPhoto: error writing file")
+	if err := rt.media.Put(r.Context(), relPath, upload.reader(), upload.size); err != nil {
+		ctx.Logger.WithError(err).Error("setGroupPhoto: error saving file")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	relPath := filepath.Join("groups", strconv.FormatInt(groupID, 10), filename)
-	err = rt.db.SetGroupPhotoPath(groupID, relPath)
+	previous, err := rt.db.SetGroupPhotoPath(groupID, relPath)
 	if err != nil {
+		rt.removeMedia(relPath, ctx)
 		if errors.Is(err, database.ErrGroupNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -293,6 +292,9 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if previous != "" && previous != relPath {
+		rt.removeMedia(previous, ctx)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -337,5 +339,72 @@ func (rt *_router) getGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 		return
 	}
 
-	http.ServeFile(w, r, filepath.Join(photoFolder, group.PhotoPath))
+	rt.serveMedia(w, r, group.PhotoPath, rt.downloadTimeout, ctx)
+}
+
+// muteGroup mutes a group for the requesting user (optionally including mentions).
+func (rt *_router) muteGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	groupID, err := strconv.ParseInt(ps.ByName("group_id"), 10, 64)
+	if err != nil || groupID <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("muteGroup: db.IsUserInGroup error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !inGroup {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	// The body is optional: an empty body mutes the group but keeps mentions
+	type muteGroupRequest struct {
+		MuteMentions bool `json:"mute_mentions"`
+	}
+	var req muteGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.SetGroupMute(groupID, database.User{IdUser: requester}, req.MuteMentions)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("muteGroup: db.SetGroupMute error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unmuteGroup removes the mute settings of the requesting user for a group.
+func (rt *_router) unmuteGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	groupID, err := strconv.ParseInt(ps.ByName("group_id"), 10, 64)
+	if err != nil || groupID <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.RemoveGroupMute(groupID, database.User{IdUser: requester})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("unmuteGroup: db.RemoveGroupMute error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"new-wasa/service/database"
+	"new-wasa/service/linkpreview"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Number of URLs that can wait to be fetched. When the queue is full new URLs are dropped (no preview for them)
+const linkPreviewQueueSize = 64
+
+// linkPreviewQueue fetches the previews of the links sent in messages in a background goroutine and stores them in the
+// database cache, where listMessages picks them up
+type linkPreviewQueue struct {
+	fetcher *linkpreview.Fetcher
+	db      database.AppDatabase
+	logger  logrus.FieldLogger
+	ttl     time.Duration
+
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newLinkPreviewQueue(fetcher *linkpreview.Fetcher, db database.AppDatabase, logger logrus.FieldLogger, ttl time.Duration) *linkPreviewQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &linkPreviewQueue{
+		fetcher: fetcher,
+		db:      db,
+		logger:  logger,
+		ttl:     ttl,
+		queue:   make(chan string, linkPreviewQueueSize),
+		pending: make(map[string]bool),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue schedules the fetch of the first link of a message body, unless a fresh preview is already cached
+func (q *linkPreviewQueue) enqueue(body string) {
+	url := linkpreview.FirstURL(body)
+	if url == "" {
+		return
+	}
+
+	cached, err := q.db.IsLinkPreviewCached(url, q.ttl)
+	if err != nil {
+		q.logger.WithError(err).Warning("link preview: db.IsLinkPreviewCached error")
+		return
+	}
+	if cached {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending[url] {
+		return
+	}
+	select {
+	case q.queue <- url:
+		q.pending[url] = true
+	default:
+		q.logger.WithField("url", url).Debug("link preview: queue full, url dropped")
+	}
+}
+
+func (q *linkPreviewQueue) run() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case url := <-q.queue:
+			q.fetch(url)
+			q.mu.Lock()
+			delete(q.pending, url)
+			q.mu.Unlock()
+		}
+	}
+}
+
+func (q *linkPreviewQueue) fetch(url string) {
+	preview, err := q.fetcher.Fetch(q.ctx, url)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	failed := err != nil
+	if failed {
+		q.logger.WithError(err).WithField("url", url).Debug("link preview: fetch failed")
+		preview = linkpreview.Preview{URL: url}
+	}
+
+	err = q.db.SaveLinkPreview(database.LinkPreview{
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		Image:       preview.Image,
+	}, failed)
+	if err != nil {
+		q.logger.WithError(err).Error("link preview: db.SaveLinkPreview error")
+	}
+}
+
+// close stops the background goroutine, aborting the fetch in progress
+func (q *linkPreviewQueue) close() {
+	q.cancel()
+	<-q.done
+}
+
+// requestLinkPreview schedules the preview of the first link of a message body (if previews are enabled)
+func (rt *_router) requestLinkPreview(body string) {
+	if rt.linkPreviews != nil {
+		rt.linkPreviews.enqueue(body)
+	}
+}
+
+// attachLinkPreviews sets the cached preview of the first link of each message (if previews are enabled)
+func (rt *_router) attachLinkPreviews(msgs []database.Message) error {
+	if rt.linkPreviews == nil || len(msgs) == 0 {
+		return nil
+	}
+
+	urls := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		if url := linkpreview.FirstURL(m.Body); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	previews, err := rt.db.GetLinkPreviews(urls)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		if preview, ok := previews[linkpreview.FirstURL(msgs[i].Body)]; ok {
+			p := preview
+			msgs[i].LinkPreview = &p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// mediaFile is an uploaded file processed in place: only the headers and the metadata are read, and the metadata is
+// overwritten
+type mediaFile interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Function that reads n bytes at offset off. A file that ends before is malformed
+func readMediaAt(f io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := f.ReadAt(buf, off)
+	if read == n {
+		return buf, nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil, errMediaFormat
+	}
+	return nil, err
+}
+
+// Function that overwrites the bytes between start and end with zeros
+func zeroMediaRange(f io.WriterAt, start int64, end int64) error {
+	zeros := make([]byte, 32<<10)
+	for start < end {
+		n := int64(len(zeros))
+		if end-start < n {
+			n = end - start
+		}
+		if _, err := f.WriteAt(zeros[:n], start); err != nil {
+			return err
+		}
+		start += n
+	}
+	return nil
+}
+
+// MP4 brands played by browsers. QuickTime files ("qt  ") aren't accepted
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso3": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "dash": true,
+}
+
+// Function that checks if data starts with the file type box of an MP4 file
+func isMP4(data []byte) bool {
+	if len(data) < 16 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if size < 16 || size > len(data) || string(data[8:12]) == "qt  " {
+		return false
+	}
+	if mp4Brands[string(data[8:12])] {
+		return true
+	}
+	// Compatible brands follow the major brand and its version
+	for i := 16; i+4 <= size; i += 4 {
+		if mp4Brands[string(data[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// Function that walks the boxes between start and end, calling fn with the type, the offset of the box and the offsets
+// of its payload. Returns an error if the boxes don't exactly cover the range
+func walkMP4Boxes(f io.ReaderAt, start int64, end int64, fn func(typ string, box int64, payload int64, boxEnd int64) error) error {
+	for i := start; i < end; {
+		if i+8 > end {
+			return errMediaFormat
+		}
+		header, err := readMediaAt(f, i, 8)
+		if err != nil {
+			return err
+		}
+		size := uint64(binary.BigEndian.Uint32(header))
+		headerLength := uint64(8)
+		switch size {
+		case 0:
+			// The box extends to the end of the file
+			size = uint64(end - i)
+		case 1:
+			if i+16 > end {
+				return errMediaFormat
+			}
+			large, err := readMediaAt(f, i+8, 8)
+			if err != nil {
+				return err
+			}
+			size = binary.BigEndian.Uint64(large)
+			headerLength = 16
+		}
+		if size < headerLength || size > uint64(end-i) {
+			return errMediaFormat
+		}
+		boxEnd := i + int64(size)
+		if err := fn(string(header[4:8]), i, i+int64(headerLength), boxEnd); err != nil {
+			return err
+		}
+		i = boxEnd
+	}
+	return nil
+}
+
+// UUID of the XMP metadata box
+var mp4XMPUUID = []byte("\xBE\x7A\xCF\xCB\x97\xA9\x42\xE8\x9C\x71\x99\x94\x91\xE3\xAF\xAC")
+
+// Function that validates an MP4 file of size bytes and returns its duration (0 if it's not declared). User data
+// (location included) and metadata boxes are turned into free space
+func processMP4(f mediaFile, size int64) (time.Duration, error) {
+	// Replaces a box with a "free" box of the same size
+	blank := func(box int64, payload int64, boxEnd int64) error {
+		if _, err := f.WriteAt([]byte("free"), box+4); err != nil {
+			return err
+		}
+		return zeroMediaRange(f, payload, boxEnd)
+	}
+
+	var duration time.Duration
+	foundMovie := false
+	err := walkMP4Boxes(f, 0, size, func(typ string, box int64, payload int64, boxEnd int64) error {
+		switch typ {
+		case "udta", "meta":
+			return blank(box, payload, boxEnd)
+		case "uuid":
+			if boxEnd-payload < 16 {
+				return nil
+			}
+			uuid, err := readMediaAt(f, payload, 16)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(uuid, mp4XMPUUID) {
+				return blank(box, payload, boxEnd)
+			}
+		case "moov":
+			foundMovie = true
+			var err error
+			duration, err = processMP4Movie(f, payload, boxEnd, blank)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !foundMovie {
+		return 0, errMediaFormat
+	}
+	return duration, nil
+}
+
+// Function that processes the movie box of an MP4 file (see processMP4)
+func processMP4Movie(f io.ReaderAt, start int64, end int64, blank func(box int64, payload int64, boxEnd int64) error) (time.Duration, error) {
+	// Reads the beginning of the payload of a full box: version (1 byte) and flags (3 bytes), then the fields
+	fullBox := func(payload int64, boxEnd int64, max int64) ([]byte, error) {
+		if boxEnd-payload < max {
+			max = boxEnd - payload
+		}
+		return readMediaAt(f, payload, int(max))
+	}
+
+	var timescale, duration, fragmentDuration uint64
+	err := walkMP4Boxes(f, start, end, func(typ string, box int64, payload int64, boxEnd int64) error {
+		switch typ {
+		case "udta", "meta":
+			return blank(box, payload, boxEnd)
+		case "trak":
+			return walkMP4Boxes(f, payload, boxEnd, func(typ string, box int64, payload int64, boxEnd int64) error {
+				if typ == "udta" || typ == "meta" {
+					return blank(box, payload, boxEnd)
+				}
+				return nil
+			})
+		case "mvhd":
+			// The times are 32 bits (version 0) or 64 bits (version 1)
+			p, err := fullBox(payload, boxEnd, 32)
+			if err != nil {
+				return err
+			}
+			if len(p) >= 20 && p[0] == 0 {
+				timescale = uint64(binary.BigEndian.Uint32(p[12:]))
+				duration = uint64(binary.BigEndian.Uint32(p[16:]))
+			} else if len(p) >= 32 && p[0] == 1 {
+				timescale = uint64(binary.BigEndian.Uint32(p[20:]))
+				duration = binary.BigEndian.Uint64(p[24:])
+			} else {
+				return errMediaFormat
+			}
+		case "mvex":
+			// Fragmented files declare their duration in the movie extends header
+			return walkMP4Boxes(f, payload, boxEnd, func(typ string, box int64, payload int64, boxEnd int64) error {
+				if typ != "mehd" {
+					return nil
+				}
+				p, err := fullBox(payload, boxEnd, 12)
+				if err != nil {
+					return err
+				}
+				if len(p) >= 8 && p[0] == 0 {
+					fragmentDuration = uint64(binary.BigEndian.Uint32(p[4:]))
+				} else if len(p) >= 12 && p[0] == 1 {
+					fragmentDuration = binary.BigEndian.Uint64(p[4:])
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if timescale == 0 {
+		return 0, errMediaFormat
+	}
+	if duration == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		duration = fragmentDuration
+	}
+	return mediaDuration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// Function that converts a duration in nanoseconds, saturating the values too large for a time.Duration
+func mediaDuration(ns float64) time.Duration {
+	if ns >= math.MaxInt64 || math.IsNaN(ns) {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
+
+// EBML (the container format of WebM) element ids
+const (
+	ebmlIdHeader        = 0x1A45DFA3
+	ebmlIdDocType       = 0x4282
+	ebmlIdSegment       = 0x18538067
+	ebmlIdInfo          = 0x1549A966
+	ebmlIdTimecodeScale = 0x2AD7B1
+	ebmlIdDuration      = 0x4489
+	ebmlIdTags          = 0x1254C367
+	ebmlIdVoid          = 0xEC
+)
+
+// Function that reads an EBML variable size integer at offset off: an element id (with its length marker) or an
+// element size (without it). Returns the value, its length and whether the size is unknown (all the value bits set)
+func ebmlVint(f io.ReaderAt, off int64, end int64, id bool) (uint64, int, bool, error) {
+	if off >= end {
+		return 0, 0, false, errMediaFormat
+	}
+	first, err := readMediaAt(f, off, 1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if first[0] == 0 {
+		return 0, 0, false, errMediaFormat
+	}
+	length := 1
+	for mask := byte(0x80); first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if off+int64(length) > end {
+		return 0, 0, false, errMediaFormat
+	}
+	data, err := readMediaAt(f, off, length)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	value := uint64(data[0])
+	if !id {
+		value &= uint64(0xFF >> length)
+	}
+	for _, b := range data[1:] {
+		value = value<<8 | uint64(b)
+	}
+	unknown := !id && value == 1<<(7*length)-1
+	return value, length, unknown, nil
+}
+
+// Function that walks the EBML elements between start and end, calling fn with the id, the offset of the element and
+// the offsets of its data. An element of unknown size extends to end, and is the last one walked
+func walkEBML(f io.ReaderAt, start int64, end int64, fn func(id uint64, element int64, payload int64, elementEnd int64) error) error {
+	for i := start; i < end; {
+		id, idLength, _, err := ebmlVint(f, i, end, true)
+		if err != nil {
+			return err
+		}
+		size, sizeLength, unknown, err := ebmlVint(f, i+int64(idLength), end, false)
+		if err != nil {
+			return err
+		}
+		payload := i + int64(idLength+sizeLength)
+		elementEnd := end
+		if !unknown {
+			if size > uint64(end-payload) {
+				return errMediaFormat
+			}
+			elementEnd = payload + int64(size)
+		}
+		if err := fn(id, i, payload, elementEnd); err != nil {
+			return err
+		}
+		i = elementEnd
+	}
+	return nil
+}
+
+// Function that returns the document type declared in the EBML header at the beginning of data ("webm" for WebM
+// files), or an empty string
+func webmDocType(data []byte) string {
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != ebmlIdHeader {
+		return ""
+	}
+	f := bytes.NewReader(data)
+	var docType string
+	_ = walkEBML(f, 0, int64(len(data)), func(id uint64, _ int64, payload int64, end int64) error {
+		if id == ebmlIdHeader {
+			_ = walkEBML(f, payload, end, func(id uint64, _ int64, payload int64, end int64) error {
+				if id == ebmlIdDocType {
+					docType = string(bytes.TrimRight(data[payload:end], "\x00"))
+				}
+				return nil
+			})
+		}
+		// Only the header is needed
+		return errMediaFormat
+	})
+	return docType
+}
+
+// Function that validates a WebM file of size bytes and returns its duration (0 if it's not declared). The tags are
+// turned into void elements
+func processWebM(f mediaFile, size int64) (time.Duration, error) {
+	timecodeScale := uint64(1000000)
+	var duration float64
+	foundSegment := false
+	err := walkEBML(f, 0, size, func(id uint64, _ int64, payload int64, end int64) error {
+		if id != ebmlIdSegment {
+			return nil
+		}
+		foundSegment = true
+		return walkEBML(f, payload, end, func(id uint64, element int64, payload int64, end int64) error {
+			switch id {
+			case ebmlIdInfo:
+				return walkEBML(f, payload, end, func(id uint64, _ int64, payload int64, end int64) error {
+					if (id != ebmlIdTimecodeScale && id != ebmlIdDuration) || end-payload > 8 {
+						return nil
+					}
+					p, err := readMediaAt(f, payload, int(end-payload))
+					if err != nil {
+						return err
+					}
+					switch {
+					case id == ebmlIdTimecodeScale && len(p) >= 1:
+						timecodeScale = 0
+						for _, b := range p {
+							timecodeScale = timecodeScale<<8 | uint64(b)
+						}
+					case id == ebmlIdDuration && len(p) == 4:
+						duration = float64(math.Float32frombits(binary.BigEndian.Uint32(p)))
+					case id == ebmlIdDuration && len(p) == 8:
+						duration = math.Float64frombits(binary.BigEndian.Uint64(p))
+					}
+					return nil
+				})
+			case ebmlIdTags:
+				return voidEBMLElement(f, element, payload, end)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !foundSegment || duration < 0 {
+		return 0, errMediaFormat
+	}
+	return mediaDuration(duration * float64(timecodeScale)), nil
+}
+
+// Function that replaces an element with a void element of the same length. The id of the void element is shorter, so
+// the size is written with more bytes; elements whose size can't be widened enough are left as they are
+func voidEBMLElement(f io.WriterAt, element int64, payload int64, end int64) error {
+	sizeLength := int(payload - element - 1)
+	if sizeLength < 1 || sizeLength > 8 || uint64(end-payload) >= 1<<(7*sizeLength)-1 {
+		return nil
+	}
+	header := make([]byte, 1+sizeLength)
+	header[0] = ebmlIdVoid
+	size := uint64(end-payload) | 1<<(7*sizeLength)
+	for i := sizeLength; i >= 1; i-- {
+		header[i] = byte(size)
+		size >>= 8
+	}
+	if _, err := f.WriteAt(header, element); err != nil {
+		return err
+	}
+	return zeroMediaRange(f, payload, end)
+}
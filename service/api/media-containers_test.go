@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// memFile is an in-memory mediaFile
+type memFile []byte
+
+func (f memFile) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(f).ReadAt(p, off)
+}
+
+func (f memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(f)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(f[off:], p), nil
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// Returns an MP4 box with a 32 bits size
+func mp4Box(typ string, payload ...[]byte) []byte {
+	data := concat(payload...)
+	box := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(box, uint32(8+len(data)))
+	copy(box[4:], typ)
+	return append(box, data...)
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// Returns a movie header box of version 0 (32 bits times) or 1 (64 bits times)
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	if version == 0 {
+		return mp4Box("mvhd", []byte{0, 0, 0, 0}, u32(0), u32(0), u32(timescale), u32(uint32(duration)), make([]byte, 80))
+	}
+	return mp4Box("mvhd", []byte{1, 0, 0, 0}, u64(0), u64(0), u32(timescale), u64(duration), make([]byte, 80))
+}
+
+var mp4FileType = mp4Box("ftyp", []byte("isom"), u32(0x200), []byte("isomiso2avc1mp41"))
+
+func TestIsMP4(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"major brand", mp4FileType, true},
+		{"compatible brand", mp4Box("ftyp", []byte("XAVC"), u32(0), []byte("XAVCmp42")), true},
+		{"quicktime", mp4Box("ftyp", []byte("qt  "), u32(0), []byte("isom")), false},
+		{"unknown brands", mp4Box("ftyp", []byte("3gp4"), u32(0), []byte("3gp4")), false},
+		{"size beyond the data", mp4FileType[:20], false},
+		{"not a file type box", mp4Box("moov", make([]byte, 16)), false},
+	}
+	for _, tt := range tests {
+		if got := isMP4(tt.data); got != tt.want {
+			t.Errorf("%s: isMP4 = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcessMP4(t *testing.T) {
+	secret := []byte("GPS 45.4642N 9.1900E")
+	largeMediaData := concat(u32(1), []byte("mdat"), u64(16+4), []byte("data"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		err      error
+	}{
+		{
+			name:     "version 0 header",
+			data:     concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 12500)), mp4Box("mdat", []byte("data"))),
+			duration: 12500 * time.Millisecond,
+		},
+		{
+			name:     "version 1 header",
+			data:     concat(mp4FileType, mp4Box("moov", mvhd(1, 90000, 90000*75))),
+			duration: 75 * time.Second,
+		},
+		{
+			name: "fragmented file",
+			data: concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 0),
+				mp4Box("mvex", mp4Box("mehd", []byte{0, 0, 0, 0}, u32(30000))))),
+			duration: 30 * time.Second,
+		},
+		{
+			name: "fragmented file with 64 bits duration",
+			data: concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, math.MaxUint32),
+				mp4Box("mvex", mp4Box("mehd", []byte{1, 0, 0, 0}, u64(4000))))),
+			duration: 4 * time.Second,
+		},
+		{
+			name: "duration not declared",
+			data: concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 0))),
+		},
+		{
+			name:     "media data extending to the end",
+			data:     concat(mp4FileType, mp4Box("moov", mvhd(0, 1, 3)), u32(0), []byte("mdat"), []byte("data")),
+			duration: 3 * time.Second,
+		},
+		{
+			name:     "media data with a 64 bits size",
+			data:     concat(mp4FileType, mp4Box("moov", mvhd(0, 1, 3)), largeMediaData),
+			duration: 3 * time.Second,
+		},
+		{
+			name: "saturated duration",
+			data: concat(mp4FileType, mp4Box("moov", mvhd(1, 1, math.MaxUint64-1))),
+			// The duration is too long to be represented
+			duration: math.MaxInt64,
+		},
+		{name: "missing movie", data: concat(mp4FileType, mp4Box("mdat", []byte("data"))), err: errMediaFormat},
+		{name: "missing timescale", data: concat(mp4FileType, mp4Box("moov", mvhd(0, 0, 10))), err: errMediaFormat},
+		{name: "truncated header", data: concat(mp4FileType, mp4Box("moov", mp4Box("mvhd", []byte{0, 0, 0, 0}))), err: errMediaFormat},
+		{name: "box beyond the end", data: concat(mp4FileType, mp4Box("moov", mvhd(0, 1, 1)))[:60], err: errMediaFormat},
+		{name: "box smaller than its header", data: concat(mp4FileType, u32(4), []byte("free")), err: errMediaFormat},
+		{name: "trailing bytes", data: concat(mp4FileType, mp4Box("moov", mvhd(0, 1, 1)), []byte{0, 0}), err: errMediaFormat},
+		{name: "truncated large size", data: concat(mp4FileType, largeMediaData[:12]), err: errMediaFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := processMP4(memFile(tt.data), int64(len(tt.data)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("processMP4 error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processMP4 error = %v", err)
+			}
+			if duration != tt.duration {
+				t.Errorf("processMP4 duration = %v, want %v", duration, tt.duration)
+			}
+		})
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		userData := mp4Box("udta", mp4Box("\xA9xyz", secret))
+		data := concat(
+			mp4FileType,
+			mp4Box("moov",
+				mvhd(0, 1000, 1000),
+				mp4Box("trak", mp4Box("tkhd", make([]byte, 84)), mp4Box("meta", []byte{0, 0, 0, 0}, secret)),
+				userData),
+			mp4Box("uuid", mp4XMPUUID, secret),
+			mp4Box("uuid", bytes.Repeat([]byte{1}, 16), []byte("kept")),
+			mp4Box("meta", []byte{0, 0, 0, 0}, secret),
+			mp4Box("mdat", []byte("data")))
+		f := memFile(append([]byte(nil), data...))
+
+		if _, err := processMP4(f, int64(len(f))); err != nil {
+			t.Fatalf("processMP4 error = %v", err)
+		}
+		if bytes.Contains(f, secret) {
+			t.Error("metadata still in the file")
+		}
+		for _, kept := range [][]byte{mp4FileType, []byte("kept"), mp4Box("mdat", []byte("data")), mp4Box("tkhd", make([]byte, 84))} {
+			if !bytes.Contains(f, kept) {
+				t.Errorf("%q removed from the file", kept)
+			}
+		}
+		if n := bytes.Count(f, []byte("free")); n != 4 {
+			t.Errorf("%d free boxes, want 4", n)
+		}
+		// The metadata boxes keep their size, so the file still walks
+		if _, err := processMP4(f, int64(len(f))); err != nil {
+			t.Errorf("processMP4 of the processed file error = %v", err)
+		}
+	})
+}
+
+// Returns an EBML element with the given id (its encoded bytes) and a size written on 2 bytes
+func ebmlElement(id uint32, payload ...[]byte) []byte {
+	data := concat(payload...)
+	idBytes := bytes.TrimLeft(u32(id), "\x00")
+	size := []byte{0x40 | byte(len(data)>>8), byte(len(data))}
+	return concat(idBytes, size, data)
+}
+
+// Returns an EBML element of unknown size
+func ebmlUnknownSize(id uint32, payload ...[]byte) []byte {
+	return concat(bytes.TrimLeft(u32(id), "\x00"), []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, concat(payload...))
+}
+
+func webmHeader(docType string) []byte {
+	return ebmlElement(ebmlIdHeader, ebmlElement(0x4286, []byte{1}), ebmlElement(ebmlIdDocType, []byte(docType)))
+}
+
+func webmInfo(timecodeScale []byte, duration []byte) []byte {
+	var payload [][]byte
+	if timecodeScale != nil {
+		payload = append(payload, ebmlElement(ebmlIdTimecodeScale, timecodeScale))
+	}
+	if duration != nil {
+		payload = append(payload, ebmlElement(ebmlIdDuration, duration))
+	}
+	return ebmlElement(ebmlIdInfo, payload...)
+}
+
+func float64Bytes(v float64) []byte {
+	return u64(math.Float64bits(v))
+}
+
+func TestWebMDocType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"webm", webmHeader("webm"), "webm"},
+		{"matroska", webmHeader("matroska"), "matroska"},
+		{"padded", webmHeader("webm\x00\x00"), "webm"},
+		{"followed by the segment", concat(webmHeader("webm"), ebmlUnknownSize(ebmlIdSegment)), "webm"},
+		{"truncated", webmHeader("webm")[:8], ""},
+		{"not ebml", mp4FileType, ""},
+	}
+	for _, tt := range tests {
+		if got := webmDocType(tt.data); got != tt.want {
+			t.Errorf("%s: webmDocType = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEBMLVint(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		id      bool
+		value   uint64
+		length  int
+		unknown bool
+		err     bool
+	}{
+		{name: "one byte size", data: []byte{0x81}, value: 1, length: 1},
+		{name: "two bytes size", data: []byte{0x40, 0x02}, value: 2, length: 2},
+		{name: "unknown size", data: []byte{0xFF}, value: 0x7F, length: 1, unknown: true},
+		{name: "four bytes id", data: []byte{0x1A, 0x45, 0xDF, 0xA3}, id: true, value: ebmlIdHeader, length: 4},
+		{name: "id with all value bits set", data: []byte{0xFF}, id: true, value: 0xFF, length: 1},
+		{name: "invalid first byte", data: []byte{0x00, 0x01}, err: true},
+		{name: "truncated", data: []byte{0x20, 0x01}, err: true},
+	}
+	for _, tt := range tests {
+		value, length, unknown, err := ebmlVint(bytes.NewReader(tt.data), 0, int64(len(tt.data)), tt.id)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: ebmlVint succeeded", tt.name)
+			}
+			continue
+		}
+		if err != nil || value != tt.value || length != tt.length || unknown != tt.unknown {
+			t.Errorf("%s: ebmlVint = %#x, %d, %v, %v, want %#x, %d, %v", tt.name, value, length, unknown, err,
+				tt.value, tt.length, tt.unknown)
+		}
+	}
+}
+
+func TestProcessWebM(t *testing.T) {
+	header := webmHeader("webm")
+	cluster := ebmlElement(0x1F43B675, []byte("frames"))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		err      error
+	}{
+		{
+			name:     "float64 duration",
+			data:     concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, float64Bytes(1500)), cluster)),
+			duration: 1500 * time.Millisecond,
+		},
+		{
+			name:     "float32 duration",
+			data:     concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, u32(math.Float32bits(250))), cluster)),
+			duration: 250 * time.Millisecond,
+		},
+		{
+			name:     "custom timecode scale",
+			data:     concat(header, ebmlElement(ebmlIdSegment, webmInfo([]byte{0x03, 0xE8}, float64Bytes(2e6)))),
+			duration: 2 * time.Second,
+		},
+		{
+			name: "duration not declared",
+			data: concat(header, ebmlElement(ebmlIdSegment, webmInfo([]byte{0x0F, 0x42, 0x40}, nil), cluster)),
+		},
+		{
+			name:     "segment of unknown size",
+			data:     concat(header, ebmlUnknownSize(ebmlIdSegment, webmInfo(nil, float64Bytes(42000)), cluster)),
+			duration: 42 * time.Second,
+		},
+		{name: "missing segment", data: header, err: errMediaFormat},
+		{name: "negative duration", data: concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, float64Bytes(-1)))), err: errMediaFormat},
+		{name: "element beyond the end", data: concat(header, ebmlElement(ebmlIdSegment, cluster))[:len(header)+6], err: errMediaFormat},
+		{name: "invalid element id", data: concat(header, []byte{0x00, 0x81, 0x00}), err: errMediaFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, err := processWebM(memFile(tt.data), int64(len(tt.data)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("processWebM error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processWebM error = %v", err)
+			}
+			if duration != tt.duration {
+				t.Errorf("processWebM duration = %v, want %v", duration, tt.duration)
+			}
+		})
+	}
+
+	t.Run("tags", func(t *testing.T) {
+		secret := []byte("recorded at 45.4642N 9.1900E")
+		tags := ebmlElement(ebmlIdTags, ebmlElement(0x7373, ebmlElement(0x67C8, ebmlElement(0x4487, secret))))
+		data := concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, float64Bytes(1000)), tags, cluster))
+		f := memFile(append([]byte(nil), data...))
+
+		if _, err := processWebM(f, int64(len(f))); err != nil {
+			t.Fatalf("processWebM error = %v", err)
+		}
+		if bytes.Contains(f, secret) {
+			t.Error("tags still in the file")
+		}
+		if !bytes.Contains(f, cluster) || !bytes.HasPrefix(f, header) {
+			t.Error("media data changed")
+		}
+		// The tags are now a void element of the same length: its 1 byte id leaves 5 bytes to the size
+		start := bytes.Index(data, tags)
+		void := []byte(f[start : start+6])
+		if void[0] != ebmlIdVoid || void[1] != 0x08 || int(binary.BigEndian.Uint32(void[2:])) != len(tags)-6 {
+			t.Errorf("void element header = % x", void)
+		}
+		duration, err := processWebM(f, int64(len(f)))
+		if err != nil || duration != time.Second {
+			t.Errorf("processWebM of the processed file = %v, %v", duration, err)
+		}
+	})
+}
+
+func TestProcessVideoDuration(t *testing.T) {
+	header := webmHeader("webm")
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+		err    error
+	}{
+		{"mp4", formatMP4, concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 9000))), nil},
+		{"long mp4", formatMP4, concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 11000))), errMediaTooLong},
+		{"mp4 without duration", formatMP4, concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 0))), errMediaDuration},
+		{"webm", formatWebM, concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, float64Bytes(9000)))), nil},
+		{"long webm", formatWebM, concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, float64Bytes(11000)))), errMediaTooLong},
+		{"webm without duration", formatWebM, concat(header, ebmlElement(ebmlIdSegment, webmInfo(nil, nil))), errMediaDuration},
+		{"malformed webm", formatWebM, header, errMediaFormat},
+	}
+	limits := mediaLimits{maxDuration: 10 * time.Second}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.CreateTemp(t.TempDir(), "upload-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = file.Close() }()
+			if _, err := file.Write(tt.data); err != nil {
+				t.Fatal(err)
+			}
+
+			// Without ffmpeg the videos get the placeholder poster
+			got, err := limits.processVideo(context.Background(), &upload{file: file, size: int64(len(tt.data)), format: tt.format}, logger)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("processVideo error = %v, want %v", err, tt.err)
+			}
+			if err == nil && len(got.renditions[photoPosterName]) == 0 {
+				t.Error("processVideo returned no poster")
+			}
+		})
+	}
+}
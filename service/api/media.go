@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/mediastore"
+	"path"
+	"strings"
+	"time"
+)
+
+// Function that returns the media key of a file (the original or a rendition) of a user's photo
+func userPhotoKey(userID string, name string) string {
+	return path.Join(userID, "photos", name)
+}
+
+// Function that generates the key of a new version of a replaceable file (profile and group photos), e.g.
+// "<dir>/avatar-<random>.png". Every version has a different key, so that the new file can be saved before the
+// database points to it and the previous one is removed only after
+func newMediaVersionKey(dir string, name string, ext string) (string, error) {
+	suffix, err := randomIdentifier16()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, name+"-"+suffix+"."+ext), nil
+}
+
+// mediaErrors are the errors of several operations on the media store
+type mediaErrors []error
+
+func (e mediaErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Returns the errors as an error, or nil if there are none
+func (e mediaErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Function that removes a media file no longer referenced by the database. Failures are only logged: the file is
+// then removed by the media garbage collector (cmd/mediagc)
+func (rt *_router) removeMedia(key string, ctx reqcontext.RequestContext) {
+	// The removal must happen even if the request was canceled
+	if err := rt.media.Delete(context.Background(), key); err != nil {
+		ctx.Logger.WithError(err).Warning("media: error removing " + key)
+	}
+}
+
+// Function that checks if a media file exists
+func (rt *_router) mediaExists(ctx context.Context, key string) (bool, error) {
+	obj, err := rt.media.Open(ctx, key)
+	if errors.Is(err, mediastore.ErrNotFound) || errors.Is(err, mediastore.ErrInvalidKey) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, obj.Close()
+}
+
+// Function that serves a media file, answering conditional and range requests, within timeout
+func (rt *_router) serveMedia(w http.ResponseWriter, r *http.Request, key string, timeout time.Duration, ctx reqcontext.RequestContext) {
+	obj, err := rt.media.Open(r.Context(), key)
+	rt.serveMediaObject(w, r, path.Base(key), obj, err, timeout, ctx)
+}
+
+// Function that serves a media file opened by the caller (err is the error returned by Open), and closes it. Range
+// requests are answered too, so that videos can be seeked. The file must be sent within timeout, in place of the write
+// timeout of the server
+func (rt *_router) serveMediaObject(w http.ResponseWriter, r *http.Request, name string, obj mediastore.Object, err error, timeout time.Duration, ctx reqcontext.RequestContext) {
+	if errors.Is(err, mediastore.ErrNotFound) || errors.Is(err, mediastore.ErrInvalidKey) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("media: error opening " + name)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = obj.Close() }()
+
+	// The file names have no extension, and the content sniffing of ServeContent misses some MP4 brands
+	if w.Header().Get("Content-Type") == "" {
+		head := make([]byte, 512)
+		n, err := io.ReadFull(obj, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			ctx.Logger.WithError(err).Error("media: error reading " + name)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		contentType := mediaContentType(sniffMediaFormat(head[:n]))
+		if contentType == "" {
+			contentType = http.DetectContentType(head[:n])
+		}
+		w.Header().Set("Content-Type", contentType)
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			ctx.Logger.WithError(err).Error("media: error reading " + name)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	extendDeadlines(r, timeout)
+	http.ServeContent(w, r, name, obj.ModTime(), obj)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// getMessagePrivacy returns who can start a direct conversation with the user
+func (rt *_router) getMessagePrivacy(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	messagesFrom, err := rt.db.GetMessagesFrom(database.User{IdUser: requester})
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("getMessagePrivacy: db.GetMessagesFrom error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(MessagePrivacy{MessagesFrom: messagesFrom})
+}
+
+// putMessagePrivacy sets who can start a direct conversation with the user. The existing contacts can always message
+func (rt *_router) putMessagePrivacy(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	var privacy MessagePrivacy
+	if err := json.NewDecoder(r.Body).Decode(&privacy); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	switch privacy.MessagesFrom {
+	case database.MessagesFromEveryone, database.MessagesFromFollowing, database.MessagesFromNobody:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_MESSAGES_FROM_ERROR_MSG})
+		return
+	}
+
+	if err := rt.db.SetMessagesFrom(database.User{IdUser: requester}, privacy.MessagesFrom); err != nil {
+		ctx.Logger.WithError(err).Error("putMessagePrivacy: db.SetMessagesFrom error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(privacy)
+}
+
+// listMessageRequests returns the conversations started by strangers that the user didn't accept yet
+func (rt *_router) listMessageRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	requests, err := rt.db.ListMessageRequests(database.User{IdUser: requester})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("listMessageRequests: db.ListMessageRequests error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Wrap in an object to avoid top-level array responses (OpenAPI lint requirement).
+	type messageRequestsResponse struct {
+		Requests []database.MessageRequest `json:"requests"`
+	}
+	if err := json.NewEncoder(w).Encode(messageRequestsResponse{Requests: requests}); err != nil {
+		ctx.Logger.WithError(err).Error("listMessageRequests: failed to encode requests json")
+	}
+}
+
+// acceptMessageRequest moves the conversation with peer to the user's chats: from now on they're contacts
+func (rt *_router) acceptMessageRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	err := rt.db.AcceptMessageRequest(database.User{IdUser: requester}, database.User{IdUser: ps.ByName("peer")})
+	if errors.Is(err, database.ErrMessageRequestNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("acceptMessageRequest: db.AcceptMessageRequest error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteMessageRequest deletes the message request of peer together with its messages
+func (rt *_router) deleteMessageRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	err := rt.db.DeleteMessageRequest(database.User{IdUser: requester}, database.User{IdUser: ps.ByName("peer")})
+	if errors.Is(err, database.ErrMessageRequestNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("deleteMessageRequest: db.DeleteMessageRequest error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
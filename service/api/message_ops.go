@@ -77,6 +77,9 @@ func (rt *_router) deleteMessage(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	// direct chat message
+	if rt.bannedPeer(w, ctx, requester, peer, "deleteMessage") {
+		return
+	}
 	if _, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID); err != nil {
 		if errors.Is(err, database.ErrMessageNotFound) {
 			w.WriteHeader(http.StatusNotFound)
@@ -126,8 +129,10 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 	rb.Reaction = strings.TrimSpace(rb.Reaction)
-	if rb.Reaction == "" || len(rb.Reaction) > 16 {
+	if !validReaction(rb.Reaction) {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_REACTION_ERROR_MSG})
 		return
 	}
 
@@ -142,7 +147,8 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
-		if _, err := rt.db.GetGroupMessageInGroup(groupID, messageID); err != nil {
+		gm, err := rt.db.GetGroupMessageInGroup(groupID, messageID)
+		if err != nil {
 			if errors.Is(err, database.ErrMessageNotFound) {
 				w.WriteHeader(http.StatusNotFound)
 				return
@@ -150,8 +156,16 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if err := rt.db.SetGroupMessageReaction(groupID, messageID, database.User{IdUser: requester}, rb.Reaction); err != nil {
-			ctx.Logger.WithError(err).Error("commentMessage: db.SetGroupMessageReaction error")
+		// Users can't react to the messages of the users they banned, or that banned them
+		if rt.bannedPeer(w, ctx, requester, gm.Sender, "commentMessage") {
+			return
+		}
+		setReaction := rt.db.SetGroupMessageReaction
+		if rt.multipleReactions {
+			setReaction = rt.db.AddGroupMessageReaction
+		}
+		if err := setReaction(groupID, messageID, database.User{IdUser: requester}, rb.Reaction); err != nil {
+			ctx.Logger.WithError(err).Error("commentMessage: db group reaction error")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -159,6 +173,9 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
+	if rt.bannedPeer(w, ctx, requester, peer, "commentMessage") {
+		return
+	}
 	if _, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID); err != nil {
 		if errors.Is(err, database.ErrMessageNotFound) {
 			w.WriteHeader(http.StatusNotFound)
@@ -167,8 +184,12 @@ func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps htt
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if err := rt.db.SetDirectMessageReaction(messageID, database.User{IdUser: requester}, rb.Reaction); err != nil {
-		ctx.Logger.WithError(err).Error("commentMessage: db.SetDirectMessageReaction error")
+	setReaction := rt.db.SetDirectMessageReaction
+	if rt.multipleReactions {
+		setReaction = rt.db.AddDirectMessageReaction
+	}
+	if err := setReaction(messageID, database.User{IdUser: requester}, rb.Reaction); err != nil {
+		ctx.Logger.WithError(err).Error("commentMessage: db direct reaction error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -188,6 +209,15 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
+	// Without the reaction query parameter every reaction of the requester is removed
+	reaction := strings.TrimSpace(r.URL.Query().Get("reaction"))
+	if reaction != "" && !validReaction(reaction) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_REACTION_ERROR_MSG})
+		return
+	}
+
 	peer := ps.ByName("peer")
 	if groupID, ok := parseGroupPeer(peer); ok {
 		inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
@@ -207,7 +237,7 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if err := rt.db.RemoveGroupMessageReaction(groupID, messageID, database.User{IdUser: requester}); err != nil {
+		if err := rt.db.RemoveGroupMessageReaction(groupID, messageID, database.User{IdUser: requester}, reaction); err != nil {
 			ctx.Logger.WithError(err).Error("uncommentMessage: db.RemoveGroupMessageReaction error")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -216,6 +246,9 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 		return
 	}
 
+	if rt.bannedPeer(w, ctx, requester, peer, "uncommentMessage") {
+		return
+	}
 	if _, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID); err != nil {
 		if errors.Is(err, database.ErrMessageNotFound) {
 			w.WriteHeader(http.StatusNotFound)
@@ -224,7 +257,7 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if err := rt.db.RemoveDirectMessageReaction(messageID, database.User{IdUser: requester}); err != nil {
+	if err := rt.db.RemoveDirectMessageReaction(messageID, database.User{IdUser: requester}, reaction); err != nil {
 		ctx.Logger.WithError(err).Error("uncommentMessage: db.RemoveDirectMessageReaction error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -232,7 +265,82 @@ func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps h
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// listMessageReactions returns who reacted to a message (optionally only with the given reaction)
+func (rt *_router) listMessageReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	messageID, err := strconv.ParseInt(ps.ByName("message_id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter := strings.TrimSpace(r.URL.Query().Get("reaction"))
+
+	var reactions []database.MessageReaction
+	peer := ps.ByName("peer")
+	if groupID, ok := parseGroupPeer(peer); ok {
+		inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !inGroup {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		reactions, err = rt.db.ListGroupMessageReactions(groupID, messageID)
+		if err != nil {
+			if errors.Is(err, database.ErrMessageNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			ctx.Logger.WithError(err).Error("listMessageReactions: db.ListGroupMessageReactions error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		if rt.bannedPeer(w, ctx, requester, peer, "listMessageReactions") {
+			return
+		}
+		if _, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID); err != nil {
+			if errors.Is(err, database.ErrMessageNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		reactions, err = rt.db.ListDirectMessageReactions(messageID)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("listMessageReactions: db.ListDirectMessageReactions error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filtered := make([]database.MessageReaction, 0, len(reactions))
+	for _, mr := range reactions {
+		if filter == "" || mr.Reaction == filter {
+			filtered = append(filtered, mr)
+		}
+	}
+
+	// Wrap in an object to avoid top-level array responses (OpenAPI lint requirement).
+	type reactionsResponse struct {
+		Reactions []database.MessageReaction `json:"reactions"`
+	}
+	if err := json.NewEncoder(w).Encode(reactionsResponse{Reactions: filtered}); err != nil {
+		ctx.Logger.WithError(err).Error("listMessageReactions: failed to encode reactions json")
+	}
+}
+
 func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
 	requester := extractBearer(r.Header.Get("Authorization"))
 	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
 		w.WriteHeader(status)
@@ -284,6 +392,9 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 		}
 		body = gm.Body
 	} else {
+		if rt.bannedPeer(w, ctx, requester, peer, "forwardMessage") {
+			return
+		}
 		m, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID)
 		if err != nil {
 			if errors.Is(err, database.ErrMessageNotFound) {
@@ -312,6 +423,7 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		rt.requestLinkPreview(body)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -321,18 +433,14 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	banned, err := rt.db.BannedUserCheck(database.User{IdUser: requester}, database.User{IdUser: fr.To})
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if banned {
-		w.WriteHeader(http.StatusForbidden)
+	request, ok := rt.sendDirectMessage(w, ctx, requester, fr.To, body, "forwardMessage")
+	if !ok {
 		return
 	}
-	if _, err := rt.db.CreateMessage(database.User{IdUser: requester}, database.User{IdUser: fr.To}, body); err != nil {
-		ctx.Logger.WithError(err).Error("forwardMessage: db.CreateMessage error")
-		w.WriteHeader(http.StatusInternalServerError)
+	rt.requestLinkPreview(body)
+	if request {
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(MessageStatus{Status: database.DirectMessageRequest})
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// reportsPage is a page of the moderation queue
+type reportsPage struct {
+	Reports    []database.Report `json:"reports"`
+	NextCursor string            `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// moderationLogPage is a page of the moderation log
+type moderationLogPage struct {
+	Actions    []database.ModerationAction `json:"actions"`
+	NextCursor string                      `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// moderator checks that the requesting user is a moderator and returns his/her identifier. It replies with the error
+// and returns false otherwise
+func (rt *_router) moderator(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, where string) (string, bool) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+
+	moderator, err := rt.db.IsModerator(database.User{IdUser: requester})
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.IsModerator error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return "", false
+	}
+	if !moderator {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: NOT_MODERATOR_ERROR_MSG})
+		return "", false
+	}
+	return requester, true
+}
+
+// listReports returns a page of the moderation queue: the reports with a status (open by default), oldest first,
+// optionally of a single target type
+func (rt *_router) listReports(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := rt.moderator(w, r, ctx, "listReports"); !ok {
+		return
+	}
+
+	// The cursor is the identifier of the last report of the previous page
+	afterId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = database.ReportOpen
+	case database.ReportOpen, database.ReportDismissed, database.ReportActioned:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	targetType := r.URL.Query().Get("type")
+	switch targetType {
+	case "", database.ReportPhoto, database.ReportComment, database.ReportDirectMessage, database.ReportGroupMessage,
+		database.ReportUser:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// One extra report is loaded to know if there's a next page
+	reports, err := rt.db.ListReports(status, targetType, afterId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("listReports: db.ListReports error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := reportsPage{Reports: reports}
+	if len(reports) > limit {
+		page.Reports = reports[:limit]
+		page.NextCursor = strconv.FormatInt(reports[limit-1].IdReport, 10)
+	}
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// getReport returns a report of the moderation queue
+func (rt *_router) getReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := rt.moderator(w, r, ctx, "getReport"); !ok {
+		return
+	}
+
+	reportId, err := strconv.ParseInt(ps.ByName("report_id"), 10, 64)
+	if err != nil || reportId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	report, err := rt.db.GetReport(reportId)
+	if errors.Is(err, database.ErrReportNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("getReport: db.GetReport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// resolveReport takes a moderation action on a report: dismiss it, remove the reported content or suspend the
+// reported user. The action resolves every open report about the same target and is recorded in the moderation log
+func (rt *_router) resolveReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	moderator, ok := rt.moderator(w, r, ctx, "resolveReport")
+	if !ok {
+		return
+	}
+
+	reportId, err := strconv.ParseInt(ps.ByName("report_id"), 10, 64)
+	if err != nil || reportId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var decision ModerationDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	note, ok := validReportNote(decision.Note)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_NOTE_ERROR_MSG})
+		return
+	}
+
+	report, items, err := rt.db.ResolveReport(database.User{IdUser: moderator}, reportId, decision.Action, note)
+	if errors.Is(err, database.ErrReportNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if errors.Is(err, database.ErrReportResolved) {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: REPORT_RESOLVED_ERROR_MSG})
+		return
+	} else if errors.Is(err, database.ErrInvalidModerationAction) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_MODERATION_ACTION_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("resolveReport: db.ResolveReport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Files of a removed photo left behind are removed by the media garbage collector (cmd/mediagc)
+	if items > 0 {
+		err = removePhotoFiles(context.Background(), rt.media, report.ReportedUser, report.TargetId, items)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("resolveReport: error removing the photo files")
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// suspendUser suspends a user without a report: a suspended user can't log in nor use the API
+func (rt *_router) suspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeSuspension(w, r, ps, ctx, true, "suspendUser")
+}
+
+// unsuspendUser reinstates a suspended user
+func (rt *_router) unsuspendUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeSuspension(w, r, ps, ctx, false, "unsuspendUser")
+}
+
+// changeSuspension suspends or reinstates the user in the path, with the optional note in the body
+func (rt *_router) changeSuspension(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	suspended bool, where string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	moderator, ok := rt.moderator(w, r, ctx, where)
+	if !ok {
+		return
+	}
+
+	target := ps.ByName("user_id")
+	if target == moderator {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var suspension Suspension
+	if err := json.NewDecoder(r.Body).Decode(&suspension); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	note, ok := validReportNote(suspension.Note)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_NOTE_ERROR_MSG})
+		return
+	}
+
+	err := rt.db.SetSuspended(database.User{IdUser: moderator}, database.User{IdUser: target}, suspended, note)
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.SetSuspended error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getModerationLog returns a page of the moderation log, newest first
+func (rt *_router) getModerationLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, ok := rt.moderator(w, r, ctx, "getModerationLog"); !ok {
+		return
+	}
+
+	// The cursor is the identifier of the last action of the previous page
+	beforeId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	actions, err := rt.db.ListModerationActions(beforeId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getModerationLog: db.ListModerationActions error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := moderationLogPage{Actions: actions}
+	if len(actions) > limit {
+		page.Actions = actions[:limit]
+		page.NextCursor = strconv.FormatInt(actions[limit-1].IdAction, 10)
+	}
+	_ = json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Function that mutes a user: his/her photos leave the home stream and the direct conversation is muted. The muted
+// user isn't told
+func (rt *_router) putMute(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeRelationship(w, r, ps, ctx, "muted_id", rt.db.MuteUser, "put-mute")
+}
+
+// Function that unmutes a user
+func (rt *_router) deleteMute(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeRelationship(w, r, ps, ctx, "muted_id", rt.db.UnmuteUser, "delete-mute")
+}
+
+// Function that retrieves the list of users muted by the user
+func (rt *_router) getMutedUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listRelationship(w, r, ps, ctx, rt.db.GetMutedUsers, "get-muted-users")
+}
+
+// Function that restricts a user: his/her new comments on the user's photos wait for the user's approval
+func (rt *_router) putRestrict(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeRelationship(w, r, ps, ctx, "restricted_id", rt.db.RestrictUser, "put-restrict")
+}
+
+// Function that unrestricts a user, approving his/her pending comments
+func (rt *_router) deleteRestrict(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.changeRelationship(w, r, ps, ctx, "restricted_id", rt.db.UnrestrictUser, "delete-restrict")
+}
+
+// Function that retrieves the list of users restricted by the user
+func (rt *_router) getRestrictedUsers(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.listRelationship(w, r, ps, ctx, rt.db.GetRestrictedUsers, "get-restricted-users")
+}
+
+// Function that adds or removes a relationship (mute, restrict) of the user in the path towards the user in the path
+// parameter target
+func (rt *_router) changeRelationship(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	target string, change func(database.User, database.User) error, where string) {
+
+	identifier := ps.ByName("id")
+	targetId := ps.ByName(target)
+
+	// Check the user's identity for the operation
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	// Users can't mute or restrict themselves
+	if targetId == identifier {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := change(User{IdUser: identifier}.ToDatabase(), User{IdUser: targetId}.ToDatabase())
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Function that retrieves the users the user in the path has a relationship (mute, restrict) with
+func (rt *_router) listRelationship(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	list func(database.User) ([]database.CompleteUser, error), where string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	identifier := ps.ByName("id")
+
+	// Only the user can see his/her lists
+	valid := validateRequestingUser(identifier, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	users, err := list(User{IdUser: identifier}.ToDatabase())
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": error executing query")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(users)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Maximum length (in characters) of a photo caption and of a caption search
+const maxCaptionLength = 1000
+const maxCaptionSearchLength = 100
+
+// Function that trims a caption and checks its length. Returns the caption and whether it's valid
+func validCaption(caption string) (string, bool) {
+	caption = strings.TrimSpace(caption)
+	return caption, utf8.ValidString(caption) && utf8.RuneCountInString(caption) <= maxCaptionLength
+}
+
+// Function that changes the caption (and so the hashtags) of a photo of the requesting user
+func (rt *_router) patchPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	auth := extractBearer(r.Header.Get("Authorization"))
+
+	// Only the owner can change the caption of a photo
+	valid := validateRequestingUser(ps.ByName("id"), auth)
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	photoId, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
+	if err != nil || photoId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Caption *string `json:"caption"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Caption == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	caption, ok := validCaption(*body.Caption)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_CAPTION_ERROR_MSG})
+		return
+	}
+
+	err = rt.db.SetPhotoCaption(User{IdUser: auth}.ToDatabase(), PhotoId{IdPhoto: photoId}.ToDatabase(), caption)
+	if errors.Is(err, database.ErrPhotoDoesntExist) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("patchPhoto: db.SetPhotoCaption error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Function that retrieves a page of the photos with a hashtag (the leading # is optional)
+func (rt *_router) getTagPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	auth := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(auth) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	tag := strings.ToLower(strings.TrimPrefix(ps.ByName("tag"), "#"))
+	if tag == "" || utf8.RuneCountInString(tag) > database.MaxTagLength || strings.ContainsAny(tag, "# \t\n") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	beforeId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	photos, err := rt.db.GetPhotosByTag(User{IdUser: auth}.ToDatabase(), tag, beforeId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getTagPhotos: db.GetPhotosByTag error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(newPhotosPage(photos, limit)); err != nil {
+		ctx.Logger.WithError(err).Error("getTagPhotos: failed to encode photos json")
+	}
+}
+
+// Function that retrieves a page of the photos whose caption contains the query parameter q
+func (rt *_router) searchPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	auth := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(auth) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxCaptionSearchLength {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	beforeId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	photos, err := rt.db.SearchPhotosByCaption(User{IdUser: auth}.ToDatabase(), q, beforeId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("searchPhotos: db.SearchPhotosByCaption error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(newPhotosPage(photos, limit)); err != nil {
+		ctx.Logger.WithError(err).Error("searchPhotos: failed to encode photos json")
+	}
+}
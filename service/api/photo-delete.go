@@ -1,10 +1,11 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"os"
-	"path/filepath"
+	"new-wasa/service/database"
 	"strconv"
 
 	"github.com/julienschmidt/httprouter"
@@ -32,23 +33,23 @@ func (rt *_router) deletePhoto(w http.ResponseWriter, r *http.Request, ps httpro
 	}
 
 	// Call to the db function to remove the photo
-	err = rt.db.RemovePhoto(
+	items, err := rt.db.RemovePhoto(
 		User{IdUser: bearerAuth}.ToDatabase(),
 		PhotoId{IdPhoto: photoInt}.ToDatabase())
-	if err != nil {
+	if errors.Is(err, database.ErrPhotoDoesntExist) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		ctx.Logger.WithError(err).Error("photo-delete/RemovePhoto: error coming from database")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Get the folder of the file that has to be eliminated
-	pathPhoto := getUserPhotoFolder(bearerAuth)
-
-	// Remove the file from the user's photos folder
-	err = os.Remove(filepath.Join(pathPhoto, photoIdStr))
+	// Remove the files of the media items and their renditions from the media store. The photo is already gone from the database, so the
+	// request doesn't fail: files left behind are removed by the media garbage collector (cmd/mediagc)
+	err = removePhotoFiles(context.Background(), rt.media, bearerAuth, strconv.FormatInt(photoInt, 10), items)
 	if err != nil {
-		// Error occurs if the file doesn't exist, but for idempotency an error won't be raised
-		ctx.Logger.WithError(err).Error("photo-delete/os.Remove: photo to be removed is missing")
+		ctx.Logger.WithError(err).Error("photo-delete/removePhotoFiles: error removing the photo files")
 	}
 
 	// Respond with 204 http status
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"new-wasa/service/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Errors of the processing of an upload
+var errMediaFormat = errors.New(MEDIA_FORMAT_ERROR_MSG)
+var errMediaTooLarge = errors.New(MEDIA_TOO_LARGE_ERROR_MSG)
+var errMediaTooLong = errors.New(MEDIA_TOO_LONG_ERROR_MSG)
+var errMediaDuration = errors.New(MEDIA_DURATION_ERROR_MSG)
+
+// Default limits of the uploads
+const (
+	defaultMaxImageSize     = 20 << 20
+	defaultMaxImagePixels   = 40000000
+	defaultMaxGIFSize       = 15 << 20
+	defaultMaxVideoSize     = 50 << 20
+	defaultMaxMediaDuration = 60 * time.Second
+	defaultMaxPostItems     = 10
+	defaultUploadTimeout    = 5 * time.Minute
+	defaultDownloadTimeout  = 5 * time.Minute
+)
+
+// Maximum time spent extracting the poster of a video
+const posterTimeout = 15 * time.Second
+
+// mediaLimits are the limits of the uploads, and the decoder used for the posters of videos
+type mediaLimits struct {
+	maxImageSize int64
+	maxGIFSize   int64
+	maxVideoSize int64
+
+	// maxPixels is the maximum width*height of images and GIFs, checked before decoding them
+	maxPixels int64
+
+	// maxDuration is the maximum duration of GIFs and videos
+	maxDuration time.Duration
+
+	// maxPostItems is the maximum number of media items of a post
+	maxPostItems int
+
+	// timeout is the time allowed to an upload to be received, processed and answered
+	timeout time.Duration
+
+	// ffmpeg is the path of the ffmpeg executable. If empty, videos get a placeholder poster
+	ffmpeg string
+}
+
+// Function that returns the maximum size of an upload of a format
+func (l mediaLimits) maxSize(format string) int64 {
+	switch format {
+	case formatGIF:
+		return l.maxGIFSize
+	case formatMP4, formatWebM:
+		return l.maxVideoSize
+	}
+	return l.maxImageSize
+}
+
+// Formats of the uploads, as recognized by sniffMediaFormat
+const (
+	formatJPEG = "jpeg"
+	formatPNG  = "png"
+	formatGIF  = "gif"
+	formatMP4  = "mp4"
+	formatWebM = "webm"
+)
+
+// Function that recognizes the format of an upload from its first bytes, without decoding it. Returns an empty
+// string if it's none of the supported formats
+func sniffMediaFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return formatJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a")):
+		return formatGIF
+	case isMP4(data):
+		return formatMP4
+	case webmDocType(data) == "webm":
+		return formatWebM
+	}
+	return ""
+}
+
+// Function that returns the Content-Type of a format recognized by sniffMediaFormat
+func mediaContentType(format string) string {
+	switch format {
+	case formatJPEG:
+		return "image/jpeg"
+	case formatPNG:
+		return "image/png"
+	case formatGIF:
+		return "image/gif"
+	case formatMP4:
+		return "video/mp4"
+	case formatWebM:
+		return "video/webm"
+	}
+	return ""
+}
+
+// Function that checks an upload and prepares it to be stored: images get their renditions (see processPhoto), GIFs
+// and videos get a poster. GIFs and videos are processed in place, in the temporary file of the upload, which becomes
+// the original. GIFs and videos longer than the maximum duration are rejected, and so are videos that don't declare
+// their duration (e.g., WebM recorded by browsers), whose length can't be checked
+func (l mediaLimits) process(ctx context.Context, u *upload, logger logrus.FieldLogger) (processedPhoto, error) {
+	switch u.format {
+	case formatJPEG, formatPNG:
+		// The size and the dimensions of the image have been checked when it was received
+		data, err := io.ReadAll(u.reader())
+		if err != nil {
+			return processedPhoto{}, err
+		}
+		return processPhoto(data)
+	case formatGIF:
+		return l.processGIF(u)
+	case formatMP4, formatWebM:
+		return l.processVideo(ctx, u, logger)
+	}
+	return processedPhoto{}, errMediaFormat
+}
+
+// GIF blocks
+const (
+	gifExtension      = 0x21
+	gifImage          = 0x2C
+	gifTrailer        = 0x3B
+	gifGraphicControl = 0xF9
+	gifComment        = 0xFE
+	gifApplication    = 0xFF
+)
+
+// Application extensions of GIFs kept by processGIF: the number of loops of the animation
+var gifLoopApplications = map[string]bool{"NETSCAPE2.0": true, "ANIMEXTS1.0": true}
+
+// gifScanner reads a GIF file sequentially, tracking the offset
+type gifScanner struct {
+	r   *bufio.Reader
+	off int64
+}
+
+func (s *gifScanner) next(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(s.r, buf)
+	s.off += int64(read)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errMediaFormat
+	}
+	return buf, err
+}
+
+// Function that reads a sequence of data sub-blocks, calling fn with the offset and the content of every sub-block.
+// With a nil fn, the sub-blocks are skipped
+func (s *gifScanner) subBlocks(fn func(off int64, data []byte) error) error {
+	for {
+		size, err := s.next(1)
+		if err != nil {
+			return err
+		}
+		if size[0] == 0 {
+			return nil
+		}
+		if fn == nil {
+			skipped, err := s.r.Discard(int(size[0]))
+			s.off += int64(skipped)
+			if err != nil {
+				return errMediaFormat
+			}
+			continue
+		}
+		off := s.off
+		data, err := s.next(int(size[0]))
+		if err != nil {
+			return err
+		}
+		if err := fn(off, data); err != nil {
+			return err
+		}
+	}
+}
+
+// Function that processes an animated GIF without decoding its frames: comments and application extensions (except
+// the number of loops) are blanked in place, the duration is the sum of the delays of the frames and the first frame
+// becomes the poster
+func (l mediaLimits) processGIF(u *upload) (processedPhoto, error) {
+	s := &gifScanner{r: bufio.NewReader(u.reader())}
+
+	// Signature and logical screen descriptor, followed by the global color table
+	header, err := s.next(13)
+	if err != nil {
+		return processedPhoto{}, err
+	}
+	if packed := header[10]; packed&0x80 != 0 {
+		if _, err := s.next(3 << (packed&7 + 1)); err != nil {
+			return processedPhoto{}, err
+		}
+	}
+
+	var duration time.Duration
+	delay := 0
+	frames := 0
+	for done := false; !done; {
+		block, err := s.next(1)
+		if errors.Is(err, errMediaFormat) && frames > 0 {
+			// Missing trailer, tolerated by browsers
+			break
+		} else if err != nil {
+			return processedPhoto{}, err
+		}
+
+		switch block[0] {
+		case gifExtension:
+			label, err := s.next(1)
+			if err != nil {
+				return processedPhoto{}, err
+			}
+			first, keep := true, true
+			err = s.subBlocks(func(off int64, data []byte) error {
+				defer func() { first = false }()
+				switch label[0] {
+				case gifGraphicControl:
+					if first && len(data) >= 3 {
+						delay = int(binary.LittleEndian.Uint16(data[1:]))
+					}
+					return nil
+				case gifComment:
+					return zeroMediaRange(u.file, off, off+int64(len(data)))
+				case gifApplication:
+					if first {
+						keep = gifLoopApplications[string(data)]
+					}
+					if !keep {
+						return zeroMediaRange(u.file, off, off+int64(len(data)))
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return processedPhoto{}, err
+			}
+
+		case gifImage:
+			// Position and size of the frame, followed by the local color table and the image data
+			descriptor, err := s.next(9)
+			if err != nil {
+				return processedPhoto{}, err
+			}
+			if packed := descriptor[8]; packed&0x80 != 0 {
+				if _, err := s.next(3 << (packed&7 + 1)); err != nil {
+					return processedPhoto{}, err
+				}
+			}
+			if _, err := s.next(1); err != nil {
+				return processedPhoto{}, err
+			}
+			if err := s.subBlocks(nil); err != nil {
+				return processedPhoto{}, err
+			}
+
+			// Browsers play delays shorter than 20ms at 100ms
+			if delay <= 1 {
+				delay = 10
+			}
+			duration += time.Duration(delay) * 10 * time.Millisecond
+			delay = 0
+			frames++
+			if duration > l.maxDuration {
+				return processedPhoto{}, errMediaTooLong
+			}
+
+		case gifTrailer:
+			done = true
+
+		default:
+			return processedPhoto{}, errMediaFormat
+		}
+	}
+	if frames == 0 {
+		return processedPhoto{}, errMediaFormat
+	}
+
+	// Only the first frame is decoded. Frames can be smaller than the canvas
+	config, err := gif.DecodeConfig(u.reader())
+	if err != nil {
+		return processedPhoto{}, errMediaFormat
+	}
+	frame, err := gif.Decode(u.reader())
+	if err != nil {
+		return processedPhoto{}, errMediaFormat
+	}
+	first := image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
+	draw.Draw(first, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	poster, err := encodePhoto(fitImage(first, photoRenditionSizes[len(photoRenditionSizes)-1]), formatPNG, 0)
+	if err != nil {
+		return processedPhoto{}, err
+	}
+
+	return processedPhoto{
+		mediaType:  database.MediaGIF,
+		renditions: map[string][]byte{photoPosterName: poster},
+	}, nil
+}
+
+// Function that processes a video: its metadata boxes (MP4) or tags (WebM) are blanked, in place so that the offsets
+// of the media data don't change, and a poster is extracted with ffmpeg (a placeholder if it's not available or fails)
+func (l mediaLimits) processVideo(ctx context.Context, u *upload, logger logrus.FieldLogger) (processedPhoto, error) {
+	var duration time.Duration
+	var err error
+	if u.format == formatMP4 {
+		duration, err = processMP4(u.file, u.size)
+	} else {
+		duration, err = processWebM(u.file, u.size)
+	}
+	if errors.Is(err, errMediaFormat) {
+		return processedPhoto{}, errMediaFormat
+	} else if err != nil {
+		return processedPhoto{}, err
+	}
+	if duration <= 0 {
+		return processedPhoto{}, errMediaDuration
+	} else if duration > l.maxDuration {
+		return processedPhoto{}, errMediaTooLong
+	}
+
+	poster, err := l.extractPoster(ctx, u.file.Name())
+	if err != nil {
+		if l.ffmpeg != "" {
+			logger.WithError(err).Warning("photo-upload: error extracting the poster of a video, using the placeholder")
+		}
+		poster = placeholderPoster()
+	}
+
+	return processedPhoto{
+		mediaType:  database.MediaVideo,
+		renditions: map[string][]byte{photoPosterName: poster},
+	}, nil
+}
+
+// Function that extracts the first frame of a video file with ffmpeg, as a JPEG image no larger than the largest
+// rendition
+func (l mediaLimits) extractPoster(ctx context.Context, name string) ([]byte, error) {
+	if l.ffmpeg == "" {
+		return nil, errors.New("no video decoder available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, posterTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, l.ffmpeg, "-nostdin", "-v", "error", "-i", name,
+		"-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "pipe:1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.New(err.Error() + ": " + stderr.String())
+	}
+
+	frame, err := png.Decode(&stdout)
+	if err != nil {
+		return nil, err
+	}
+	return encodePhoto(fitImage(toRGBA(frame), photoRenditionSizes[len(photoRenditionSizes)-1]), formatJPEG, renditionJPEGQuality)
+}
+
+var placeholderPosterOnce sync.Once
+var placeholderPosterData []byte
+
+// Function that returns the poster of the videos whose first frame can't be extracted: a play symbol on a dark
+// background
+func placeholderPoster() []byte {
+	placeholderPosterOnce.Do(func() {
+		const w, h = 640, 360
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 0x21, G: 0x25, B: 0x29, A: 0xFF}}, image.Point{}, draw.Src)
+
+		// Triangle pointing right, centered
+		const side = 120
+		x0, y0 := w/2-side/3, h/2-side/2
+		for y := 0; y < side; y++ {
+			half := y
+			if y > side/2 {
+				half = side - y
+			}
+			for x := 0; x < half*2*866/1000; x++ {
+				img.SetRGBA(x0+x, y0+y, color.RGBA{R: 0xF8, G: 0xF9, B: 0xFA, A: 0xFF})
+			}
+		}
+
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img)
+		placeholderPosterData = buf.Bytes()
+	})
+	return placeholderPosterData
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"new-wasa/service/database"
+	"strconv"
+)
+
+// Page size of the photo lists (stream, tags, caption search)
+const defaultPhotoPageLimit = 20
+const maxPhotoPageLimit = 100
+
+// photosPage is a page of a photo list
+type photosPage struct {
+	Photos     []database.Photo `json:"photos"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// Function that reads the pagination parameters of a photo list: the cursor (the identifier of the last photo of the
+// previous page) and the page size. Returns false if they are not valid
+func parsePhotoPageParams(r *http.Request) (int64, int, bool) {
+	limit, ok := parseLimitParam(r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	var beforeId int64
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		id, err := strconv.ParseInt(c, 10, 64)
+		if err != nil || id <= 0 {
+			return 0, 0, false
+		}
+		beforeId = id
+	}
+	return beforeId, limit, true
+}
+
+// Function that reads the page size of a list (the limit query parameter). Returns false if it's not valid
+func parseLimitParam(r *http.Request) (int, bool) {
+	limit := defaultPhotoPageLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxPhotoPageLimit {
+			return 0, false
+		}
+		limit = n
+	}
+	return limit, true
+}
+
+// Function that builds a page from the photos loaded with one extra element (used to know if there's a next page)
+func newPhotosPage(photos []database.Photo, limit int) photosPage {
+	page := photosPage{Photos: photos}
+	if len(photos) > limit {
+		page.Photos = photos[:limit]
+		page.NextCursor = strconv.Itoa(photos[limit-1].PhotoId)
+	}
+	return page
+}
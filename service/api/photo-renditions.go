@@ -0,0 +1,372 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"strconv"
+)
+
+// Sizes (in pixels, of the longest side) of the renditions generated for every uploaded photo
+var photoRenditionSizes = []int{150, 640, 1080}
+
+// Quality of the re-encoded JPEG images
+const renditionJPEGQuality = 85
+const originalJPEGQuality = 95
+
+// Name of the poster (the still frame shown before playback) of GIFs and videos, stored alongside the original like the
+// renditions
+const photoPosterName = "poster"
+
+// processedPhoto is an uploaded photo ready to be stored: the original without metadata and its derived files (the
+// renditions of images, the poster of GIFs and videos), by name
+type processedPhoto struct {
+	mediaType string
+
+	// original is nil if the processed original is the upload itself (GIFs and videos are processed in place)
+	original   []byte
+	renditions map[string][]byte
+}
+
+// Function that returns the name of the original of a media item of a post (0-based). The first item is named after
+// the photo, as the photos uploaded before posts could have more items
+func photoItemName(photoId string, item int) string {
+	if item == 0 {
+		return photoId
+	}
+	return photoRenditionName(photoId, "item"+strconv.Itoa(item))
+}
+
+// Function that returns the name of the file of a rendition (a size, or the poster) of a photo, stored alongside the
+// original
+func photoRenditionName(photoId string, rendition string) string {
+	return photoId + "_" + rendition
+}
+
+// Function that checks that the uploaded data is a jpeg or png image, strips its metadata (EXIF, GPS included) and
+// generates the resized renditions. JPEG images with an EXIF orientation are rotated, since the orientation is lost
+// along with the metadata
+func processPhoto(data []byte) (processedPhoto, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return processedPhoto{}, errMediaFormat
+	}
+
+	result := processedPhoto{mediaType: database.MediaImage}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+		if orientation == 1 {
+			result.original, err = stripJPEGMetadata(data)
+			if err != nil {
+				return processedPhoto{}, errMediaFormat
+			}
+		}
+	} else {
+		result.original, err = stripPNGMetadata(data)
+		if err != nil {
+			return processedPhoto{}, errMediaFormat
+		}
+	}
+
+	src := orientImage(toRGBA(img), orientation)
+	if result.original == nil {
+		result.original, err = encodePhoto(src, format, originalJPEGQuality)
+		if err != nil {
+			return processedPhoto{}, err
+		}
+	}
+
+	result.renditions = make(map[string][]byte, len(photoRenditionSizes))
+	for _, size := range photoRenditionSizes {
+		result.renditions[strconv.Itoa(size)], err = encodePhoto(fitImage(src, size), format, renditionJPEGQuality)
+		if err != nil {
+			return processedPhoto{}, err
+		}
+	}
+	return result, nil
+}
+
+// Function that saves the original and the derived files of a media item of a user's photo (named by photoItemName) in
+// the media store
+func (p processedPhoto) save(ctx context.Context, store mediastore.MediaStore, userID string, name string, u *upload) error {
+	var err error
+	if p.original == nil {
+		err = store.Put(ctx, userPhotoKey(userID, name), u.reader(), u.size)
+	} else {
+		err = store.Put(ctx, userPhotoKey(userID, name), bytes.NewReader(p.original), int64(len(p.original)))
+	}
+	if err != nil {
+		return err
+	}
+	for rendition, data := range p.renditions {
+		err := store.Put(ctx, userPhotoKey(userID, photoRenditionName(name, rendition)), bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function that moves the original and the derived files of a media item of a user's photo, saved by save, from the
+// name from to the name to
+func (p processedPhoto) rename(ctx context.Context, store mediastore.MediaStore, userID string, from string, to string) error {
+	err := store.Rename(ctx, userPhotoKey(userID, from), userPhotoKey(userID, to))
+	if err != nil {
+		return err
+	}
+	for rendition := range p.renditions {
+		err := store.Rename(ctx, userPhotoKey(userID, photoRenditionName(from, rendition)),
+			userPhotoKey(userID, photoRenditionName(to, rendition)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function that removes the originals and the derived files of the media items of a user's photo from the media store.
+// Every file is attempted: the error lists all the failed removals
+func removePhotoFiles(ctx context.Context, store mediastore.MediaStore, userID string, photoId string, items int) error {
+	var failed mediaErrors
+	for item := 0; item < items; item++ {
+		name := photoItemName(photoId, item)
+		keys := make([]string, 0, len(photoRenditionSizes)+2)
+		for _, size := range photoRenditionSizes {
+			keys = append(keys, userPhotoKey(userID, photoRenditionName(name, strconv.Itoa(size))))
+		}
+		keys = append(keys, userPhotoKey(userID, photoRenditionName(name, photoPosterName)), userPhotoKey(userID, name))
+		for _, key := range keys {
+			if err := store.Delete(ctx, key); err != nil {
+				failed = append(failed, err)
+			}
+		}
+	}
+	return failed.err()
+}
+
+func encodePhoto(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	return buf.Bytes(), err
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// Function that scales down an image so that its longest side is at most size pixels, averaging the source pixels
+// covered by every destination pixel. Smaller images are returned as they are
+func fitImage(src *image.RGBA, size int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= size && sh <= size {
+		return src
+	}
+	dw, dh := size, size
+	if sw >= sh {
+		dh = sh * size / sw
+	} else {
+		dw = sw * size / sh
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				off := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					sum[0] += int(src.Pix[off])
+					sum[1] += int(src.Pix[off+1])
+					sum[2] += int(src.Pix[off+2])
+					sum[3] += int(src.Pix[off+3])
+					off += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			off := dst.PixOffset(dx, dy)
+			for c := 0; c < 4; c++ {
+				dst.Pix[off+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// Function that applies an EXIF orientation (1-8) to an image, so that it's displayed correctly without it
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// JPEG markers
+const (
+	jpegMarkerSOS   = 0xDA
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP13 = 0xED
+	jpegMarkerCOM   = 0xFE
+)
+
+var errBadJPEG = errors.New("malformed jpeg")
+
+// Function that walks the segments of a JPEG file before the image data, calling fn with the marker and the payload
+// of every segment. Returns the offset of the start of scan segment
+func walkJPEGSegments(data []byte, fn func(marker byte, segment []byte, payload []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, errBadJPEG
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0, errBadJPEG
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte
+			i++
+			continue
+		}
+		if marker == jpegMarkerSOS {
+			return i, nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, errBadJPEG
+		}
+		fn(marker, data[i:i+2+length], data[i+4:i+2+length])
+		i += 2 + length
+	}
+	return 0, errBadJPEG
+}
+
+// Function that removes the EXIF/XMP (APP1), IPTC (APP13) and comment segments of a JPEG file, without re-encoding it
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	sos, err := walkJPEGSegments(data, func(marker byte, segment []byte, _ []byte) {
+		if marker != jpegMarkerAPP1 && marker != jpegMarkerAPP13 && marker != jpegMarkerCOM {
+			out = append(out, segment...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(out, data[sos:]...), nil
+}
+
+// Function that reads the EXIF orientation of a JPEG file. Returns 1 (normal) if it's missing or unreadable
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	_, _ = walkJPEGSegments(data, func(marker byte, _ []byte, payload []byte) {
+		if marker != jpegMarkerAPP1 || len(payload) < 14 || string(payload[:6]) != "Exif\x00\x00" {
+			return
+		}
+		tiff := payload[6:]
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for e := 0; e < entries; e++ {
+			entry := ifd + 2 + e*12
+			if entry+12 > len(tiff) {
+				return
+			}
+			if order.Uint16(tiff[entry:]) == 0x0112 {
+				orientation = int(order.Uint16(tiff[entry+8:]))
+				return
+			}
+		}
+	})
+	return orientation
+}
+
+// Function that removes the metadata chunks (EXIF and text) of a PNG file
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signatureLength = 8
+	if len(data) < signatureLength {
+		return nil, errors.New("malformed png")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:signatureLength]...)
+	for i := signatureLength; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("malformed png")
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errors.New("malformed png")
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
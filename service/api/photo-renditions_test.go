@@ -0,0 +1,279 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// Returns a w x h image, red in the top-left 10x10 square and blue elsewhere, so that rotations can be recognized
+func testImage(w int, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < 10 && y < 10 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+// Returns a JPEG segment with the given marker and payload
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// Returns the payload of an EXIF (APP1) segment with an orientation and a GPS tag, in the given byte order
+func exifPayload(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	// Orientation: SHORT, count 1, value in the first two bytes of the value field
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	// GPS IFD pointer
+	order.PutUint16(tiff[22:], 0x8825)
+	order.PutUint16(tiff[24:], 4)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint32(tiff[30:], 0)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+// Encodes an image as JPEG and inserts the segments right after the start of image marker
+func testJPEG(t *testing.T, img image.Image, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte(nil), data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+// Returns a PNG chunk with the given type and data
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+// Encodes an image as PNG and inserts the chunks right after the header chunk
+func testPNG(t *testing.T, img image.Image, chunks ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	const afterHeader = 8 + 12 + 13
+	out := append([]byte(nil), data[:afterHeader]...)
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return append(out, data[afterHeader:]...)
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	img := testImage(8, 8)
+	clean := testJPEG(t, img)
+	metadata := [][]byte{
+		jpegSegment(jpegMarkerAPP1, exifPayload(binary.BigEndian, 1)),
+		jpegSegment(jpegMarkerAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+		jpegSegment(jpegMarkerAPP13, []byte("Photoshop 3.0\x008BIM")),
+		jpegSegment(jpegMarkerCOM, []byte("taken at home")),
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  bool
+	}{
+		{name: "without metadata", data: clean, want: clean},
+		{name: "exif, xmp, iptc and comment", data: testJPEG(t, img, metadata...), want: clean},
+		{
+			name: "other segments kept",
+			data: testJPEG(t, img, metadata[0], jpegSegment(0xE2, []byte("ICC_PROFILE\x00")), metadata[3]),
+			want: testJPEG(t, img, jpegSegment(0xE2, []byte("ICC_PROFILE\x00"))),
+		},
+		{name: "not a jpeg", data: []byte("GIF89a......"), err: true},
+		{name: "segment longer than the file", data: clean[:2+4+10], err: true},
+		{name: "segment length too short", data: append([]byte{0xFF, 0xD8}, 0xFF, 0xE1, 0, 1, 0, 0), err: true},
+		{name: "missing start of scan", data: append([]byte{0xFF, 0xD8}, jpegSegment(jpegMarkerCOM, nil)...), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripJPEGMetadata(tt.data)
+			if tt.err {
+				if err == nil {
+					t.Fatal("stripJPEGMetadata succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripJPEGMetadata error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripJPEGMetadata = %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(got)); err != nil {
+				t.Errorf("stripped jpeg doesn't decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := testImage(4, 4)
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", testJPEG(t, img), 1},
+		{"little endian", testJPEG(t, img, jpegSegment(jpegMarkerAPP1, exifPayload(binary.LittleEndian, 6))), 6},
+		{"big endian", testJPEG(t, img, jpegSegment(jpegMarkerAPP1, exifPayload(binary.BigEndian, 8))), 8},
+		{"xmp only", testJPEG(t, img, jpegSegment(jpegMarkerAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"unknown byte order", testJPEG(t, img, jpegSegment(jpegMarkerAPP1, []byte("Exif\x00\x00XX\x00\x2a\x00\x00\x00\x08"))), 1},
+		{"ifd outside the segment", testJPEG(t, img, jpegSegment(jpegMarkerAPP1, []byte("Exif\x00\x00MM\x00\x2a\x00\x00\xff\x00"))), 1},
+	}
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	img := testImage(8, 8)
+	clean := testPNG(t, img)
+	gamma := pngChunk("gAMA", []byte{0, 0, 0xB1, 0x8F})
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		err  bool
+	}{
+		{name: "without metadata", data: clean, want: clean},
+		{
+			name: "exif and text chunks",
+			data: testPNG(t, img,
+				pngChunk("eXIf", exifPayload(binary.BigEndian, 1)[6:]),
+				pngChunk("tEXt", []byte("Comment\x00taken at home")),
+				pngChunk("zTXt", []byte("Author\x00\x00x")),
+				pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))),
+			want: clean,
+		},
+		{name: "other chunks kept", data: testPNG(t, img, gamma, pngChunk("tEXt", []byte("a\x00b"))), want: testPNG(t, img, gamma)},
+		{name: "too short", data: clean[:4], err: true},
+		{name: "truncated chunk", data: clean[:len(clean)-3], err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripPNGMetadata(tt.data)
+			if tt.err {
+				if err == nil {
+					t.Fatal("stripPNGMetadata succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("stripPNGMetadata error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripPNGMetadata = %d bytes, want %d bytes", len(got), len(tt.want))
+			}
+			if _, err := png.Decode(bytes.NewReader(got)); err != nil {
+				t.Errorf("stripped png doesn't decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessPhoto(t *testing.T) {
+	img := testImage(40, 20)
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		// Expected size of the original and a pixel of its red square (at the top-left corner of the upload)
+		width, height int
+		red           image.Point
+		err           error
+	}{
+		{name: "jpeg", data: testJPEG(t, img, jpegSegment(jpegMarkerCOM, []byte("hidden"))), width: 40, height: 20, red: image.Pt(2, 2)},
+		{
+			name:  "jpeg rotated by its orientation",
+			data:  testJPEG(t, img, jpegSegment(jpegMarkerAPP1, exifPayload(binary.LittleEndian, 6))),
+			width: 20, height: 40, red: image.Pt(17, 2),
+		},
+		{name: "png", data: testPNG(t, img, pngChunk("tEXt", []byte("Comment\x00hidden"))), width: 40, height: 20, red: image.Pt(2, 2)},
+		{name: "gif", data: gifData.Bytes(), err: errMediaFormat},
+		{name: "garbage", data: []byte("not an image"), err: errMediaFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := processPhoto(tt.data)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("processPhoto error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("processPhoto error = %v", err)
+			}
+			for _, hidden := range []string{"hidden", "Exif"} {
+				if bytes.Contains(got.original, []byte(hidden)) {
+					t.Errorf("original still contains %q", hidden)
+				}
+			}
+			original, _, err := image.Decode(bytes.NewReader(got.original))
+			if err != nil {
+				t.Fatalf("original doesn't decode: %v", err)
+			}
+			if b := original.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Errorf("original is %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			if r, _, b, _ := original.At(tt.red.X, tt.red.Y).RGBA(); r < 0x8000 || b > 0x8000 {
+				t.Errorf("pixel %v of the original isn't red", tt.red)
+			}
+			if len(got.renditions) != len(photoRenditionSizes) {
+				t.Errorf("%d renditions, want %d", len(got.renditions), len(photoRenditionSizes))
+			}
+		})
+	}
+}
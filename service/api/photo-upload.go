@@ -1,23 +1,18 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"image/jpeg"
-	"image/png"
-	"io"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"os"
-	"path/filepath"
+	"new-wasa/service/database"
 	"strconv"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that manages the upload of a photo
+// Function that manages the upload of a photo: a post of one or more media items (images, GIFs or short videos)
 func (rt *_router) postPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -36,70 +31,86 @@ func (rt *_router) postPhoto(w http.ResponseWriter, r *http.Request, ps httprout
 		Date:  time.Now().UTC(),
 	}
 
-	// Create a copy of the body
-	data, err := io.ReadAll(r.Body)
+	// The post is either the raw body (a single item) or, with a multipart body, up to maxPostItems "photo" parts, in
+	// order (optionally with a "caption" part). They're received in temporary files, within the limits of their format
+	uploads, values, err := rt.receiveUploads(w, r, "photo", postFormats, rt.mediaLimits.maxPostItems)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo-upload: error reading body content")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeUploadError(w, err, ctx, "photo-upload")
 		return
 	}
+	defer closeUploads(uploads)
 
-	// After reading the body we won't be able to read it again. We'll reassign a "fresh" io.ReadCloser to the body
-	r.Body = io.NopCloser(bytes.NewBuffer(data))
-
-	// Check if the body content is either a png or a jpeg image
-	err = checkFormatPhoto(r.Body, io.NopCloser(bytes.NewBuffer(data)), ctx)
-	if err != nil {
+	var ok bool
+	photo.Caption, ok = validCaption(values["caption"])
+	if !ok {
 		w.WriteHeader(http.StatusBadRequest)
-		ctx.Logger.WithError(err).Error("photo-upload: body contains file that is neither jpg or png")
-		// controllaerrore
-		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: IMG_FORMAT_ERROR_MSG})
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_CAPTION_ERROR_MSG})
 		return
 	}
 
-	// Body has been read in the previous function so it's necessary to reassign a io.ReadCloser to it
-	r.Body = io.NopCloser(bytes.NewBuffer(data))
+	// Strip the metadata of the items and generate their renditions (or posters)
+	processed := make([]processedPhoto, len(uploads))
+	for i, upload := range uploads {
+		processed[i], err = rt.mediaLimits.process(r.Context(), upload, ctx.Logger)
+		if err != nil {
+			writeUploadError(w, err, ctx, "photo-upload")
+			return
+		}
+		photo.Media = append(photo.Media, database.MediaItem{Position: i, MediaType: processed[i].mediaType})
+	}
+	photo.MediaType = photo.Media[0].MediaType
 
-	// Generate a unique id for the photo
-	photoIdInt, err := rt.db.CreatePhoto(photo.ToDatabase())
+	// The files are saved under a random staging name before the photo is created, so that the identifier of the photo
+	// isn't needed yet: the files of a failed upload that can't be removed here are orphans for the media garbage
+	// collector
+	staging, err := randomIdentifier16()
 	if err != nil {
-		ctx.Logger.WithError(err).Error("photo-upload: error executing db function call")
+		ctx.Logger.WithError(err).Error("photo-upload: error generating the staging name")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-
-	photoId := strconv.FormatInt(photoIdInt, 10)
-
-	// Create the user's folder locally to save his/her images
-	photoPath := getUserPhotoFolder(auth)
-	if err := os.MkdirAll(photoPath, os.ModePerm); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		ctx.Logger.WithError(err).Error("photo-upload: error creating local photo directory")
-		return
+	staging = "upload-" + staging
+	for i := range processed {
+		err = processed[i].save(r.Context(), rt.media, auth, photoItemName(staging, i), uploads[i])
+		if err != nil {
+			break
+		}
+	}
+	var photoIdInt int64
+	if err == nil {
+		photoIdInt, err = rt.db.CreatePhoto(photo.ToDatabase())
 	}
-
-	// Create an empty file for storing the body content (image)
-	out, err := os.Create(filepath.Join(photoPath, photoId))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		ctx.Logger.WithError(err).Error("photo-upload: error creating local photo file")
-		//  = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INTERNAL_ERROR_MSG})
+		ctx.Logger.WithError(err).Error("photo-upload: error saving the photo")
+		if err := removePhotoFiles(context.Background(), rt.media, auth, staging, len(processed)); err != nil {
+			ctx.Logger.WithError(err).Warning("photo-upload: error removing the files of the failed upload")
+		}
 		return
 	}
 
-	// Copy body content to the previously created file
-	_, err = io.Copy(out, r.Body)
+	// Then the files take the names of the photo (until they do, they're not found). If they can't, the photo is removed
+	photoId := strconv.FormatInt(photoIdInt, 10)
+	for i := range processed {
+		err = processed[i].rename(context.Background(), rt.media, auth, photoItemName(staging, i), photoItemName(photoId, i))
+		if err != nil {
+			break
+		}
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		ctx.Logger.WithError(err).Error("photo-upload: error copying body content into file photo")
-		// controllaerrore
-		// _ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INTERNAL_ERROR_MSG})
+		ctx.Logger.WithError(err).Error("photo-upload: error renaming the files of the photo")
+		if _, err := rt.db.RemovePhoto(database.User{IdUser: auth}, database.PhotoId{IdPhoto: photoIdInt}); err != nil {
+			ctx.Logger.WithError(err).Error("photo-upload: error removing the photo of the failed upload")
+		}
+		for _, name := range []string{staging, photoId} {
+			if err := removePhotoFiles(context.Background(), rt.media, auth, name, len(processed)); err != nil {
+				ctx.Logger.WithError(err).Warning("photo-upload: error removing the files of the failed upload")
+			}
+		}
 		return
 	}
 
-	// Close the created file
-	out.Close()
-
 	w.WriteHeader(http.StatusCreated)
 	// controllaerrore
 	// _ = json.NewEncoder(w).Encode(PhotoId{IdPhoto: photoIdInt})
@@ -109,28 +120,10 @@ func (rt *_router) postPhoto(w http.ResponseWriter, r *http.Request, ps httprout
 		Owner:    photo.Owner,
 		Date:     photo.Date,
 		PhotoId:  int(photoIdInt),
-	})
-
-}
-
-// Function checks if the format of the photo is png or jpeg. Returns the format extension and an error
-func checkFormatPhoto(body io.ReadCloser, newReader io.ReadCloser, ctx reqcontext.RequestContext) error {
+		Caption:  photo.Caption,
 
-	_, errJpg := jpeg.Decode(body)
-	if errJpg != nil {
-
-		body = newReader
-		_, errPng := png.Decode(body)
-		if errPng != nil {
-			return errors.New(IMG_FORMAT_ERROR_MSG)
-		}
-		return nil
-	}
-	return nil
-}
+		MediaType: photo.MediaType,
+		Media:     photo.Media,
+	})
 
-// Function that returns the path of the photo folder for a certain user
-func getUserPhotoFolder(userID string) string {
-	// Path of the photo dir "./media/userID/photos/"
-	return filepath.Join(photoFolder, userID, "photos")
 }
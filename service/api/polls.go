@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Poll limits
+const maxPollQuestionLength = 300
+const maxPollOptionLength = 100
+const minPollOptions = 2
+const maxPollOptions = 10
+
+// pollRequest is the poll sent in the body of sendMessage
+type pollRequest struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+// Checks the poll and converts it for the database. Returns an error message if the poll isn't valid
+func (p pollRequest) toDatabase(now time.Time) (database.NewPoll, string) {
+	question := strings.TrimSpace(p.Question)
+	if question == "" || utf8.RuneCountInString(question) > maxPollQuestionLength {
+		return database.NewPoll{}, "poll question must be between 1 and 300 characters"
+	}
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return database.NewPoll{}, "polls must have between 2 and 10 options"
+	}
+	options := make([]string, 0, len(p.Options))
+	seen := make(map[string]bool)
+	for _, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > maxPollOptionLength {
+			return database.NewPoll{}, "poll options must be between 1 and 100 characters"
+		}
+		if seen[strings.ToLower(option)] {
+			return database.NewPoll{}, "poll options must be different"
+		}
+		seen[strings.ToLower(option)] = true
+		options = append(options, option)
+	}
+	if p.ClosesAt != nil && !p.ClosesAt.After(now) {
+		return database.NewPoll{}, "poll close time must be in the future"
+	}
+
+	return database.NewPoll{
+		Question:       question,
+		Options:        options,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+		ClosesAt:       p.ClosesAt,
+	}, ""
+}
+
+// Validates the requester, the group peer and the message id of the poll endpoints. Returns the group id, the poll
+// message id and 0, or the http status to reply with
+func (rt *_router) pollRequestTarget(r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) (int64, int64, int) {
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		return 0, 0, status
+	}
+	groupID, ok := parseGroupPeer(ps.ByName("peer"))
+	if !ok {
+		return 0, 0, http.StatusBadRequest
+	}
+	messageID, err := strconv.ParseInt(ps.ByName("message_id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		return 0, 0, http.StatusBadRequest
+	}
+
+	inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("poll: db.IsUserInGroup error")
+		return 0, 0, http.StatusInternalServerError
+	}
+	if !inGroup {
+		return 0, 0, http.StatusForbidden
+	}
+
+	// Polls whose close time passed must not accept votes anymore: close them (and add their events) first
+	if err := rt.db.CloseExpiredGroupPolls(groupID); err != nil {
+		ctx.Logger.WithError(err).Error("poll: db.CloseExpiredGroupPolls error")
+		return 0, 0, http.StatusInternalServerError
+	}
+	return groupID, messageID, 0
+}
+
+// Replies to a failed poll operation
+func writePollError(w http.ResponseWriter, err error, ctx reqcontext.RequestContext, operation string) {
+	switch {
+	case errors.Is(err, database.ErrPollNotFound), errors.Is(err, database.ErrPollOptionNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, database.ErrPollClosed):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: POLL_CLOSED_ERROR_MSG})
+	case errors.Is(err, database.ErrForbiddenMessageAction):
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		ctx.Logger.WithError(err).Error(operation + " error")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// votePoll adds the vote of the requester to an option of a group poll
+func (rt *_router) votePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	groupID, messageID, status := rt.pollRequestTarget(r, ps, ctx)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	option, err := strconv.Atoi(ps.ByName("option"))
+	if err != nil || option < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if err := rt.db.VoteGroupPoll(groupID, messageID, database.User{IdUser: requester}, option); err != nil {
+		writePollError(w, err, ctx, "votePoll: db.VoteGroupPoll")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unvotePoll removes the vote of the requester from an option of a group poll
+func (rt *_router) unvotePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	groupID, messageID, status := rt.pollRequestTarget(r, ps, ctx)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	option, err := strconv.Atoi(ps.ByName("option"))
+	if err != nil || option < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if err := rt.db.UnvoteGroupPoll(groupID, messageID, database.User{IdUser: requester}, option); err != nil {
+		writePollError(w, err, ctx, "unvotePoll: db.UnvoteGroupPoll")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// closePoll closes a group poll before its close time (poll creator only)
+func (rt *_router) closePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	groupID, messageID, status := rt.pollRequestTarget(r, ps, ctx)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if err := rt.db.CloseGroupPoll(groupID, messageID, database.User{IdUser: requester}); err != nil {
+		writePollError(w, err, ctx, "closePoll: db.CloseGroupPoll")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,70 +2,77 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"strconv"
+	"new-wasa/service/database"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that adds a comment to a photo and sends a response containing the unique id of the created comment
+// Default maximum length (in characters) of the comments
+const defaultMaxCommentLength = 500
+
+// Function that checks the text of a comment: not blank and at most maxLength characters. Returns the trimmed text
+func validComment(text string, maxLength int) (string, bool) {
+	text = strings.TrimSpace(text)
+	return text, text != "" && utf8.ValidString(text) && utf8.RuneCountInString(text) <= maxLength
+}
+
+// Function that replies 400 to an invalid comment
+func (rt *_router) writeInvalidComment(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: fmt.Sprintf(INVALID_COMMENT_ERROR_MSG, rt.maxCommentLength)})
+}
+
+// Function that adds a comment (or a reply to a comment) to a photo and sends a response containing the unique id of
+// the created comment
 func (rt *_router) postComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	w.Header().Set("Content-Type", "application/json")
-	photoOwnerId := ps.ByName("id")
 	requestingUserId := extractBearer(r.Header.Get("Authorization"))
 
-	if isNotLogged(requestingUserId) {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	// Check if the requesting user wasn't banned by the photo owner
-	banned, err := rt.db.BannedUserCheck(
-		User{IdUser: requestingUserId}.ToDatabase(),
-		User{IdUser: photoOwnerId}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("post-comment/db.BannedUserCheck: error executing query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if banned {
-		// User was banned by owner, can't post the comment
-		w.WriteHeader(http.StatusForbidden)
+	// The photo must belong to the user in the path and be visible to the requesting user (not banned by the owner,
+	// an approved follower if the owner is private)
+	photo, ok := rt.visiblePhoto(w, ps, requestingUserId, ctx, "post-comment")
+	if !ok {
 		return
 	}
 
 	// Copy body content (comment sent by user) into comment (struct)
 	var comment Comment
-	err = json.NewDecoder(r.Body).Decode(&comment)
+	err := json.NewDecoder(r.Body).Decode(&comment)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		ctx.Logger.WithError(err).Error("post-comment/Decode: failed to decode request body json")
 		return
 	}
 
-	// Check if the comment has a valid lenght (<=30)
-	if len(comment.Comment) > 30 {
-		w.WriteHeader(http.StatusBadRequest)
-		ctx.Logger.WithError(err).Error("post-comment: comment longer than 30 characters")
+	// Check if the comment has a valid length
+	comment.Comment, ok = validComment(comment.Comment, rt.maxCommentLength)
+	if !ok {
+		rt.writeInvalidComment(w)
 		return
 	}
-
-	// Convert the photo identifier from string to int64
-	photo_id_64, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
-	if err != nil {
+	if comment.ParentId < 0 {
 		w.WriteHeader(http.StatusBadRequest)
-		ctx.Logger.WithError(err).Error("post-comment/ParseInt: failed convert photo_id to int64")
 		return
 	}
 
 	// Function call to db for comment creation
 	commentId, err := rt.db.CommentPhoto(
-		PhotoId{IdPhoto: photo_id_64}.ToDatabase(),
+		PhotoId{IdPhoto: int64(photo.PhotoId)}.ToDatabase(),
 		User{IdUser: requestingUserId}.ToDatabase(),
 		comment.ToDatabase())
-	if err != nil {
+	if errors.Is(err, database.ErrCommentNotFound) {
+		// The comment replied to isn't a comment of the photo that the user can see
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: COMMENT_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		ctx.Logger.WithError(err).Error("post-comment/db.CommentPhoto: failed to execute query for insertion")
 		return
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Maximum length (in characters) of the profile information
+const maxDisplayNameLength = 32
+const maxBioLength = 160
+const maxWebsiteLength = 200
+
+// Function that trims a display name and checks it. Returns the display name and whether it's valid
+func validDisplayName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return "", false
+	}
+	return name, strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// Function that trims a bio and checks it (it can span several lines). Returns the bio and whether it's valid
+func validBio(bio string) (string, bool) {
+	bio = strings.TrimSpace(bio)
+	if !utf8.ValidString(bio) || utf8.RuneCountInString(bio) > maxBioLength {
+		return "", false
+	}
+	return bio, strings.IndexFunc(bio, func(r rune) bool { return unicode.IsControl(r) && r != '\n' }) < 0
+}
+
+// Function that trims a website link and checks that it's an absolute http(s) URL (an empty link removes the website).
+// Returns the link and whether it's valid
+func validWebsite(website string) (string, bool) {
+	website = strings.TrimSpace(website)
+	if website == "" {
+		return "", true
+	}
+	if len(website) > maxWebsiteLength {
+		return "", false
+	}
+	u, err := url.Parse(website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// Function that changes the display name, the bio and the website of the requesting user. The fields missing from the
+// body are left unchanged, empty ones are removed
+func (rt *_router) patchProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	pathId := ps.ByName("id")
+
+	// Only the owner can change his/her profile
+	valid := validateRequestingUser(pathId, extractBearer(r.Header.Get("Authorization")))
+	if valid != 0 {
+		w.WriteHeader(valid)
+		return
+	}
+
+	var body ProfileInfo
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+
+	profile, err := rt.db.GetProfile(User{IdUser: pathId}.ToDatabase())
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("patchProfile: db.GetProfile error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	info := database.ProfileInfo{DisplayName: profile.DisplayName, Bio: profile.Bio, Website: profile.Website}
+	var ok bool
+	if body.DisplayName != nil {
+		if info.DisplayName, ok = validDisplayName(*body.DisplayName); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_DISPLAY_NAME_ERROR_MSG})
+			return
+		}
+	}
+	if body.Bio != nil {
+		if info.Bio, ok = validBio(*body.Bio); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_BIO_ERROR_MSG})
+			return
+		}
+	}
+	if body.Website != nil {
+		if info.Website, ok = validWebsite(*body.Website); !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_WEBSITE_ERROR_MSG})
+			return
+		}
+	}
+
+	err = rt.db.SetProfileInfo(User{IdUser: pathId}.ToDatabase(), info)
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("patchProfile: db.SetProfileInfo error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ProfileInfo{DisplayName: &info.DisplayName, Bio: &info.Bio, Website: &info.Website})
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// followListPage is a page of the followers (or of the followed users) of a profile
+type followListPage struct {
+	Users      []database.UserSummary `json:"users"`
+	NextCursor string                 `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// profileListAccess checks that the requesting user can see the lists of a profile: he/she must be logged, the two
+// users must not have banned each other, and private accounts show them only to their approved followers. It replies
+// with the error and returns false otherwise
+func (rt *_router) profileListAccess(w http.ResponseWriter, requester string, owner string, ctx reqcontext.RequestContext,
+	where string) bool {
+
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	if rt.bannedPeer(w, ctx, requester, owner, where) {
+		return false
+	}
+
+	exists, err := rt.db.CheckUser(database.User{IdUser: owner})
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.CheckUser error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return false
+	}
+
+	visible, err := rt.db.CanSeeContent(database.User{IdUser: requester}, database.User{IdUser: owner})
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.CanSeeContent error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if !visible {
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: PRIVATE_ACCOUNT_ERROR_MSG})
+		return false
+	}
+	return true
+}
+
+// getFollowersList returns a page of the followers of a user, in nickname order
+func (rt *_router) getFollowersList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.getFollowList(w, r, ps, ctx, rt.db.GetFollowers, "getFollowersList")
+}
+
+// getFollowingList returns a page of the users followed by a user, in nickname order
+func (rt *_router) getFollowingList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	rt.getFollowList(w, r, ps, ctx, rt.db.GetFollowing, "getFollowingList")
+}
+
+// getFollowList returns a page of a list of users of the profile in the path, loaded with list. The cursor is the
+// nickname of the last user of the previous page
+func (rt *_router) getFollowList(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext,
+	list func(database.User, database.User, string, int) ([]database.UserSummary, error), where string) {
+
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	owner := ps.ByName("id")
+
+	limit, ok := parseLimitParam(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !rt.profileListAccess(w, requester, owner, ctx, where) {
+		return
+	}
+
+	// One extra user is loaded to know if there's a next page
+	users, err := list(database.User{IdUser: requester}, database.User{IdUser: owner}, r.URL.Query().Get("cursor"), limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page := followListPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = users[limit-1].Nickname
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		ctx.Logger.WithError(err).Error(where + "/Encode: failed to encode users json")
+	}
+}
+
+// getUserPhotos returns a page of the photos of a user, newest first
+func (rt *_router) getUserPhotos(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	owner := ps.ByName("id")
+
+	beforeId, limit, ok := parsePhotoPageParams(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !rt.profileListAccess(w, requester, owner, ctx, "getUserPhotos") {
+		return
+	}
+
+	// One extra photo is loaded to know if there's a next page
+	photos, err := rt.db.GetUserPhotos(database.User{IdUser: requester}, database.User{IdUser: owner}, beforeId, limit+1)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("getUserPhotos: db.GetUserPhotos error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(newPhotosPage(photos, limit)); err != nil {
+		ctx.Logger.WithError(err).Error("getUserPhotos/Encode: failed to encode photos json")
+	}
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -27,11 +29,15 @@ func (rt *_router) putBan(w http.ResponseWriter, r *http.Request, ps httprouter.
 		return
 	}
 
-	// Add the new banned user in the db via db function
+	// Add the new banned user in the db via db function. Ban implies removing the follows (if they exist) in both
+	// directions, or else the banned user would have the banner in his home
 	err := rt.db.BanUser(
 		User{IdUser: pathId}.ToDatabase(),
 		User{IdUser: pathBannedId}.ToDatabase())
-	if err != nil {
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		ctx.Logger.WithError(err).Error("put-ban/db.BanUser: error executing insert query")
 
 		// Something  didn't work internally
@@ -39,26 +45,6 @@ func (rt *_router) putBan(w http.ResponseWriter, r *http.Request, ps httprouter.
 		return
 	}
 
-	// Ban implies removing the follow (if exists)
-	err = rt.db.UnfollowUser(
-		User{IdUser: requestingUserId}.ToDatabase(),
-		User{IdUser: pathBannedId}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("put-ban/db.UnfollowUser1: error executing insert query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	// The banned user will not follow the user anymore or else will have the banner in his home
-	err = rt.db.UnfollowUser(
-		User{IdUser: pathBannedId}.ToDatabase(),
-		User{IdUser: requestingUserId}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("put-ban/db.UnfollowUser2: error executing insert query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	// Respond with 204 http status
 	w.WriteHeader(http.StatusNoContent)
 }
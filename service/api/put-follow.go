@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
@@ -8,7 +10,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that adds a user to the followers list of another
+// Function that adds a user to the followers list of another. Following a private account creates a follow request
+// (202) that the owner has to approve
 func (rt *_router) putFollow(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	userToFollowId := ps.ByName("id")
@@ -27,12 +30,12 @@ func (rt *_router) putFollow(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	// Check if the requesting user wasn't banned by the photo owner
-	banned, err := rt.db.BannedUserCheck(
+	// Check that neither of the two users banned the other
+	banned, err := rt.db.BanBetween(
 		database.User{IdUser: requestingUserId},
 		database.User{IdUser: userToFollowId})
 	if err != nil {
-		ctx.Logger.WithError(err).Error("post-comment/rt.db.BannedUserCheck: error executing query")
+		ctx.Logger.WithError(err).Error("put-follow/rt.db.BanBetween: error executing query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -42,16 +45,26 @@ func (rt *_router) putFollow(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	// Add the new follower in the db via db function
-	err = rt.db.FollowUser(
+	// Add the new follower (or the follow request) in the db via db function
+	pending, err := rt.db.FollowUser(
 		User{IdUser: requestingUserId}.ToDatabase(),
 		User{IdUser: userToFollowId}.ToDatabase())
-	if err != nil {
+	if errors.Is(err, database.ErrUserNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
 		ctx.Logger.WithError(err).Error("put-follow: error executing insert query")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if pending {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(FollowStatus{Status: database.FollowStatusPending})
+		return
+	}
+
 	// Respond with 204 http status
 	w.WriteHeader(http.StatusNoContent)
 }
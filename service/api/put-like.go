@@ -3,7 +3,6 @@ package api
 import (
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -11,54 +10,31 @@ import (
 // Function that add a like of a user to a photo
 func (rt *_router) putLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
-	photoAuthor := ps.ByName("id")
 	requestingUserId := extractBearer(r.Header.Get("Authorization"))
 	pathLikeId := ps.ByName("like_id")
 
-	// Check if the user is logged
-	if isNotLogged(requestingUserId) {
-		w.WriteHeader(http.StatusForbidden)
+	// The photo must belong to the user in the path and be visible to the requesting user (not banned by the owner,
+	// an approved follower if the owner is private)
+	photo, ok := rt.visiblePhoto(w, ps, requestingUserId, ctx, "put-like")
+	if !ok {
 		return
 	}
 
 	// User is trying to like his/her photo
-	if photoAuthor == requestingUserId {
+	if photo.Owner == requestingUserId {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Check if the requesting user wasn't banned by the photo owner
-	banned, err := rt.db.BannedUserCheck(
-		User{IdUser: requestingUserId}.ToDatabase(),
-		User{IdUser: photoAuthor}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("post-comment/db.BannedUserCheck: error executing query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if banned {
-		// User was banned by owner, can't post the comment
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
 	// Follower id is not consistent with requesting user bearer token
 	if pathLikeId != requestingUserId {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Convert the path parameters photo_id from string to int64
-	photo_id_64, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("put-like: error converting path param photo_id")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	// Insert the like in the db via db function
-	err = rt.db.LikePhoto(
-		PhotoId{IdPhoto: photo_id_64}.ToDatabase(),
+	err := rt.db.LikePhoto(
+		PhotoId{IdPhoto: int64(photo.PhotoId)}.ToDatabase(),
 		User{IdUser: pathLikeId}.ToDatabase())
 	if err != nil {
 		// ctx.Logger.WithError(err).Error("put-like: error executing insert query")
@@ -14,34 +14,12 @@ func (rt *_router) deleteComment(w http.ResponseWriter, r *http.Request, ps http
 	w.Header().Set("Content-Type", "application/json")
 	requestingUserId := extractBearer(r.Header.Get("Authorization"))
 
-	// Check if the user isn't logged
-	if isNotLogged(requestingUserId) {
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	// Check if the requesting user wasn't banned by the photo owner
-	banned, err := rt.db.BannedUserCheck(
-		User{IdUser: requestingUserId}.ToDatabase(),
-		User{IdUser: ps.ByName("id")}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("post-comment/db.BannedUserCheck: error executing query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if banned {
-		// User was banned by owner, can't post the comment
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	// Convert the photo identifier from string to int64
-	photo_id_64, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		ctx.Logger.WithError(err).Error("post-comment: failed convert photo_id to int64")
+	// The photo must belong to the user in the path and be visible to the requesting user
+	photo, ok := rt.visiblePhoto(w, ps, requestingUserId, ctx, "remove-comment")
+	if !ok {
 		return
 	}
+	photo_id_64 := int64(photo.PhotoId)
 
 	// Convert the comment identifier from string to int64
 	comment_id_64, err := strconv.ParseInt(ps.ByName("comment_id"), 10, 64)
@@ -52,7 +30,7 @@ func (rt *_router) deleteComment(w http.ResponseWriter, r *http.Request, ps http
 	}
 
 	// The comment of a user x is being removed by the author of the post
-	if ps.ByName("id") == requestingUserId {
+	if photo.Owner == requestingUserId {
 
 		err = rt.db.UncommentPhotoAuthor(
 			PhotoId{IdPhoto: photo_id_64}.ToDatabase(),
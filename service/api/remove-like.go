@@ -3,7 +3,6 @@ package api
 import (
 	"net/http"
 	"new-wasa/service/api/reqcontext"
-	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -11,47 +10,24 @@ import (
 // Function that removes a like from a photo
 func (rt *_router) deleteLike(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
-	photoAuthor := ps.ByName("id")
 	requestingUserId := extractBearer(r.Header.Get("Authorization"))
 
-	// Check if the user is logged
-	if isNotLogged(requestingUserId) {
-		w.WriteHeader(http.StatusForbidden)
+	// The photo must belong to the user in the path and be visible to the requesting user
+	photo, ok := rt.visiblePhoto(w, ps, requestingUserId, ctx, "remove-like")
+	if !ok {
 		return
 	}
 
 	// User trying to unlike his/her photo. Since it's not possibile to like it in the first
 	// place it's useless. Return to avoid doing useless operations
-	if photoAuthor == requestingUserId {
+	if photo.Owner == requestingUserId {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	// Check if the requesting user wasn't banned by the photo owner
-	banned, err := rt.db.BannedUserCheck(
-		User{IdUser: requestingUserId}.ToDatabase(),
-		User{IdUser: photoAuthor}.ToDatabase())
-	if err != nil {
-		ctx.Logger.WithError(err).Error("post-comment/db.BannedUserCheck: error executing query")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if banned {
-		// User was banned by owner, can't post the comment
-		w.WriteHeader(http.StatusForbidden)
-		return
-	}
-
-	photoIdInt, err := strconv.ParseInt(ps.ByName("photo_id"), 10, 64)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("remove-like/ParseInt: error converting photo_id to int64")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	// Insert the like in the db via db function
-	err = rt.db.UnlikePhoto(
-		PhotoId{IdPhoto: photoIdInt}.ToDatabase(),
+	err := rt.db.UnlikePhoto(
+		PhotoId{IdPhoto: int64(photo.PhotoId)}.ToDatabase(),
 		User{IdUser: requestingUserId}.ToDatabase())
 	if err != nil {
 		ctx.Logger.WithError(err).Error("remove-like/db.UnlikePhoto: error executing insert query")
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Maximum length (in characters) of the details of a report and of the notes of the moderators
+const maxReportNoteLength = 500
+
+// Reason codes of the reports
+var reportReasons = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"hate_speech":   true,
+	"nudity":        true,
+	"violence":      true,
+	"self_harm":     true,
+	"impersonation": true,
+	"other":         true,
+}
+
+// Checks the length of the details of a report or of a moderator's note, returning it trimmed
+func validReportNote(note string) (string, bool) {
+	note = strings.TrimSpace(note)
+	return note, utf8.ValidString(note) && utf8.RuneCountInString(note) <= maxReportNoteLength
+}
+
+// reportUser reports the user in the path (for example an impersonator)
+func (rt *_router) reportUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if isNotLogged(requester) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	reported := ps.ByName("id")
+	if reported == requester {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	exists, err := rt.db.CheckUser(database.User{IdUser: reported})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("reportUser: db.CheckUser error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: USER_NOT_FOUND_ERROR_MSG})
+		return
+	}
+	nickname, err := rt.db.GetNickname(database.User{IdUser: reported})
+	if err != nil {
+		ctx.Logger.WithError(err).Error("reportUser: db.GetNickname error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rt.saveReport(w, r, ctx, database.Report{Reporter: requester, TargetType: database.ReportUser, TargetId: reported,
+		ReportedUser: reported, Content: nickname}, "reportUser")
+}
+
+// reportPhoto reports a photo the requesting user can see
+func (rt *_router) reportPhoto(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+
+	photo, ok := rt.visiblePhoto(w, ps, requester, ctx, "reportPhoto")
+	if !ok {
+		return
+	}
+	if photo.Owner == requester {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rt.saveReport(w, r, ctx, database.Report{Reporter: requester, TargetType: database.ReportPhoto,
+		TargetId: strconv.Itoa(photo.PhotoId), ReportedUser: photo.Owner, Content: photo.Caption}, "reportPhoto")
+}
+
+// reportComment reports a comment the requesting user can see
+func (rt *_router) reportComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+
+	photo, ok := rt.visiblePhoto(w, ps, requester, ctx, "reportComment")
+	if !ok {
+		return
+	}
+	commentId, err := strconv.ParseInt(ps.ByName("comment_id"), 10, 64)
+	if err != nil || commentId <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	comment, err := rt.db.GetComment(database.User{IdUser: requester}, database.PhotoId{IdPhoto: int64(photo.PhotoId)},
+		database.CommentId{IdComment: commentId})
+	if errors.Is(err, database.ErrCommentNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: COMMENT_NOT_FOUND_ERROR_MSG})
+		return
+	} else if err != nil {
+		ctx.Logger.WithError(err).Error("reportComment: db.GetComment error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if comment.IdUser == requester {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rt.saveReport(w, r, ctx, database.Report{Reporter: requester, TargetType: database.ReportComment,
+		TargetId: strconv.FormatInt(comment.IdComment, 10), ReportedUser: comment.IdUser, Content: comment.Comment},
+		"reportComment")
+}
+
+// reportMessage reports a message received in a direct or group conversation of the user. A ban doesn't prevent
+// reporting the messages exchanged before it
+func (rt *_router) reportMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	w.Header().Set("Content-Type", "application/json")
+	requester := extractBearer(r.Header.Get("Authorization"))
+	if status := validateRequestingUser(ps.ByName("id"), requester); status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	messageID, err := strconv.ParseInt(ps.ByName("message_id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	report := database.Report{Reporter: requester, TargetId: strconv.FormatInt(messageID, 10)}
+	peer := ps.ByName("peer")
+	if groupID, ok := parseGroupPeer(peer); ok {
+		inGroup, err := rt.db.IsUserInGroup(groupID, database.User{IdUser: requester})
+		if err != nil {
+			ctx.Logger.WithError(err).Error("reportMessage: db.IsUserInGroup error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !inGroup {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		gm, err := rt.db.GetGroupMessageInGroup(groupID, messageID)
+		if errors.Is(err, database.ErrMessageNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			ctx.Logger.WithError(err).Error("reportMessage: db.GetGroupMessageInGroup error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		report.TargetType, report.ReportedUser, report.Content = database.ReportGroupMessage, gm.Sender, gm.Body
+	} else {
+		m, err := rt.db.GetDirectMessageInConversation(database.User{IdUser: requester}, database.User{IdUser: peer}, messageID)
+		if errors.Is(err, database.ErrMessageNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			ctx.Logger.WithError(err).Error("reportMessage: db.GetDirectMessageInConversation error")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		report.TargetType, report.ReportedUser, report.Content = database.ReportDirectMessage, m.Sender, m.Body
+	}
+	if report.ReportedUser == requester {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rt.saveReport(w, r, ctx, report, "reportMessage")
+}
+
+// saveReport reads the reason and the details of a report from the request body and saves the report, replying with
+// its identifier
+func (rt *_router) saveReport(w http.ResponseWriter, r *http.Request, ctx reqcontext.RequestContext, report database.Report, where string) {
+
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_JSON_ERROR_MSG})
+		return
+	}
+	if !reportReasons[req.Reason] {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_REPORT_REASON_ERROR_MSG})
+		return
+	}
+	details, ok := validReportNote(req.Details)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: INVALID_NOTE_ERROR_MSG})
+		return
+	}
+	report.Reason, report.Details = req.Reason, details
+
+	id, err := rt.db.CreateReport(report)
+	if err != nil {
+		ctx.Logger.WithError(err).Error(where + ": db.CreateReport error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ReportId{IdReport: id})
+}
@@ -4,11 +4,42 @@ import (
 	"encoding/json"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
+	"new-wasa/service/database"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// Function that retrives all the users matching the query parameter and sends the response containing all the matches
+// Maximum length of the text of a user search
+const maxUserSearchLength = 32
+
+// usersPage is a page of the users found by a search
+type usersPage struct {
+	Users      []database.UserSearchResult `json:"users"`
+	NextCursor string                      `json:"next_cursor,omitempty"` // Missing on the last page
+}
+
+// Function that reads the cursor of a user search: the relevance and the identifier of the last user of the previous
+// page, separated by ":" (empty for the first page). Returns false if it's not valid
+func parseUserSearchCursor(cursor string) (int, string, bool) {
+	if cursor == "" {
+		return 0, "", true
+	}
+	sep := strings.Index(cursor, ":")
+	if sep < 0 || sep == len(cursor)-1 {
+		return 0, "", false
+	}
+	n, err := strconv.Atoi(cursor[:sep])
+	if err != nil {
+		return 0, "", false
+	}
+	return n, cursor[sep+1:], true
+}
+
+// Function that retrieves a page of the users matching the query parameter q, best match first. People followed by
+// the requesting user and exact matches rank first
 func (rt *_router) getUsersQuery(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
 
 	w.Header().Set("Content-Type", "application/json")
@@ -17,33 +48,44 @@ func (rt *_router) getUsersQuery(w http.ResponseWriter, r *http.Request, ps http
 	identifier := extractBearer(r.Header.Get("Authorization"))
 
 	// If the user is not logged in then respond with a 403 http status
-	if identifier == "" {
+	if isNotLogged(identifier) {
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	// Extract the query parameter from the URL
-	identificator := r.URL.Query().Get("id")
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxUserSearchLength {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimitParam(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	afterScore, afterId, ok := parseUserSearchCursor(r.URL.Query().Get("cursor"))
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-	// Search the user in the database (with the query parameter as a filter)
-	res, err := rt.db.SearchUser(User{IdUser: identifier}.ToDatabase(), User{IdUser: identificator}.ToDatabase())
+	// One extra user is loaded to know if there's a next page
+	users, err := rt.db.SearchUser(User{IdUser: identifier}.ToDatabase(), q, afterScore, afterId, limit+1)
 	if err != nil {
-		// In this case, there's an error coming from the database. Return an empty json
+		ctx.Logger.WithError(err).Error("getUsersQuery: db.SearchUser error")
 		w.WriteHeader(http.StatusInternalServerError)
-		ctx.Logger.WithError(err).Error("Database has encountered an error")
-		// controllaerrore
-		_ = json.NewEncoder(w).Encode([]User{})
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	page := usersPage{Users: users}
+	if len(users) > limit {
+		last := users[limit-1]
+		page.Users = users[:limit]
+		page.NextCursor = strconv.Itoa(last.Score) + ":" + last.IdUser
+	}
 
-	// Send the output to the user. Instead of giving null for no matches return and empty slice of Users
-	if len(res) == 0 {
-		// controllaerrore
-		_ = json.NewEncoder(w).Encode([]User{})
-		return
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		ctx.Logger.WithError(err).Error("getUsersQuery/Encode: failed to encode users json")
 	}
-	// controllaerrore
-	_ = json.NewEncoder(w).Encode(res)
 }
@@ -8,8 +8,6 @@ import (
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -46,6 +44,17 @@ func (rt *_router) sessionHandler(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 	if found {
+		suspended, err := rt.db.IsSuspended(existingUser)
+		if err != nil {
+			ctx.Logger.WithError(err).Error("session: error checking the suspension")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if suspended {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: ACCOUNT_SUSPENDED_ERROR_MSG})
+			return
+		}
 		w.WriteHeader(http.StatusCreated)
 		_ = json.NewEncoder(w).Encode(loginResponse{Identifier: existingUser.IdUser})
 		return
@@ -72,14 +81,6 @@ func (rt *_router) sessionHandler(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	// Create user's directories locally
-	err = createUserFolder(newIdentifier, ctx)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("session: can't create user's photo folder")
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(loginResponse{Identifier: newIdentifier})
 }
@@ -111,18 +112,3 @@ func randomIdentifier16() (string, error) {
 	}
 	return hex.EncodeToString(b), nil
 }
-
-// Function that creates a new subdir for the specified user
-func createUserFolder(identifier string, ctx reqcontext.RequestContext) error {
-
-	// Create the path media/useridentifier/ inside the project dir
-	path := filepath.Join(photoFolder, identifier)
-
-	// To the previously created path add the "photos" subdir
-	err := os.MkdirAll(filepath.Join(path, "photos"), os.ModePerm)
-	if err != nil {
-		ctx.Logger.WithError(err).Error("session/createUserFolder:: error creating directories for user")
-		return err
-	}
-	return nil
-}
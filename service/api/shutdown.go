@@ -2,5 +2,10 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	if rt.linkPreviews != nil {
+		rt.linkPreviews.close()
+	}
+	rt.mediaRemovals.close()
+	rt.dataExports.close()
 	return nil
 }
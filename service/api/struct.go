@@ -10,8 +10,37 @@ const INTERNAL_ERROR_MSG = "internal server error"
 const PNG_ERROR_MSG = "file is not a png format"
 const JPG_ERROR_MSG = "file is not a jpg format"
 const IMG_FORMAT_ERROR_MSG = "images must be jpeg or png"
+const MEDIA_FORMAT_ERROR_MSG = "media must be jpeg or png images, gif animations or mp4 or webm videos"
+const MEDIA_TOO_LARGE_ERROR_MSG = "media file is too large"
+const MEDIA_TOO_LONG_ERROR_MSG = "video or animation is too long"
+const MEDIA_DURATION_ERROR_MSG = "video must declare its duration"
+const IMAGE_TOO_LARGE_ERROR_MSG = "image dimensions are too large"
+const UPLOAD_MISSING_ERROR_MSG = "upload contains no file"
+const UPLOAD_BODY_ERROR_MSG = "upload body is malformed or truncated"
+const TOO_MANY_MEDIA_ERROR_MSG = "post contains too many media items"
 const INVALID_JSON_ERROR_MSG = "invalid json format"
 const INVALID_IDENTIFIER_ERROR_MSG = "identifier must be a string between 3 and 16 characters"
+const INVALID_REACTION_ERROR_MSG = "reaction must be a single emoji"
+const POLL_CLOSED_ERROR_MSG = "poll is closed"
+const INVALID_CAPTION_ERROR_MSG = "caption must be at most 1000 characters"
+const INVALID_COMMENT_ERROR_MSG = "comment must not be empty and must be at most %d characters" // Formatted with the limit
+const COMMENT_NOT_FOUND_ERROR_MSG = "comment not found"
+const PRIVATE_ACCOUNT_ERROR_MSG = "account is private"
+const USER_NOT_FOUND_ERROR_MSG = "user not found"
+const BANNED_USER_ERROR_MSG = "one of the users banned the other"
+const MESSAGES_NOT_ALLOWED_ERROR_MSG = "user doesn't accept messages from you"
+const INVALID_MESSAGES_FROM_ERROR_MSG = "messages_from must be everyone, following or nobody"
+const INVALID_REPORT_REASON_ERROR_MSG = "reason must be spam, harassment, hate_speech, nudity, violence, self_harm, impersonation or other"
+const INVALID_NOTE_ERROR_MSG = "details and notes must be at most 500 characters"
+const NOT_MODERATOR_ERROR_MSG = "only moderators can do this"
+const ACCOUNT_SUSPENDED_ERROR_MSG = "account is suspended"
+const INVALID_MODERATION_ACTION_ERROR_MSG = "action must be dismiss, remove_content or suspend (users can't be removed)"
+const REPORT_RESOLVED_ERROR_MSG = "report already resolved"
+const EXPORT_QUEUE_FULL_ERROR_MSG = "too many data exports in progress, try again later"
+const INVALID_DISPLAY_NAME_ERROR_MSG = "display name must be at most 32 characters, without control characters"
+const INVALID_BIO_ERROR_MSG = "bio must be at most 160 characters"
+const INVALID_WEBSITE_ERROR_MSG = "website must be an http or https link of at most 200 characters"
+const DELETION_NOT_CONFIRMED_ERROR_MSG = "the nickname doesn't match: type your nickname to confirm the deletion"
 
 // JSON Error Structure
 type JSONErrorMsg struct {
@@ -25,6 +54,10 @@ type Photo struct {
 	Owner    string                     `json:"owner"`    // Unique id of the owner
 	PhotoId  int                        `json:"photo_id"` // Unique id of the photo
 	Date     time.Time                  `json:"date"`     // Date in which the photo was uploaded
+	Caption  string                     `json:"caption"`  // Caption of the photo (may contain #hashtags)
+
+	MediaType string               `json:"media_type"` // Media type of the cover (the first item)
+	Media     []database.MediaItem `json:"media"`      // Media items of the post, in order
 }
 
 // User structure for the APIs
@@ -44,7 +77,8 @@ type Nickname struct {
 
 // Comment structure for the APIs
 type Comment struct {
-	Comment string `json:"comment"` // Comment content
+	Comment  string `json:"comment"`             // Comment content
+	ParentId int64  `json:"parent_id,omitempty"` // Comment replied to (missing for top-level comments)
 }
 
 // CommentId structure for the APIs
@@ -63,11 +97,70 @@ type CompleteComment struct {
 
 // CompleteProfile structure for the APIs
 type CompleteProfile struct {
-	Name      string           `json:"user_id"`
-	Nickname  string           `json:"nickname"`
-	Followers []database.User  `json:"followers"`
-	Following []database.User  `json:"following"`
-	Posts     []database.Photo `json:"posts"`
+	Name        string `json:"user_id"`
+	Nickname    string `json:"nickname"`
+	DisplayName string `json:"display_name"` // Empty if not set
+	Bio         string `json:"bio"`
+	Website     string `json:"website"`
+
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	PhotosCount    int `json:"photos_count"`
+
+	Private      bool   `json:"private"`       // True if the account is private
+	FollowStatus string `json:"follow_status"` // Follow status of the requesting user towards the profile
+	Muted        bool   `json:"muted"`         // True if the requesting user muted the profile
+	Restricted   bool   `json:"restricted"`    // True if the requesting user restricted the profile
+	Moderator    bool   `json:"moderator"`     // True if the profile is of a moderator
+}
+
+// ProfileInfo structure for the APIs (the fields missing from the body are left unchanged)
+type ProfileInfo struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Website     *string `json:"website"`
+}
+
+// FollowStatus structure for the APIs
+type FollowStatus struct {
+	Status string `json:"status"` // One of database.FollowStatusNone, FollowStatusPending, FollowStatusFollowing
+}
+
+// Privacy structure for the APIs
+type Privacy struct {
+	Private bool `json:"private"` // True if the account is private
+}
+
+// MessagePrivacy structure for the APIs
+type MessagePrivacy struct {
+	MessagesFrom string `json:"messages_from"` // One of database.MessagesFromEveryone, MessagesFromFollowing, MessagesFromNobody
+}
+
+// MessageStatus structure for the APIs
+type MessageStatus struct {
+	Status string `json:"status"` // database.DirectMessageRequest if the message is waiting in the receiver's message requests
+}
+
+// ReportRequest structure for the APIs
+type ReportRequest struct {
+	Reason  string `json:"reason"`  // Reason code (see reportReasons)
+	Details string `json:"details"` // Optional explanation
+}
+
+// ReportId structure for the APIs
+type ReportId struct {
+	IdReport int64 `json:"report_id"` // Identifier of the report
+}
+
+// ModerationDecision structure for the APIs
+type ModerationDecision struct {
+	Action string `json:"action"` // One of database.ModerationDismiss, ModerationRemoveContent, ModerationSuspend
+	Note   string `json:"note"`   // Optional note for the moderation log
+}
+
+// Suspension structure for the APIs
+type Suspension struct {
+	Note string `json:"note"` // Optional note for the moderation log
 }
 
 // Converts a User from the api package to a User of the database package
@@ -85,6 +178,10 @@ func (p Photo) ToDatabase() database.Photo {
 		Owner:    p.Owner,
 		PhotoId:  p.PhotoId,
 		Date:     p.Date,
+		Caption:  p.Caption,
+
+		MediaType: p.MediaType,
+		Media:     p.Media,
 	}
 }
 
@@ -105,7 +202,8 @@ func (n Nickname) ToDatabase() database.Nickname {
 // Converts a Comment from the api package to a Comment of the database package
 func (c Comment) ToDatabase() database.Comment {
 	return database.Comment{
-		Comment: c.Comment,
+		Comment:  c.Comment,
+		ParentId: c.ParentId,
 	}
 }
 
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"new-wasa/service/api/reqcontext"
+	"os"
+)
+
+// Errors of the uploads. Their messages are returned to the client
+var errUploadMissing = errors.New(UPLOAD_MISSING_ERROR_MSG)
+var errUploadBody = errors.New(UPLOAD_BODY_ERROR_MSG)
+var errImageTooLarge = errors.New(IMAGE_TOO_LARGE_ERROR_MSG)
+var errImageFormat = errors.New(IMG_FORMAT_ERROR_MSG)
+var errTooManyMedia = errors.New(TOO_MANY_MEDIA_ERROR_MSG)
+
+// Formats accepted by the upload endpoints
+var imageFormats = []string{formatJPEG, formatPNG}
+var postFormats = []string{formatJPEG, formatPNG, formatGIF, formatMP4, formatWebM}
+
+// Room for the framing and the other fields of a multipart upload, on top of the size of the file
+const uploadOverhead = 1 << 20
+
+// Maximum size of the fields (other than the file) of a multipart upload
+const maxUploadFieldSize = 64 << 10
+
+// upload is a file received by an upload endpoint, spooled to a temporary file
+type upload struct {
+	file   *os.File
+	size   int64
+	format string // As returned by sniffMediaFormat
+}
+
+// Function that returns a reader of the whole uploaded file
+func (u *upload) reader() *io.SectionReader {
+	return io.NewSectionReader(u.file, 0, u.size)
+}
+
+// Function that removes the temporary file of the upload
+func (u *upload) Close() error {
+	err := u.file.Close()
+	if removeErr := os.Remove(u.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// countingReader counts the bytes read from the body of a request
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Function that receives the file of an upload: the raw body or, with a multipart body, the part named filePart (the
+// other parts are returned as form values). The file must be in one of formats, sniffed from its first bytes, and
+// within the size limit of its format: the body is cut at the largest limit, so that oversized uploads are never read
+// entirely. Images must also be within the pixel limit, checked from their header before decoding them. The caller
+// must close the upload
+func (rt *_router) receiveUpload(w http.ResponseWriter, r *http.Request, filePart string, formats []string) (*upload, map[string]string, error) {
+	uploads, values, err := rt.receiveUploads(w, r, filePart, formats, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return uploads[0], values, nil
+}
+
+// Function that receives the files of an upload like receiveUpload, except that a multipart body may contain up to
+// maxFiles parts named filePart, returned in order. The body is cut at maxFiles times the largest limit. The caller
+// must close the uploads (closeUploads)
+func (rt *_router) receiveUploads(w http.ResponseWriter, r *http.Request, filePart string, formats []string, maxFiles int) ([]*upload, map[string]string, error) {
+	// The timeouts of the server are meant for the other requests: large uploads (and the posters of their videos)
+	// need more time
+	extendDeadlines(r, rt.mediaLimits.timeout)
+
+	var maxSize int64
+	for _, format := range formats {
+		if size := rt.mediaLimits.maxSize(format); size > maxSize {
+			maxSize = size
+		}
+	}
+	maxBody := maxSize*int64(maxFiles) + uploadOverhead
+	body := &countingReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxBody)}
+	r.Body = body
+
+	// Errors reading the body are due to the client: the limit, or a truncated or malformed body
+	bodyError := func() error {
+		if body.n >= maxBody {
+			return errMediaTooLarge
+		}
+		return errUploadBody
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		u, err := rt.spoolUpload(r.Body, formats)
+		if errors.Is(err, errUploadBody) {
+			return nil, nil, bodyError()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*upload{u}, nil, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errUploadBody
+	}
+	var uploads []*upload
+	values := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			closeUploads(uploads)
+			return nil, nil, bodyError()
+		}
+
+		if part.FormName() == filePart {
+			if len(uploads) == maxFiles {
+				closeUploads(uploads)
+				return nil, nil, errTooManyMedia
+			}
+			var u *upload
+			u, err = rt.spoolUpload(part, formats)
+			if err == nil {
+				uploads = append(uploads, u)
+			}
+		} else {
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, maxUploadFieldSize+1))
+			if err != nil || len(value) > maxUploadFieldSize {
+				err = errUploadBody
+			}
+			values[part.FormName()] = string(value)
+		}
+		if err != nil {
+			if errors.Is(err, errUploadBody) {
+				err = bodyError()
+			}
+			closeUploads(uploads)
+			return nil, nil, err
+		}
+	}
+	if len(uploads) == 0 {
+		return nil, nil, errUploadMissing
+	}
+	return uploads, values, nil
+}
+
+// Function that closes the uploads received by receiveUploads
+func closeUploads(uploads []*upload) {
+	for _, u := range uploads {
+		_ = u.Close()
+	}
+}
+
+// Function that copies an uploaded file to a temporary file, checking its format and its size limit as it's read
+func (rt *_router) spoolUpload(src io.Reader, formats []string) (*upload, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(src, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, errUploadBody
+	}
+	head = head[:n]
+
+	// Endpoints that accept only images say so
+	formatError := errImageFormat
+	for _, f := range formats {
+		if f != formatJPEG && f != formatPNG {
+			formatError = errMediaFormat
+		}
+	}
+	format := sniffMediaFormat(head)
+	allowed := false
+	for _, f := range formats {
+		allowed = allowed || f == format
+	}
+	if !allowed {
+		return nil, formatError
+	}
+	maxSize := rt.mediaLimits.maxSize(format)
+
+	file, err := os.CreateTemp("", "wasa-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	u := &upload{file: file, format: format}
+	if _, err := file.Write(head); err != nil {
+		_ = u.Close()
+		return nil, err
+	}
+	// One byte more than the limit tells an oversized file from one of the maximum size
+	copied, err := io.Copy(file, io.LimitReader(src, maxSize-int64(len(head))+1))
+	u.size = int64(len(head)) + copied
+	if err != nil {
+		_ = u.Close()
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			// Writing the temporary file failed
+			return nil, err
+		}
+		return nil, errUploadBody
+	}
+	if u.size > maxSize {
+		_ = u.Close()
+		return nil, errMediaTooLarge
+	}
+
+	if format == formatJPEG || format == formatPNG || format == formatGIF {
+		config, _, err := image.DecodeConfig(u.reader())
+		if err != nil {
+			_ = u.Close()
+			return nil, formatError
+		}
+		if int64(config.Width)*int64(config.Height) > rt.mediaLimits.maxPixels {
+			_ = u.Close()
+			return nil, errImageTooLarge
+		}
+	}
+	return u, nil
+}
+
+// Function that checks if an error is one of the errors of the uploads returned to the client
+func isUploadError(err error) bool {
+	for _, e := range []error{errUploadMissing, errUploadBody, errImageTooLarge, errImageFormat, errMediaFormat,
+		errMediaTooLarge, errMediaTooLong, errMediaDuration, errTooManyMedia} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function that replies to a failed upload: 413 if the file exceeds a limit, 400 for the other errors of the client
+// and 500 otherwise
+func writeUploadError(w http.ResponseWriter, err error, ctx reqcontext.RequestContext, where string) {
+	switch {
+	case errors.Is(err, errMediaTooLarge) || errors.Is(err, errImageTooLarge):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: err.Error()})
+	case isUploadError(err):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(JSONErrorMsg{Message: err.Error()})
+	default:
+		ctx.Logger.WithError(err).Error(where + ": error receiving the upload")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
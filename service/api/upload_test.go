@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"new-wasa/service/api/reqcontext"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Limits of the uploads in the tests
+var testUploadLimits = mediaLimits{
+	maxImageSize: 4 << 10,
+	maxGIFSize:   2 << 10,
+	maxVideoSize: 8 << 10,
+	maxPixels:    100 * 100,
+}
+
+// Returns a w x h PNG image padded with zeros up to size bytes (if it's shorter)
+func paddedPNG(t *testing.T, w int, h int, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() < size {
+		buf.Write(make([]byte, size-buf.Len()))
+	}
+	return buf.Bytes()
+}
+
+func paddedMP4(size int) []byte {
+	data := concat(mp4FileType, mp4Box("moov", mvhd(0, 1000, 1000)))
+	return append(data, make([]byte, size-len(data))...)
+}
+
+func TestSpoolUpload(t *testing.T) {
+	rt := &_router{mediaLimits: testUploadLimits}
+	var smallGIF bytes.Buffer
+	if err := gif.Encode(&smallGIF, image.NewPaletted(image.Rect(0, 0, 4, 4), []color.Color{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		src     io.Reader
+		formats []string
+		format  string
+		size    int
+		err     error
+	}{
+		{name: "image at the limit", src: bytes.NewReader(paddedPNG(t, 10, 10, 4<<10)), formats: imageFormats, format: formatPNG, size: 4 << 10},
+		{name: "image over the limit", src: bytes.NewReader(paddedPNG(t, 10, 10, 4<<10+1)), formats: imageFormats, err: errMediaTooLarge},
+		{name: "image with too many pixels", src: bytes.NewReader(paddedPNG(t, 101, 100, 0)), formats: imageFormats, err: errImageTooLarge},
+		{name: "gif", src: bytes.NewReader(smallGIF.Bytes()), formats: postFormats, format: formatGIF, size: smallGIF.Len()},
+		{name: "gif where only images are accepted", src: bytes.NewReader(smallGIF.Bytes()), formats: imageFormats, err: errImageFormat},
+		{name: "video over the image limit", src: bytes.NewReader(paddedMP4(8 << 10)), formats: postFormats, format: formatMP4, size: 8 << 10},
+		{name: "video over the video limit", src: bytes.NewReader(paddedMP4(8<<10 + 1)), formats: postFormats, err: errMediaTooLarge},
+		{name: "unknown format", src: strings.NewReader("plain text"), formats: postFormats, err: errMediaFormat},
+		{name: "empty file", src: strings.NewReader(""), formats: imageFormats, err: errImageFormat},
+		{name: "truncated image header", src: bytes.NewReader(paddedPNG(t, 10, 10, 0)[:20]), formats: imageFormats, err: errImageFormat},
+		{name: "body error", src: io.MultiReader(bytes.NewReader(paddedMP4(1024)), iotest.ErrReader(errors.New("reset"))), formats: postFormats, err: errUploadBody},
+		{name: "body error before the format", src: iotest.ErrReader(errors.New("reset")), formats: postFormats, err: errUploadBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := rt.spoolUpload(tt.src, tt.formats)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("spoolUpload error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("spoolUpload error = %v", err)
+			}
+			defer func() { _ = u.Close() }()
+			if u.format != tt.format || u.size != int64(tt.size) {
+				t.Errorf("spoolUpload = %s of %d bytes, want %s of %d bytes", u.format, u.size, tt.format, tt.size)
+			}
+			if info, err := u.file.Stat(); err != nil || info.Size() != u.size {
+				t.Errorf("temporary file size = %v, %v", info.Size(), err)
+			}
+		})
+	}
+}
+
+// Builds a multipart body with the given parts, in order: file parts are named "photo"
+func multipartBody(t *testing.T, parts ...interface{}) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, part := range parts {
+		switch p := part.(type) {
+		case []byte:
+			w, err := mw.CreateFormFile("photo", "file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = w.Write(p)
+		case [2]string:
+			_ = mw.WriteField(p[0], p[1])
+		}
+	}
+	_ = mw.Close()
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestReceiveUploads(t *testing.T) {
+	rt := &_router{mediaLimits: testUploadLimits}
+	photo := paddedPNG(t, 10, 10, 1024)
+	video := paddedMP4(2048)
+
+	type uploadTest struct {
+		name        string
+		contentType string
+		body        []byte
+		files       int
+		status      int
+		err         error
+	}
+	multipartTest := func(name string, files int, status int, err error, parts ...interface{}) uploadTest {
+		contentType, body := multipartBody(t, parts...)
+		return uploadTest{name: name, contentType: contentType, body: body, files: files, status: status, err: err}
+	}
+
+	// Fields over the overhead allowed for the multipart framing
+	var fields []interface{}
+	for i := 0; i*maxUploadFieldSize <= uploadOverhead; i++ {
+		fields = append(fields, [2]string{"caption", strings.Repeat("a", maxUploadFieldSize)})
+	}
+	truncated := multipartTest("truncated multipart", 0, http.StatusBadRequest, errUploadBody, photo)
+	truncated.body = truncated.body[:len(truncated.body)-10]
+
+	tests := []uploadTest{
+		{name: "raw body", contentType: "image/png", body: photo, files: 1},
+		{name: "raw body over the limit", contentType: "image/png", body: paddedPNG(t, 10, 10, 5<<10), status: http.StatusRequestEntityTooLarge, err: errMediaTooLarge},
+		{name: "too many pixels", contentType: "image/png", body: paddedPNG(t, 200, 200, 0), status: http.StatusRequestEntityTooLarge, err: errImageTooLarge},
+		{name: "wrong format", contentType: "image/png", body: []byte("text"), status: http.StatusBadRequest, err: errMediaFormat},
+		multipartTest("multipart with fields", 2, 0, nil, [2]string{"caption", "hi"}, photo, video),
+		multipartTest("body over the limit", 0, http.StatusRequestEntityTooLarge, errMediaTooLarge, append(fields, photo)...),
+		multipartTest("too many files", 0, http.StatusBadRequest, errTooManyMedia, photo, video, photo),
+		multipartTest("missing file", 0, http.StatusBadRequest, errUploadMissing, [2]string{"caption", "hi"}),
+		multipartTest("field too large", 0, http.StatusBadRequest, errUploadBody, [2]string{"caption", strings.Repeat("a", maxUploadFieldSize+1)}, photo),
+		multipartTest("file over its limit", 0, http.StatusRequestEntityTooLarge, errMediaTooLarge, paddedMP4(8<<10+1)),
+		truncated,
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/users/u/photos", bytes.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			uploads, _, err := rt.receiveUploads(w, r, "photo", postFormats, 2)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("receiveUploads error = %v", err)
+				}
+				defer closeUploads(uploads)
+				if len(uploads) != tt.files {
+					t.Errorf("receiveUploads = %d uploads, want %d", len(uploads), tt.files)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("receiveUploads error = %v, want %v", err, tt.err)
+			}
+
+			writeUploadError(w, err, reqcontext.RequestContext{Logger: logger}, "test")
+			var reply JSONErrorMsg
+			if w.Code != tt.status || json.NewDecoder(w.Body).Decode(&reply) != nil || reply.Message != tt.err.Error() {
+				t.Errorf("reply = %d %q, want %d %q", w.Code, reply.Message, tt.status, tt.err.Error())
+			}
+		})
+	}
+}
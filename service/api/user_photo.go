@@ -2,12 +2,9 @@ package api
 
 import (
 	"errors"
-	"io"
 	"net/http"
 	"new-wasa/service/api/reqcontext"
 	"new-wasa/service/database"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -21,45 +18,41 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, ps httprou
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
+	// The photo is received in a temporary file, within the limits of the images
+	upload, _, err := rt.receiveUpload(w, r, "photo", imageFormats)
 	if err != nil {
-		ctx.Logger.WithError(err).Error("setMyPhoto: error reading body")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeUploadError(w, err, ctx, "setMyPhoto")
 		return
 	}
-	contentType := http.DetectContentType(data)
-	ext := ""
-	switch contentType {
-	case "image/jpeg":
-		ext = "jpg"
-	case "image/png":
+	defer func() { _ = upload.Close() }()
+	ext := "jpg"
+	if upload.format == formatPNG {
 		ext = "png"
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		return
 	}
 
-	userDir := filepath.Join(photoFolder, requester)
-	if err := os.MkdirAll(userDir, os.ModePerm); err != nil {
-		ctx.Logger.WithError(err).Error("setMyPhoto: error creating user dir")
+	// Every version of the photo has its own key: the new file is saved before the database points to it
+	relPath, err := newMediaVersionKey(requester, "avatar", ext)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("setMyPhoto: error generating the media key")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	filename := "avatar." + ext
-	fullPath := filepath.Join(userDir, filename)
-	if err := os.WriteFile(fullPath, data, 0o644); err != nil {
-		ctx.Logger.WithError(err).Error("setMyPhoto: error writing file")
+	if err := rt.media.Put(r.Context(), relPath, upload.reader(), upload.size); err != nil {
+		ctx.Logger.WithError(err).Error("setMyPhoto: error saving file")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	relPath := filepath.Join(requester, filename)
-	err = rt.db.SetUserPhotoPath(database.User{IdUser: requester}, relPath)
+	previous, err := rt.db.SetUserPhotoPath(database.User{IdUser: requester}, relPath)
 	if err != nil {
 		ctx.Logger.WithError(err).Error("setMyPhoto: db.SetUserPhotoPath error")
+		rt.removeMedia(relPath, ctx)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if previous != "" && previous != relPath {
+		rt.removeMedia(previous, ctx)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -104,5 +97,5 @@ func (rt *_router) getUserPhoto(w http.ResponseWriter, r *http.Request, ps httpr
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	http.ServeFile(w, r, filepath.Join(photoFolder, photoPath))
+	rt.serveMedia(w, r, photoPath, rt.downloadTimeout, ctx)
 }
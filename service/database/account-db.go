@@ -0,0 +1,58 @@
+package database
+
+import (
+	"time"
+)
+
+// Database function that deletes a user. The rows of the user are removed by the ON DELETE CASCADE of the foreign
+// keys: only the tables without a foreign key to users need explicit statements
+func (db *appdbimpl) DeleteUser(u User, anonymizeGroupMessages bool) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if anonymizeGroupMessages {
+		_, err = tx.Exec("INSERT OR IGNORE INTO users (id_user, nickname, suspended_at) VALUES (?, ?, ?)",
+			DeletedUserId, DeletedUserNickname, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE group_messages SET sender = ? WHERE sender = ?", DeletedUserId, u.IdUser)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The messages removed by the user as a moderator must stay removed: the removals are attributed to the senders
+	_, err = tx.Exec("UPDATE direct_message_deletions SET deleted_by = "+
+		"(SELECT m.sender FROM messages m WHERE m.id = message_id) WHERE deleted_by = ?", u.IdUser)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE group_message_deletions SET deleted_by = "+
+		"(SELECT m.sender FROM group_messages m WHERE m.id = message_id) WHERE deleted_by = ?", u.IdUser)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM likes WHERE id_user = ?", u.IdUser)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM users WHERE id_user = ?", u.IdUser)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return tx.Commit()
+}
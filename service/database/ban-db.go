@@ -1,14 +1,41 @@
 package database
 
-// Database fuction that allows a user (banner) to ban another one (banned)
+// Database fuction that allows a user (banner) to ban another one (banned). The follows, the follow requests and the
+// message requests between the two are removed in both directions
 func (db *appdbimpl) BanUser(banner User, banned User) error {
 
-	_, err := db.c.Exec("INSERT INTO banned_users (banner,banned) VALUES (?, ?)", banner.IdUser, banned.IdUser)
+	tx, err := db.c.Begin()
 	if err != nil {
 		return err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	return nil
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id_user = ?)", banned.IdUser).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO banned_users (banner,banned) VALUES (?, ?)", banner.IdUser, banned.IdUser)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM followers WHERE (follower = ? AND followed = ?) OR (follower = ? AND followed = ?)",
+		"DELETE FROM follow_requests WHERE (requester = ? AND target = ?) OR (requester = ? AND target = ?)",
+		"DELETE FROM message_requests WHERE (sender = ? AND receiver = ?) OR (sender = ? AND receiver = ?)",
+	} {
+		_, err = tx.Exec(stmt, banner.IdUser, banned.IdUser, banned.IdUser, banner.IdUser)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Database fuction that removes a user (banned) from the banned list of another one (banner)
@@ -40,3 +67,22 @@ func (db *appdbimpl) BannedUserCheck(requestingUser User, targetUser User) (bool
 	}
 	return false, nil
 }
+
+// [Util] Database fuction that checks if one of the two users banned the other
+func (db *appdbimpl) BanBetween(a User, b User) (bool, error) {
+
+	var banned bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 FROM banned_users "+
+		"WHERE (banner = ? AND banned = ?) OR (banner = ? AND banned = ?))",
+		a.IdUser, b.IdUser, b.IdUser, a.IdUser).Scan(&banned)
+	if err != nil {
+		return true, err
+	}
+	return banned, nil
+}
+
+// Database function that retrieves the users banned by a user, ordered by nickname
+func (db *appdbimpl) GetBannedUsers(banner User) ([]CompleteUser, error) {
+	return db.listRelationship("SELECT u.id_user, u.nickname FROM banned_users b "+
+		"INNER JOIN users u ON u.id_user = b.banned WHERE b.banner = ? ORDER BY u.nickname", banner)
+}
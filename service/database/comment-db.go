@@ -1,41 +1,96 @@
 package database
 
-// Database function that retrieves the list of comments of a photo (minus the comments from users that banned the requesting user)
-func (db *appdbimpl) GetCompleteCommentsList(requestingUser User, requestedUser User, photo PhotoId) ([]CompleteComment, error) {
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
 
-	rows, err := db.c.Query("SELECT * FROM comments WHERE id_photo = ? AND id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ? OR banner = ?) "+
-		"AND id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?)",
-		photo.IdPhoto, requestingUser.IdUser, requestedUser.IdUser, requestingUser.IdUser)
+// Columns of a CompleteComment (see scanComment) for the requesting user. The query must join the comment (x) with its
+// photo (p) and its author (u), and pass commentColumnsArgs before the other arguments
+const commentColumns = "SELECT x.id_comment, x.id_photo, x.id_user, u.nickname, x.comment, x.id_parent, x.date, x.edited_at, " +
+	"(SELECT COUNT(*) FROM comment_likes l WHERE l.id_comment = x.id_comment), " +
+	"EXISTS (SELECT 1 FROM comment_likes l WHERE l.id_comment = x.id_comment AND l.id_user = ?), " +
+	"x.approved = 0 AND p.id_user = ?, " +
+	"(SELECT COUNT(*) FROM comments r WHERE r.id_parent = x.id_comment " +
+	"AND r.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ? OR banner = p.id_user) " +
+	"AND r.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) " +
+	"AND (r.approved = 1 OR r.id_user = ? OR p.id_user = ?)) " +
+	"FROM comments x " +
+	"INNER JOIN photos p ON p.id_photo = x.id_photo " +
+	"INNER JOIN users u ON u.id_user = x.id_user "
+
+// Arguments of commentColumns for the requesting user
+func commentColumnsArgs(requestingUser User) []interface{} {
+	return []interface{}{requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser,
+		requestingUser.IdUser, requestingUser.IdUser}
+}
+
+// Filter of the comments of banned users: the ones banned by the requesting user or by the owner of the photo, and the
+// ones that banned the requesting user. It needs the requesting user twice
+const commentBanFilter = "AND x.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ? OR banner = p.id_user) " +
+	"AND x.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) "
+
+// Filter of the comments of restricted users waiting for the approval of the owner of the photo: only their author and
+// the owner see them. It needs the requesting user twice
+const commentRestrictFilter = "AND (x.approved = 1 OR x.id_user = ? OR p.id_user = ?) "
+
+// Rows of a comment of a photo, if the requesting user can see it (see GetComment). Its arguments are visibleCommentArgs
+const visibleComment = "FROM comments x INNER JOIN photos p ON p.id_photo = x.id_photo " +
+	"WHERE x.id_photo = ? AND x.id_comment = ? " + commentBanFilter + commentRestrictFilter
+
+// Arguments of visibleComment
+func visibleCommentArgs(requestingUser User, p PhotoId, c CommentId) []interface{} {
+	return []interface{}{p.IdPhoto, c.IdComment, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser,
+		requestingUser.IdUser}
+}
+
+// Scans a row of commentColumns
+func scanComment(rows interface{ Scan(...interface{}) error }) (CompleteComment, error) {
+	var comment CompleteComment
+	var parent sql.NullInt64
+	var editedAt sql.NullTime
+	err := rows.Scan(&comment.IdComment, &comment.IdPhoto, &comment.IdUser, &comment.Nickname, &comment.Comment,
+		&parent, &comment.Date, &editedAt, &comment.LikesCount, &comment.LikedByMe, &comment.Pending, &comment.RepliesCount)
+	if parent.Valid {
+		comment.ParentId = &parent.Int64
+	}
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	return comment, err
+}
+
+// Database function that retrieves a page of the top-level comments of a photo, or of the replies of a comment
+func (db *appdbimpl) GetCommentsPage(requestingUser User, photo PhotoId, parent CommentId, afterId int64, limit int) ([]CompleteComment, error) {
+
+	args := append(commentColumnsArgs(requestingUser),
+		photo.IdPhoto, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, afterId)
+	parentFilter := "AND x.id_parent IS NULL "
+	if parent.IdComment != 0 {
+		parentFilter = "AND x.id_parent = ? "
+		args = append(args, parent.IdComment)
+	}
+	args = append(args, limit)
+
+	rows, err := db.c.Query(commentColumns+"WHERE x.id_photo = ? "+commentBanFilter+commentRestrictFilter+
+		"AND x.id_comment > ? "+parentFilter+"ORDER BY x.id_comment LIMIT ?", args...)
 	if err != nil {
 		return nil, err
 	}
-
-	// Wait for the function to finish before closing rows
 	defer func() { _ = rows.Close() }()
 
-	// Read all the comments in the resulset (comments of the photo with authors that didn't ban the requesting user).
-	var comments []CompleteComment
+	comments := make([]CompleteComment, 0, limit)
 	for rows.Next() {
-		var comment CompleteComment
-		err = rows.Scan(&comment.IdComment, &comment.IdPhoto, &comment.IdUser, &comment.Comment)
-		if err != nil {
-			return nil, err
-		}
-
-		// Get the nickname of the user that commented
-		nickname, err := db.GetNickname(User{IdUser: comment.IdUser})
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, err
 		}
-		comment.Nickname = nickname
-
 		comments = append(comments, comment)
 	}
-
 	if rows.Err() != nil {
-		return nil, err
+		return nil, rows.Err()
 	}
-
 	return comments, nil
 }
 
@@ -57,8 +112,28 @@ func (db *appdbimpl) GetCommentsLen(p PhotoId) (int, error) {
 // Database function that adds a comment of a user to a photo
 func (db *appdbimpl) CommentPhoto(p PhotoId, u User, c Comment) (int64, error) {
 
-	res, err := db.c.Exec("INSERT INTO comments (id_photo,id_user,comment) VALUES (?, ?, ?)",
-		p.IdPhoto, u.IdUser, c.Comment)
+	// Replies have one level of nesting: a reply to a reply is a reply to its parent
+	var parent sql.NullInt64
+	if c.ParentId != 0 {
+		var grandparent sql.NullInt64
+		err := db.c.QueryRow("SELECT x.id_parent "+visibleComment,
+			visibleCommentArgs(u, p, CommentId{IdComment: c.ParentId})...).Scan(&grandparent)
+		if errors.Is(err, sql.ErrNoRows) {
+			return -1, ErrCommentNotFound
+		} else if err != nil {
+			return -1, err
+		}
+		parent = sql.NullInt64{Int64: c.ParentId, Valid: true}
+		if grandparent.Valid {
+			parent = grandparent
+		}
+	}
+
+	// The comments of the users restricted by the owner of the photo wait for the owner's approval
+	res, err := db.c.Exec("INSERT INTO comments (id_photo,id_user,comment,id_parent,date,approved) VALUES (?, ?, ?, ?, ?, "+
+		"NOT EXISTS (SELECT 1 FROM restricted_users r INNER JOIN photos p ON p.id_user = r.restricter "+
+		"WHERE p.id_photo = ? AND r.restricted = ?))",
+		p.IdPhoto, u.IdUser, c.Comment, parent, time.Now().UTC(), p.IdPhoto, u.IdUser)
 	if err != nil {
 		// Error executing query
 		return -1, err
@@ -73,6 +148,44 @@ func (db *appdbimpl) CommentPhoto(p PhotoId, u User, c Comment) (int64, error) {
 	return commentId, nil
 }
 
+// Database function that changes the text of a comment of a user
+func (db *appdbimpl) EditComment(p PhotoId, u User, c CommentId, text Comment) (CompleteComment, error) {
+
+	var author string
+	err := db.c.QueryRow("SELECT id_user FROM comments WHERE id_photo = ? AND id_comment = ?",
+		p.IdPhoto, c.IdComment).Scan(&author)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CompleteComment{}, ErrCommentNotFound
+	} else if err != nil {
+		return CompleteComment{}, err
+	}
+	if author != u.IdUser {
+		return CompleteComment{}, ErrForbiddenCommentAction
+	}
+
+	_, err = db.c.Exec("UPDATE comments SET comment = ?, edited_at = ? WHERE id_comment = ?",
+		text.Comment, time.Now().UTC(), c.IdComment)
+	if err != nil {
+		return CompleteComment{}, err
+	}
+
+	return scanComment(db.c.QueryRow(commentColumns+"WHERE x.id_comment = ?",
+		append(commentColumnsArgs(u), c.IdComment)...))
+}
+
+// Database function that retrieves a comment of a photo, if the requesting user can see it (see GetCommentsPage)
+func (db *appdbimpl) GetComment(requestingUser User, p PhotoId, c CommentId) (CompleteComment, error) {
+
+	args := append(commentColumnsArgs(requestingUser), p.IdPhoto, c.IdComment,
+		requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser)
+	comment, err := scanComment(db.c.QueryRow(commentColumns+"WHERE x.id_photo = ? AND x.id_comment = ? "+
+		commentBanFilter+commentRestrictFilter, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return CompleteComment{}, ErrCommentNotFound
+	}
+	return comment, err
+}
+
 /*
 Technically, given the structure of the db, it wouldn't be necessary to have the
 id_user to remove a comment, but it is used to make sure that whoever is requesting
@@ -81,7 +194,7 @@ Similarly for the id_photo part, except this time we want to make sure that if t
 is not valid but that comment exists for the given user, it won't be deleted.
 */
 
-// Database function that removes a comment of a user from a photo
+// Database function that removes a comment of a user from a photo (its replies are removed too)
 func (db *appdbimpl) UncommentPhoto(p PhotoId, u User, c CommentId) error {
 
 	_, err := db.c.Exec("DELETE FROM comments WHERE (id_photo = ? AND id_user = ? AND id_comment = ?)",
@@ -104,3 +217,56 @@ func (db *appdbimpl) UncommentPhotoAuthor(p PhotoId, c CommentId) error {
 
 	return nil
 }
+
+// Database function that approves a comment of a restricted user, making it visible to everyone
+func (db *appdbimpl) ApproveComment(p PhotoId, c CommentId) error {
+
+	res, err := db.c.Exec("UPDATE comments SET approved = 1 WHERE id_photo = ? AND id_comment = ?", p.IdPhoto, c.IdComment)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
+
+// Database function that adds a like of a user to a comment of a photo, if the user can see it
+func (db *appdbimpl) LikeComment(p PhotoId, c CommentId, u User) error {
+
+	err := db.checkComment(u, p, c)
+	if err != nil {
+		return err
+	}
+	_, err = db.c.Exec("INSERT OR IGNORE INTO comment_likes (id_comment, id_user) VALUES (?, ?)", c.IdComment, u.IdUser)
+	return err
+}
+
+// Database function that removes a like of a user from a comment of a photo, if the user can see it
+func (db *appdbimpl) UnlikeComment(p PhotoId, c CommentId, u User) error {
+
+	err := db.checkComment(u, p, c)
+	if err != nil {
+		return err
+	}
+	_, err = db.c.Exec("DELETE FROM comment_likes WHERE id_comment = ? AND id_user = ?", c.IdComment, u.IdUser)
+	return err
+}
+
+// Returns ErrCommentNotFound if the comment isn't a comment of the photo that the requesting user can see
+func (db *appdbimpl) checkComment(requestingUser User, p PhotoId, c CommentId) error {
+	var exists bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 "+visibleComment+")",
+		visibleCommentArgs(requestingUser, p, c)...).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCommentNotFound
+	}
+	return nil
+}
@@ -21,13 +21,21 @@ func (db *appdbimpl) ListConversations(user User) ([]Conversation, error) {
 
 	// Direct conversations: derive peers from messages
 	rows, err := db.c.Query(
-		"SELECT CASE WHEN sender = ? THEN receiver ELSE sender END AS peer_id, "+
+		"SELECT c.peer_id, c.last_ts, mu.muted IS NOT NULL FROM ("+
+			"SELECT CASE WHEN sender = ? THEN receiver ELSE sender END AS peer_id, "+
 			"MAX(CAST(strftime('%s', date) AS INTEGER)) AS last_ts "+
 			"FROM messages "+
 			"WHERE (sender = ? OR receiver = ?) "+
 			directMessageNotDeletedClause+
-			"GROUP BY peer_id",
-		user.IdUser, user.IdUser, user.IdUser,
+			"GROUP BY peer_id "+
+			// The pending message requests received by the user are listed apart
+			"HAVING peer_id NOT IN (SELECT sender FROM message_requests WHERE receiver = ?) "+
+			// Bans freeze the direct conversations in both directions
+			"AND peer_id NOT IN (SELECT banner FROM banned_users WHERE banned = ?) "+
+			"AND peer_id NOT IN (SELECT banned FROM banned_users WHERE banner = ?)) c "+
+			// The conversations with the muted users are muted
+			"LEFT JOIN muted_users mu ON mu.muter = ? AND mu.muted = c.peer_id",
+		user.IdUser, user.IdUser, user.IdUser, user.IdUser, user.IdUser, user.IdUser, user.IdUser,
 	)
 	if err != nil {
 		return nil, err
@@ -37,7 +45,8 @@ func (db *appdbimpl) ListConversations(user User) ([]Conversation, error) {
 	for rows.Next() {
 		var peerID string
 		var lastTs int64
-		if err := rows.Scan(&peerID, &lastTs); err != nil {
+		var muted bool
+		if err := rows.Scan(&peerID, &lastTs, &muted); err != nil {
 			return nil, err
 		}
 		lastDate := time.Unix(lastTs, 0).UTC()
@@ -65,6 +74,7 @@ func (db *appdbimpl) ListConversations(user User) ([]Conversation, error) {
 			PhotoURL:           fmt.Sprintf("/users/%s/photo", peerID),
 			LastMessageAt:      lastDate,
 			LastMessagePreview: snippet(lastBody, 40),
+			Muted:              muted,
 		})
 	}
 	if rows.Err() != nil {
@@ -91,6 +101,11 @@ func (db *appdbimpl) ListConversations(user User) ([]Conversation, error) {
 			}
 		}
 
+		muted, unreadMentions, err := db.groupNotificationState(g.Id, user)
+		if err != nil {
+			return nil, err
+		}
+
 		conversations = append(conversations, Conversation{
 			Peer:               fmt.Sprintf("g-%d", g.Id),
 			IsGroup:            true,
@@ -98,6 +113,8 @@ func (db *appdbimpl) ListConversations(user User) ([]Conversation, error) {
 			PhotoURL:           fmt.Sprintf("/groups/%d/photo", g.Id),
 			LastMessageAt:      lastDate,
 			LastMessagePreview: snippet(lastBody, 40),
+			UnreadMentions:     unreadMentions,
+			Muted:              muted,
 		})
 	}
 
@@ -0,0 +1,367 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Database function that retrieves the state of the last data export of a user
+func (db *appdbimpl) GetDataExport(u User) (DataExport, error) {
+
+	var export DataExport
+	var completedAt sql.NullTime
+	err := db.c.QueryRow("SELECT status, requested_at, completed_at, archive_path, size FROM data_exports WHERE id_user = ?",
+		u.IdUser).Scan(&export.Status, &export.RequestedAt, &completedAt, &export.ArchivePath, &export.Size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DataExport{}, ErrDataExportNotFound
+	} else if err != nil {
+		return DataExport{}, err
+	}
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	return export, nil
+}
+
+// Database function that starts a new data export of a user, forgetting the previous one
+func (db *appdbimpl) StartDataExport(u User) (string, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var status, previous string
+	err = tx.QueryRow("SELECT status, archive_path FROM data_exports WHERE id_user = ?", u.IdUser).Scan(&status, &previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if status == DataExportPending {
+		return "", ErrDataExportInProgress
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO data_exports (id_user, status, requested_at) VALUES (?, ?, ?)",
+		u.IdUser, DataExportPending, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
+
+// Database function that ends the pending data export of a user
+func (db *appdbimpl) FinishDataExport(u User, archivePath string, size int64) error {
+
+	status := DataExportReady
+	if archivePath == "" {
+		status, size = DataExportFailed, 0
+	}
+	_, err := db.c.Exec("UPDATE data_exports SET status = ?, completed_at = ?, archive_path = ?, size = ? "+
+		"WHERE id_user = ? AND status = ?", status, time.Now().UTC(), archivePath, size, u.IdUser, DataExportPending)
+	return err
+}
+
+// Database function that lists the users with a pending data export
+func (db *appdbimpl) ListPendingDataExports() ([]User, error) {
+
+	rows, err := db.c.Query("SELECT id_user FROM data_exports WHERE status = ? ORDER BY requested_at", DataExportPending)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.IdUser); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Database function that retrieves the profile of a user for the export of his/her data
+func (db *appdbimpl) ExportUserProfile(u User) (ExportedProfile, error) {
+
+	profile := ExportedProfile{IdUser: u.IdUser}
+	var suspendedAt sql.NullTime
+	var photoPath sql.NullString
+	err := db.c.QueryRow("SELECT u.nickname, u.display_name, u.bio, u.website, u.private, u.messages_from, u.role, "+
+		"u.suspended_at, p.photo_path FROM users u LEFT JOIN user_photos p ON p.id_user = u.id_user WHERE u.id_user = ?",
+		u.IdUser).Scan(&profile.Nickname, &profile.DisplayName, &profile.Bio, &profile.Website, &profile.Private,
+		&profile.MessagesFrom, &profile.Role, &suspendedAt, &photoPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ExportedProfile{}, ErrUserNotFound
+	} else if err != nil {
+		return ExportedProfile{}, err
+	}
+	if suspendedAt.Valid {
+		profile.SuspendedAt = &suspendedAt.Time
+	}
+	profile.PhotoPath = photoPath.String
+
+	rows, err := db.c.Query("SELECT old_nickname, new_nickname, changed_at FROM nickname_history WHERE id_user = ? "+
+		"ORDER BY changed_at", u.IdUser)
+	if err != nil {
+		return ExportedProfile{}, err
+	}
+	defer func() { _ = rows.Close() }()
+	profile.NicknameHistory = []NicknameChange{}
+	for rows.Next() {
+		var change NicknameChange
+		if err := rows.Scan(&change.OldNickname, &change.NewNickname, &change.ChangedAt); err != nil {
+			return ExportedProfile{}, err
+		}
+		profile.NicknameHistory = append(profile.NicknameHistory, change)
+	}
+	if rows.Err() != nil {
+		return ExportedProfile{}, rows.Err()
+	}
+
+	// Every relationship is a list of users: the query selects their identifiers
+	relationships := []struct {
+		users *[]CompleteUser
+		query string
+	}{
+		{&profile.Followers, "SELECT follower FROM followers WHERE followed = ?"},
+		{&profile.Following, "SELECT followed FROM followers WHERE follower = ?"},
+		{&profile.FollowRequests, "SELECT target FROM follow_requests WHERE requester = ?"},
+		{&profile.BannedUsers, "SELECT banned FROM banned_users WHERE banner = ?"},
+		{&profile.MutedUsers, "SELECT muted FROM muted_users WHERE muter = ?"},
+		{&profile.RestrictedUsers, "SELECT restricted FROM restricted_users WHERE restricter = ?"},
+	}
+	for _, r := range relationships {
+		*r.users, err = db.exportUsers(r.query, u)
+		if err != nil {
+			return ExportedProfile{}, err
+		}
+	}
+	return profile, nil
+}
+
+// Retrieves the identifiers and the nicknames of the users selected by a query on a user
+func (db *appdbimpl) exportUsers(query string, u User) ([]CompleteUser, error) {
+
+	rows, err := db.c.Query("SELECT id_user, nickname FROM users WHERE id_user IN ("+query+") ORDER BY nickname", u.IdUser)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	users := []CompleteUser{}
+	for rows.Next() {
+		var user CompleteUser
+		if err := rows.Scan(&user.IdUser, &user.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Database function that retrieves the comments, likes and reactions of a user for the export of his/her data
+func (db *appdbimpl) ExportUserActivity(u User) (ExportedActivity, error) {
+
+	activity := ExportedActivity{Comments: []CompleteComment{}, Likes: []ExportedLike{}, Reactions: []ExportedReaction{}}
+
+	rows, err := db.c.Query(commentColumns+"WHERE x.id_user = ? ORDER BY x.id_comment",
+		append(commentColumnsArgs(u), u.IdUser)...)
+	if err != nil {
+		return ExportedActivity{}, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return ExportedActivity{}, err
+		}
+		activity.Comments = append(activity.Comments, comment)
+	}
+	if rows.Err() != nil {
+		return ExportedActivity{}, rows.Err()
+	}
+	_ = rows.Close()
+
+	likeRows, err := db.c.Query("SELECT l.id_photo, p.id_user FROM likes l INNER JOIN photos p ON p.id_photo = l.id_photo "+
+		"WHERE l.id_user = ? ORDER BY l.id_photo", u.IdUser)
+	if err != nil {
+		return ExportedActivity{}, err
+	}
+	defer func() { _ = likeRows.Close() }()
+	for likeRows.Next() {
+		var like ExportedLike
+		if err := likeRows.Scan(&like.IdPhoto, &like.Owner); err != nil {
+			return ExportedActivity{}, err
+		}
+		activity.Likes = append(activity.Likes, like)
+	}
+	if likeRows.Err() != nil {
+		return ExportedActivity{}, likeRows.Err()
+	}
+	_ = likeRows.Close()
+
+	// The conversation of a direct message is the other user, the one of a group message is its group
+	reactionRows, err := db.c.Query("SELECT CASE WHEN m.sender = r.id_user THEN m.receiver ELSE m.sender END, "+
+		"r.message_id, r.reaction, r.created_at FROM direct_message_reactions r "+
+		"INNER JOIN messages m ON m.id = r.message_id WHERE r.id_user = ? "+
+		"UNION ALL SELECT 'g-' || m.id_group, r.message_id, r.reaction, r.created_at FROM group_message_reactions r "+
+		"INNER JOIN group_messages m ON m.id = r.message_id WHERE r.id_user = ? "+
+		"ORDER BY 4", u.IdUser, u.IdUser)
+	if err != nil {
+		return ExportedActivity{}, err
+	}
+	defer func() { _ = reactionRows.Close() }()
+	for reactionRows.Next() {
+		var reaction ExportedReaction
+		err := reactionRows.Scan(&reaction.Conversation, &reaction.MessageId, &reaction.Reaction, &reaction.CreatedAt)
+		if err != nil {
+			return ExportedActivity{}, err
+		}
+		activity.Reactions = append(activity.Reactions, reaction)
+	}
+	return activity, reactionRows.Err()
+}
+
+// Database function that retrieves a batch of the photos of a user, with all their comments and likes, for the export
+// of his/her data
+func (db *appdbimpl) ExportUserPhotos(u User, afterId int64, limit int) ([]Photo, error) {
+
+	rows, err := db.c.Query("SELECT id_photo, date, caption, media_type FROM photos WHERE id_user = ? AND id_photo > ? "+
+		"ORDER BY id_photo LIMIT ?", u.IdUser, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var photos []Photo
+	index := make(map[int64]int)
+	for rows.Next() {
+		p := Photo{Owner: u.IdUser, Comments: []CompleteComment{}, Likes: []CompleteUser{}}
+		if err := rows.Scan(&p.PhotoId, &p.Date, &p.Caption, &p.MediaType); err != nil {
+			return nil, err
+		}
+		index[int64(p.PhotoId)] = len(photos)
+		photos = append(photos, p)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	_ = rows.Close()
+	if len(photos) == 0 {
+		return photos, nil
+	}
+	if err := db.attachPhotoMedia(photos); err != nil {
+		return nil, err
+	}
+
+	args := make([]interface{}, 0, len(photos))
+	for _, p := range photos {
+		args = append(args, p.PhotoId)
+	}
+
+	// The comments waiting for approval are included: they are on the user's photos
+	commentRows, err := db.c.Query(commentColumns+"WHERE x.id_photo IN ("+placeholders(len(photos))+") ORDER BY x.id_comment",
+		append(commentColumnsArgs(u), args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = commentRows.Close() }()
+	for commentRows.Next() {
+		comment, err := scanComment(commentRows)
+		if err != nil {
+			return nil, err
+		}
+		p := &photos[index[comment.IdPhoto]]
+		p.Comments = append(p.Comments, comment)
+		p.CommentsCount++
+	}
+	if commentRows.Err() != nil {
+		return nil, commentRows.Err()
+	}
+	_ = commentRows.Close()
+
+	likeRows, err := db.c.Query("SELECT l.id_photo, u.id_user, u.nickname FROM likes l "+
+		"INNER JOIN users u ON u.id_user = l.id_user WHERE l.id_photo IN ("+placeholders(len(photos))+") "+
+		"ORDER BY l.id_photo, u.nickname", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = likeRows.Close() }()
+	for likeRows.Next() {
+		var photoId int64
+		var user CompleteUser
+		if err := likeRows.Scan(&photoId, &user.IdUser, &user.Nickname); err != nil {
+			return nil, err
+		}
+		p := &photos[index[photoId]]
+		p.Likes = append(p.Likes, user)
+		p.LikesCount++
+	}
+	return photos, likeRows.Err()
+}
+
+// Database function that retrieves a batch of the direct or group messages sent by a user for the export of his/her
+// data
+func (db *appdbimpl) ExportSentMessages(u User, group bool, afterId int64, limit int) ([]ExportedSentMessage, error) {
+
+	query := "SELECT m.id, m.receiver, m.body, m.date, '', d.deleted_at FROM messages m " +
+		"LEFT JOIN direct_message_deletions d ON d.message_id = m.id "
+	if group {
+		query = "SELECT m.id, 'g-' || m.id_group, m.body, m.date, m.type, d.deleted_at FROM group_messages m " +
+			"LEFT JOIN group_message_deletions d ON d.message_id = m.id "
+	}
+	rows, err := db.c.Query(query+"WHERE m.sender = ? AND m.id > ? ORDER BY m.id LIMIT ?", u.IdUser, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var msgs []ExportedSentMessage
+	for rows.Next() {
+		var m ExportedSentMessage
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&m.Id, &m.Conversation, &m.Body, &m.Date, &m.Type, &deletedAt); err != nil {
+			return nil, err
+		}
+		if deletedAt.Valid {
+			m.Deleted = true
+			m.DeletedAt = &deletedAt.Time
+			m.Body = ""
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// Database function that retrieves a batch of the receipts of the direct or group messages received by a user for the
+// export of his/her data
+func (db *appdbimpl) ExportReceipts(u User, group bool, afterId int64, limit int) ([]ExportedReceipt, error) {
+
+	query := "SELECT r.message_id, m.sender, r.received_at, r.read_at FROM direct_message_receipts r " +
+		"INNER JOIN messages m ON m.id = r.message_id WHERE r.receiver_id = ? "
+	if group {
+		query = "SELECT r.message_id, 'g-' || r.id_group, r.received_at, r.read_at FROM group_message_receipts r " +
+			"WHERE r.id_user = ? "
+	}
+	rows, err := db.c.Query(query+"AND r.message_id > ? ORDER BY r.message_id LIMIT ?", u.IdUser, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var receipts []ExportedReceipt
+	for rows.Next() {
+		var receipt ExportedReceipt
+		var readAt sql.NullTime
+		if err := rows.Scan(&receipt.MessageId, &receipt.Conversation, &receipt.ReceivedAt, &readAt); err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			receipt.ReadAt = &readAt.Time
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
+}
@@ -32,6 +32,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Errors section
@@ -44,15 +45,27 @@ var ErrUserNotInGroup = errors.New("user not in group")
 var ErrUserPhotoNotFound = errors.New("user photo not found")
 var ErrMessageNotFound = errors.New("message not found")
 var ErrForbiddenMessageAction = errors.New("forbidden message action")
+var ErrPollNotFound = errors.New("poll not found")
+var ErrPollClosed = errors.New("poll closed")
+var ErrPollOptionNotFound = errors.New("poll option not found")
+var ErrCommentNotFound = errors.New("comment not found")
+var ErrForbiddenCommentAction = errors.New("forbidden comment action")
+var ErrUserNotFound = errors.New("user not found")
+var ErrPrivateAccount = errors.New("account is private")
+var ErrFollowRequestNotFound = errors.New("follow request not found")
+var ErrMessagesNotAllowed = errors.New("user doesn't accept messages from the sender")
+var ErrMessageRequestNotFound = errors.New("message request not found")
+var ErrReportNotFound = errors.New("report not found")
+var ErrReportResolved = errors.New("report already resolved")
+var ErrInvalidModerationAction = errors.New("moderation action not valid for the report")
+var ErrDataExportNotFound = errors.New("data export not found")
+var ErrDataExportInProgress = errors.New("data export already in progress")
 
 /*
 var ErrUserAutoLike = errors.New("users can't like their own photos")
 var ErrUserAutoFollow = errors.New("users can't follow themselfes")
 */
 
-// Constants
-const PhotosPerUserHome = 3
-
 // AppDatabase is the high level interface for the DB
 type AppDatabase interface {
 
@@ -62,55 +75,200 @@ type AppDatabase interface {
 	// Modifies the nickname of a user in the database. It returns an error
 	ModifyNickname(User, Nickname) error
 
-	// Searches all the users that match the given name (both identifier and nickname). Returns the list of matching users and an error
-	SearchUser(searcher User, userToSearch User) ([]CompleteUser, error)
+	// Searches the users whose nickname (or identifier) matches a text, best match first. afterScore and afterId are
+	// the relevance and the identifier of the last user of the previous page (afterId is empty for the first page).
+	// Returns the page of matching users and an error
+	SearchUser(searcher User, query string, afterScore int, afterId string, limit int) ([]UserSearchResult, error)
 
 	// Creates a new photo in the database. It returns the photo identifier and an error
 	CreatePhoto(Photo) (int64, error)
 
+	// Gets the users that liked a photo, minus the banned ones (by the requesting user or by the owner, and the ones
+	// that banned the requesting user). It returns the users and an error
+	GetLikesList(requestingUser User, owner User, photo PhotoId) ([]CompleteUser, error)
+
 	// Inserts a like of a user for a specified photo in the database. It returns an error
 	LikePhoto(PhotoId, User) error
 
 	// Removes a like of a user for a specified photo from the database. It returns an error
 	UnlikePhoto(PhotoId, User) error
 
-	// Adds a comment from a user to a specified photo in the database. It returns the unique comment id and an error
+	// Adds a comment from a user to a specified photo in the database, as a reply if Comment.ParentId is set (replies
+	// to a reply are added to its parent). It returns the unique comment id and an error (ErrCommentNotFound if the
+	// parent isn't a comment of the photo)
 	CommentPhoto(PhotoId, User, Comment) (int64, error)
 
+	// Changes the text of a comment of the user and sets its edited_at. It returns the edited comment and an error
+	// (ErrCommentNotFound, ErrForbiddenCommentAction if the user isn't the author)
+	EditComment(PhotoId, User, CommentId, Comment) (CompleteComment, error)
+
+	// Gets a page of the comments of a photo for the requesting user (oldest first, without the comments of banned
+	// users): the top-level comments, or the replies of parent if it's not zero. afterId is the last comment of the
+	// previous page (0 for the first page). It returns the comments and an error
+	GetCommentsPage(requestingUser User, photo PhotoId, parent CommentId, afterId int64, limit int) ([]CompleteComment, error)
+
+	// Approves a comment of a restricted user waiting for the approval of the photo owner. It returns an error
+	// (ErrCommentNotFound)
+	ApproveComment(PhotoId, CommentId) error
+
+	// Gets a comment of a photo if the requesting user can see it. It returns an error (ErrCommentNotFound)
+	GetComment(requestingUser User, p PhotoId, c CommentId) (CompleteComment, error)
+
+	// Inserts (removes) a like of a user for a comment of a photo. It returns an error (ErrCommentNotFound)
+	LikeComment(PhotoId, CommentId, User) error
+	UnlikeComment(PhotoId, CommentId, User) error
+
 	// Deletes a comment from a user from a specified photo in the database. It returns an error
 	UncommentPhoto(PhotoId, User, CommentId) error
 
-	// Adds a follower (a) to the user that is being followed (b). It returns an error
-	FollowUser(a User, b User) error
+	// Adds a follower (a) to the user that is being followed (b) or, if b is private, a follow request that b has to
+	// approve. It returns true if the follow is pending and an error (ErrUserNotFound if b doesn't exist)
+	FollowUser(a User, b User) (bool, error)
 
-	// Removes a follower (a) from the user that is being unfollowed (b). It returns an error
+	// Removes a follower (a), or its pending follow request, from the user that is being unfollowed (b). It returns an error
 	UnfollowUser(a User, b User) error
 
-	// Adds a user (b) to the banned list of another (a). It returns an error
+	// Makes the account of a user private or public. Making it public approves the pending follow requests. It returns an error
+	SetPrivate(User, bool) error
+
+	// Checks if the account of a user is private. It returns an error (ErrUserNotFound)
+	IsPrivate(User) (bool, error)
+
+	// Gets the follow status of a (FollowStatusNone, FollowStatusPending or FollowStatusFollowing) towards b
+	GetFollowStatus(a User, b User) (string, error)
+
+	// Checks if the requesting user can see the content (photos, likes, comments) of the owner: the account is
+	// public, the requesting user is the owner or an approved follower
+	CanSeeContent(requestingUser User, owner User) (bool, error)
+
+	// Gets the pending follow requests of a user, oldest first
+	GetFollowRequests(User) ([]FollowRequest, error)
+
+	// Approves (removes) the pending follow request of the requester to the owner. It returns an error
+	// (ErrFollowRequestNotFound)
+	ApproveFollowRequest(owner User, requester User) error
+	RemoveFollowRequest(owner User, requester User) error
+
+	// Adds a user (b) to the banned list of another (a) and removes what links them: follows and follow requests, and
+	// message requests, in both directions. It returns an error (ErrUserNotFound)
 	BanUser(a User, b User) error
 
 	// Removes a user (b) from the banned list of another (a). It returns an error
 	UnbanUser(a User, b User) error
 
-	// Get the a user's stream (photos of people who are followed by the user in reversed chronological order). It returns the photos and an error
-	GetStream(User) ([]Photo, error)
+	// Gets the users banned by a user, by nickname. It returns an error
+	GetBannedUsers(User) ([]CompleteUser, error)
+
+	// Mutes (unmutes) a user (b) for another (a): the photos of b aren't in the stream of a and the direct conversation
+	// with b is muted, without b knowing. It returns an error (ErrUserNotFound)
+	MuteUser(a User, b User) error
+	UnmuteUser(a User, b User) error
+
+	// Restricts (unrestricts) a user (b) for another (a): the new comments of b on the photos of a are visible only to b
+	// and a until a approves them. Unrestricting approves the pending comments. It returns an error (ErrUserNotFound)
+	RestrictUser(a User, b User) error
+	UnrestrictUser(a User, b User) error
+
+	// Gets the users muted (restricted) by a user, by nickname. It returns an error
+	GetMutedUsers(User) ([]CompleteUser, error)
+	GetRestrictedUsers(User) ([]CompleteUser, error)
+
+	// Checks if a user (a) muted and restricted another (b)
+	GetMuteRestrict(a User, b User) (muted bool, restricted bool, err error)
+
+	// Saves a report (Report.IdReport, Status and the resolution are ignored). Reporting again a target whose report of
+	// the same reporter is still open updates that report. It returns the report identifier and an error
+	CreateReport(Report) (int64, error)
+
+	// Gets a page of the reports with a status (oldest first), of a target type if not empty. afterId is the last
+	// report of the previous page (0 for the first page). It returns the reports and an error
+	ListReports(status string, targetType string, afterId int64, limit int) ([]Report, error)
+
+	// Gets a report. It returns an error (ErrReportNotFound)
+	GetReport(id int64) (Report, error)
+
+	// Resolves the open reports about the target of a report with a moderation action (ModerationDismiss,
+	// ModerationRemoveContent, ModerationSuspend of the reported user) and records it in the moderation log. It
+	// returns the report, the number of media items of the removed photo (to remove its files) and an error
+	// (ErrReportNotFound, ErrReportResolved, ErrInvalidModerationAction when removing a user)
+	ResolveReport(moderator User, id int64, action string, note string) (Report, int, error)
+
+	// Suspends (reinstates) a user and records it in the moderation log. It returns an error (ErrUserNotFound)
+	SetSuspended(moderator User, u User, suspended bool, note string) error
+
+	// Checks if a user is suspended
+	IsSuspended(User) (bool, error)
+
+	// Checks if a user is a moderator
+	IsModerator(User) (bool, error)
+
+	// Makes moderators the users with the given identifiers, and regular users the others
+	SetModerators(ids []string) error
+
+	// Gets a page of the moderation log (newest first). beforeId is the last action of the previous page (0 for the
+	// first page). It returns the actions and an error
+	ListModerationActions(beforeId int64, limit int) ([]ModerationAction, error)
+
+	// Deletes a user with everything he/she created (photos, comments, likes, follows, messages, group memberships,
+	// reports). With anonymizeGroupMessages, the group messages of the user are kept and attributed to the
+	// DeletedUserId placeholder. The media files are not removed. It returns an error (ErrUserNotFound)
+	DeleteUser(u User, anonymizeGroupMessages bool) error
+
+	// Get a page of the user's stream (photos of people who are followed by the user, or of everybody in discover mode, in reversed chronological order).
+	// beforeId is the last photo of the previous page (0 for the first page). It returns the photos and an error
+	GetStream(user User, discover bool, beforeId int64, limit int) ([]Photo, error)
+
+	// Gets a photo for the requesting user. It returns the photo and an error (ErrUserBanned if the owner banned the
+	// requesting user, ErrPrivateAccount if the owner is private and the requesting user isn't an approved follower)
+	GetPhoto(requestingUser User, p PhotoId) (Photo, error)
+
+	// Removes a photo from the database. The removal includes likes and comments. It returns the number of media
+	// items of the photo and an error (ErrPhotoDoesntExist if the user has no such photo)
+	RemovePhoto(User, PhotoId) (int, error)
 
-	// Removes a photo from the database. The removal includes likes and comments.  It returns an error
-	RemovePhoto(User, PhotoId) error
+	// Changes the caption (and so the hashtags) of a photo of the user. It returns an error
+	SetPhotoCaption(User, PhotoId, string) error
+
+	// Gets a page of the photos with a hashtag (reversed chronological order, keyset paginated like GetStream). It returns the photos and an error
+	GetPhotosByTag(requestingUser User, tag string, beforeId int64, limit int) ([]Photo, error)
+
+	// Gets a page of the photos whose caption contains a text (reversed chronological order, keyset paginated like GetStream). It returns the photos and an error
+	SearchPhotosByCaption(requestingUser User, text string, beforeId int64, limit int) ([]Photo, error)
+
+	// Gets the users suggested to the requesting user, ranked by mutual follows, shared groups and activity since a
+	// date. Followed, requested, muted, suspended and banned (in both directions) users are excluded. It returns the
+	// suggestions and an error
+	GetFollowSuggestions(u User, since time.Time, limit int) ([]Suggestion, error)
+
+	// Gets the photos with the most likes and comments since a date that the requesting user can see (same rules of the
+	// discover stream), best ranked first. It returns the photos and an error
+	GetTrendingPhotos(requestingUser User, since time.Time, limit int) ([]Photo, error)
 
 	// ____________________________________  Util Methods ____________________________________
 
-	// Gets the followers list for the specified user. Returns the followers list and an error
-	GetFollowers(User) ([]User, error)
+	// Gets a page of the followers of u for the requesting user, in nickname order. afterNickname is the last user
+	// of the previous page (empty for the first page). Returns the followers and an error
+	GetFollowers(requestingUser User, u User, afterNickname string, limit int) ([]UserSummary, error)
 
-	// Gets the following list for the specified user. Returns the following list and an error
-	GetFollowing(User) ([]User, error)
+	// Gets a page of the users followed by u for the requesting user, like GetFollowers. Returns the users and an error
+	GetFollowing(requestingUser User, u User, afterNickname string, limit int) ([]UserSummary, error)
+
+	// Counts the users followed by the specified user. Returns the count and an error
+	CountFollowing(User) (int, error)
 
 	// Gets all users
 	GetAllUsers() ([]User, error)
 
-	// Gets the photos list of user b for the user a. Returns the photo list and an error
-	GetPhotosList(a User, b User) ([]Photo, error)
+	// Gets a page of the photos of the owner for the requesting user (reversed chronological order, keyset paginated
+	// like GetStream). Returns the photos and an error
+	GetUserPhotos(requestingUser User, owner User, beforeId int64, limit int) ([]Photo, error)
+
+	// Gets the profile of a user (display name, bio, website and counters). Returns the profile and an error
+	// (ErrUserNotFound)
+	GetProfile(User) (Profile, error)
+
+	// Changes the display name, the bio and the website of a user. Returns an error (ErrUserNotFound)
+	SetProfileInfo(User, ProfileInfo) error
 
 	// Allows the author of a photo to remove a comment from another user on his/her photo. Returns an error
 	UncommentPhotoAuthor(PhotoId, CommentId) error
@@ -136,8 +294,8 @@ type AppDatabase interface {
 	// Updates group name
 	SetGroupName(groupId int64, name string) error
 
-	// Updates group photo path (local server path)
-	SetGroupPhotoPath(groupId int64, photoPath string) error
+	// Updates group photo path (media store key). Returns the previous path (empty if none)
+	SetGroupPhotoPath(groupId int64, photoPath string) (string, error)
 
 	// Retrieves group info
 	GetGroup(groupId int64) (Group, error)
@@ -145,10 +303,10 @@ type AppDatabase interface {
 	// Lists groups of a user
 	ListGroupsForUser(user User) ([]Group, error)
 
-	// Sets user's profile photo path (local server path)
-	SetUserPhotoPath(user User, photoPath string) error
+	// Sets user's profile photo path (media store key). Returns the previous path (empty if none)
+	SetUserPhotoPath(user User, photoPath string) (string, error)
 
-	// Gets user's profile photo path (local server path)
+	// Gets user's profile photo path (media store key)
 	GetUserPhotoPath(user User) (string, error)
 
 	// Lists conversations (direct peers and groups), sorted by last activity (reverse chronological)
@@ -157,6 +315,9 @@ type AppDatabase interface {
 	// Checks if a user (a) is banned by another (b). Returns a boolean
 	BannedUserCheck(a User, b User) (bool, error)
 
+	// Checks if one of the two users banned the other. Returns a boolean
+	BanBetween(a User, b User) (bool, error)
+
 	// Checks if a user (a) exists
 	CheckUser(a User) (bool, error)
 
@@ -166,10 +327,31 @@ type AppDatabase interface {
 	// Ping checks whether the database is available or not (in that case, an error will be returned)
 	Ping() error
 
-	// Chat methods
+	// Chat methods. Sending a direct message makes the two users contacts: each accepts the messages of the other
 	CreateMessage(from User, to User, body string) (int64, error)
 	ListMessages(a User, b User, limit int, offset int) ([]Message, error)
 
+	// Checks if from can send a direct message to a user. It returns DirectMessageAllowed, or DirectMessageRequest if
+	// the message has to wait in the message requests of the receiver, and an error (ErrUserNotFound,
+	// ErrMessagesNotAllowed by the receiver's setting)
+	CheckDirectMessage(from User, to User) (string, error)
+
+	// Sends a direct message as a message request: the conversation is hidden from the receiver's chats until accepted
+	CreateMessageRequest(from User, to User, body string) (int64, error)
+
+	// Gets (sets) who can start a direct conversation with a user (MessagesFromEveryone, MessagesFromFollowing or
+	// MessagesFromNobody). It returns an error (ErrUserNotFound)
+	GetMessagesFrom(User) (string, error)
+	SetMessagesFrom(User, string) error
+
+	// Lists the pending message requests received by a user, newest first
+	ListMessageRequests(User) ([]MessageRequest, error)
+
+	// Accepts (deletes, with its messages) the pending message request of sender. It returns an error
+	// (ErrMessageRequestNotFound)
+	AcceptMessageRequest(receiver User, sender User) error
+	DeleteMessageRequest(receiver User, sender User) error
+
 	// Group chat methods
 	CreateGroupMessage(groupId int64, from User, body string) (int64, error)
 	ListGroupMessages(groupId int64, limit int, offset int) ([]GroupMessage, error)
@@ -180,19 +362,84 @@ type AppDatabase interface {
 	DeleteDirectMessage(messageId int64, deletedBy User) error
 	DeleteGroupMessage(groupId int64, messageId int64, deletedBy User) error
 
+	// Set* replaces every reaction of the user on the message, Add* keeps the others (multiple reactions mode).
+	// Remove* deletes the given reaction, or all the user's reactions on the message when reaction is empty.
 	SetDirectMessageReaction(messageId int64, user User, reaction string) error
-	RemoveDirectMessageReaction(messageId int64, user User) error
+	AddDirectMessageReaction(messageId int64, user User, reaction string) error
+	RemoveDirectMessageReaction(messageId int64, user User, reaction string) error
 	ListDirectMessageReactions(messageId int64) ([]MessageReaction, error)
+	SummarizeDirectMessageReactions(messageIds []int64, viewer User) (map[int64][]ReactionSummary, error)
 
 	SetGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error
-	RemoveGroupMessageReaction(groupId int64, messageId int64, user User) error
+	AddGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error
+	RemoveGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error
 	ListGroupMessageReactions(groupId int64, messageId int64) ([]MessageReaction, error)
+	SummarizeGroupMessageReactions(groupId int64, messageIds []int64, viewer User) (map[int64][]ReactionSummary, error)
 
 	// Read receipts (checkmarks)
 	MarkDirectConversationRead(reader User, peer User) error
 	MarkGroupConversationRead(groupId int64, reader User) error
 	GetDirectMessageCheckmarks(messageId int64) (int, error)
 	GetGroupMessageCheckmarks(groupId int64, messageId int64) (int, error)
+
+	// Mentions (@nickname in group messages) and group mute settings
+	ListGroupMessageMentions(groupId int64, messageIds []int64) (map[int64][]Mention, error)
+	ListUserMentions(user User, unreadOnly bool, limit int) ([]MentionNotification, error)
+	SetGroupMute(groupId int64, user User, muteMentions bool) error
+	RemoveGroupMute(groupId int64, user User) error
+
+	// Conversation export: the whole history (deleted messages included) in chronological batches of at most limit
+	// messages, starting after the message afterId
+	ExportDirectMessages(a User, b User, afterId int64, limit int) ([]ExportedMessage, error)
+	ExportGroupMessages(groupId int64, afterId int64, limit int) ([]ExportedMessage, error)
+
+	// Polls in group conversations. A poll is a group message of type "poll"; when it closes (explicitly or because
+	// its close time passed) a "poll_closed" system message is added to the conversation.
+	CreateGroupPoll(groupId int64, from User, poll NewPoll) (int64, error)
+	ListGroupPolls(groupId int64, messageIds []int64, viewer User) (map[int64]Poll, error)
+	VoteGroupPoll(groupId int64, messageId int64, user User, option int) error
+	UnvoteGroupPoll(groupId int64, messageId int64, user User, option int) error
+	CloseGroupPoll(groupId int64, messageId int64, closedBy User) error
+	CloseExpiredGroupPolls(groupId int64) error
+
+	// Link previews cache. Failed fetches are cached too, so that broken links aren't fetched over and over
+	SaveLinkPreview(preview LinkPreview, failed bool) error
+	GetLinkPreviews(urls []string) (map[string]LinkPreview, error)
+	IsLinkPreviewCached(url string, maxAge time.Duration) (bool, error)
+
+	// Gets the state of the last export of a user's data. It returns an error (ErrDataExportNotFound)
+	GetDataExport(User) (DataExport, error)
+
+	// Starts a new export of a user's data, replacing the previous one. It returns the archive of the previous export
+	// (to remove its file, empty if none) and an error (ErrDataExportInProgress)
+	StartDataExport(User) (string, error)
+
+	// Marks the pending export of a user's data as ready, with its archive, or as failed (empty archivePath)
+	FinishDataExport(u User, archivePath string, size int64) error
+
+	// Lists the users whose data export is pending (e.g., interrupted by a restart)
+	ListPendingDataExports() ([]User, error)
+
+	// Data export: the profile of a user with his/her settings, nickname history and relationships
+	ExportUserProfile(User) (ExportedProfile, error)
+
+	// Data export: the comments and the likes the user left on photos and his/her reactions to messages
+	ExportUserActivity(User) (ExportedActivity, error)
+
+	// Data export: a batch of the photos of a user (with all their comments and likes), in chronological order,
+	// starting after the photo afterId
+	ExportUserPhotos(u User, afterId int64, limit int) ([]Photo, error)
+
+	// Data export: a batch of the direct (group) messages sent by a user, in chronological order, starting after the
+	// message afterId. Deleted messages are included as tombstones
+	ExportSentMessages(u User, group bool, afterId int64, limit int) ([]ExportedSentMessage, error)
+
+	// Data export: a batch of the delivery receipts of the direct (group) messages received by a user, starting after
+	// the message afterId
+	ExportReceipts(u User, group bool, afterId int64, limit int) ([]ExportedReceipt, error)
+
+	// Lists the media files referenced by the database, to find the orphan ones in the media store
+	ListMediaReferences() (MediaReferences, error)
 }
 
 type appdbimpl struct {
@@ -220,6 +467,12 @@ func New(db *sql.DB) (AppDatabase, error) {
 		return nil, fmt.Errorf("error creating database structure: %w", err)
 	}
 
+	// Bring tables created by older versions up to date
+	err = migrateDatabase(db)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating database structure: %w", err)
+	}
+
 	return &appdbimpl{
 		c: db,
 	}, nil
@@ -231,10 +484,24 @@ func (db *appdbimpl) Ping() error {
 
 // Creates all the necessary sql tables for the WASAPhoto app.
 func createDatabase(db *sql.DB) error {
-	tables := [17]string{
+	tables := [38]string{
 		`CREATE TABLE IF NOT EXISTS users (
 			id_user VARCHAR(16) NOT NULL PRIMARY KEY,
-			nickname VARCHAR(16) NOT NULL
+			nickname VARCHAR(16) NOT NULL,
+			private INTEGER NOT NULL DEFAULT 0,
+			messages_from TEXT NOT NULL DEFAULT 'everyone',
+			role TEXT NOT NULL DEFAULT 'user',
+			suspended_at DATETIME,
+			search_name TEXT NOT NULL DEFAULT '',
+			display_name TEXT NOT NULL DEFAULT '',
+			bio TEXT NOT NULL DEFAULT '',
+			website TEXT NOT NULL DEFAULT ''
+			);`,
+		`CREATE TABLE IF NOT EXISTS user_search_trigrams (
+			trigram TEXT NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			PRIMARY KEY (trigram, id_user),
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
 		`CREATE TABLE IF NOT EXISTS user_photos (
 			id_user VARCHAR(16) NOT NULL PRIMARY KEY,
@@ -258,11 +525,14 @@ func createDatabase(db *sql.DB) error {
 			id_photo INTEGER PRIMARY KEY AUTOINCREMENT,
 			id_user VARCHAR(16) NOT NULL,
 			date DATETIME NOT NULL,
+			caption TEXT NOT NULL DEFAULT '',
+			media_type TEXT NOT NULL DEFAULT 'image',
 			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
 		`CREATE TABLE IF NOT EXISTS  likes (
 			id_photo INTEGER NOT NULL,
 			id_user VARCHAR(16) NOT NULL,
+			date DATETIME,
 			PRIMARY KEY (id_photo,id_user),
 			FOREIGN KEY(id_photo) REFERENCES photos (id_photo) ON DELETE CASCADE
 			);`,
@@ -270,10 +540,21 @@ func createDatabase(db *sql.DB) error {
 			id_comment INTEGER PRIMARY KEY AUTOINCREMENT,
 			id_photo INTEGER NOT NULL,
 			id_user VARCHAR(16) NOT NULL,
-			comment VARCHAR(30) NOT NULL,
+			comment TEXT NOT NULL,
+			id_parent INTEGER REFERENCES comments (id_comment) ON DELETE CASCADE,
+			date DATETIME,
+			edited_at DATETIME,
+			approved INTEGER NOT NULL DEFAULT 1,
 			FOREIGN KEY(id_photo) REFERENCES photos (id_photo) ON DELETE CASCADE,
 			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
+		`CREATE TABLE IF NOT EXISTS comment_likes (
+			id_comment INTEGER NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			PRIMARY KEY (id_comment, id_user),
+			FOREIGN KEY(id_comment) REFERENCES comments (id_comment) ON DELETE CASCADE,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
 		`CREATE TABLE IF NOT EXISTS banned_users (
 			banner VARCHAR(16) NOT NULL,
 			banned VARCHAR(16) NOT NULL,
@@ -281,6 +562,20 @@ func createDatabase(db *sql.DB) error {
 			FOREIGN KEY(banner) REFERENCES users (id_user) ON DELETE CASCADE,
 			FOREIGN KEY(banned) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
+		`CREATE TABLE IF NOT EXISTS muted_users (
+			muter VARCHAR(16) NOT NULL,
+			muted VARCHAR(16) NOT NULL,
+			PRIMARY KEY (muter, muted),
+			FOREIGN KEY(muter) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(muted) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS restricted_users (
+			restricter VARCHAR(16) NOT NULL,
+			restricted VARCHAR(16) NOT NULL,
+			PRIMARY KEY (restricter, restricted),
+			FOREIGN KEY(restricter) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(restricted) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
 		`CREATE TABLE IF NOT EXISTS followers(
 			follower VARCHAR(16) NOT NULL,
 			followed VARCHAR(16) NOT NULL,
@@ -288,6 +583,14 @@ func createDatabase(db *sql.DB) error {
 			FOREIGN KEY(follower) REFERENCES users (id_user) ON DELETE CASCADE,
 			FOREIGN KEY(followed) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
+		`CREATE TABLE IF NOT EXISTS follow_requests (
+			requester VARCHAR(16) NOT NULL,
+			target VARCHAR(16) NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (requester, target),
+			FOREIGN KEY(requester) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(target) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
 		`CREATE TABLE IF NOT EXISTS messages (
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             sender VARCHAR(16) NOT NULL,
@@ -297,12 +600,28 @@ func createDatabase(db *sql.DB) error {
             FOREIGN KEY(sender) REFERENCES users (id_user) ON DELETE CASCADE,
             FOREIGN KEY(receiver) REFERENCES users (id_user) ON DELETE CASCADE
             );`,
+		`CREATE TABLE IF NOT EXISTS chat_contacts (
+			id_user VARCHAR(16) NOT NULL,
+			peer VARCHAR(16) NOT NULL,
+			PRIMARY KEY (id_user, peer),
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(peer) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS message_requests (
+			sender VARCHAR(16) NOT NULL,
+			receiver VARCHAR(16) NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (sender, receiver),
+			FOREIGN KEY(sender) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(receiver) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
 		`CREATE TABLE IF NOT EXISTS group_messages (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			id_group INTEGER NOT NULL,
 			sender VARCHAR(16) NOT NULL,
 			body TEXT NOT NULL,
 			date DATETIME NOT NULL,
+			type TEXT NOT NULL DEFAULT 'text',
 			FOREIGN KEY(id_group) REFERENCES groups (id_group) ON DELETE CASCADE,
 			FOREIGN KEY(sender) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
@@ -327,7 +646,7 @@ func createDatabase(db *sql.DB) error {
 			id_user VARCHAR(16) NOT NULL,
 			reaction TEXT NOT NULL,
 			created_at DATETIME NOT NULL,
-			PRIMARY KEY (message_id, id_user),
+			PRIMARY KEY (message_id, id_user, reaction),
 			FOREIGN KEY(message_id) REFERENCES messages (id) ON DELETE CASCADE,
 			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
@@ -336,7 +655,7 @@ func createDatabase(db *sql.DB) error {
 			id_user VARCHAR(16) NOT NULL,
 			reaction TEXT NOT NULL,
 			created_at DATETIME NOT NULL,
-			PRIMARY KEY (message_id, id_user),
+			PRIMARY KEY (message_id, id_user, reaction),
 			FOREIGN KEY(message_id) REFERENCES group_messages (id) ON DELETE CASCADE,
 			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
@@ -359,6 +678,119 @@ func createDatabase(db *sql.DB) error {
 			FOREIGN KEY(id_group) REFERENCES groups (id_group) ON DELETE CASCADE,
 			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
 			);`,
+		`CREATE TABLE IF NOT EXISTS group_message_mentions (
+			message_id INTEGER NOT NULL,
+			id_group INTEGER NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			position INTEGER NOT NULL,
+			length INTEGER NOT NULL,
+			read_at DATETIME,
+			PRIMARY KEY (message_id, id_user, position),
+			FOREIGN KEY(message_id) REFERENCES group_messages (id) ON DELETE CASCADE,
+			FOREIGN KEY(id_group) REFERENCES groups (id_group) ON DELETE CASCADE,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS group_mutes (
+			id_group INTEGER NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			mute_mentions BOOLEAN NOT NULL DEFAULT 0,
+			PRIMARY KEY (id_group, id_user),
+			FOREIGN KEY(id_group) REFERENCES groups (id_group) ON DELETE CASCADE,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS link_previews (
+			url TEXT NOT NULL PRIMARY KEY,
+			title TEXT NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			image TEXT NOT NULL DEFAULT '',
+			failed BOOLEAN NOT NULL DEFAULT 0,
+			fetched_at DATETIME NOT NULL
+			);`,
+		`CREATE TABLE IF NOT EXISTS photo_tags (
+			id_photo INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (id_photo, tag),
+			FOREIGN KEY(id_photo) REFERENCES photos (id_photo) ON DELETE CASCADE
+			);`,
+		`CREATE INDEX IF NOT EXISTS photo_tags_by_tag ON photo_tags (tag, id_photo);`,
+		`CREATE TABLE IF NOT EXISTS photo_media (
+			id_photo INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			media_type TEXT NOT NULL DEFAULT 'image',
+			PRIMARY KEY (id_photo, position),
+			FOREIGN KEY(id_photo) REFERENCES photos (id_photo) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS group_polls (
+			message_id INTEGER NOT NULL PRIMARY KEY,
+			id_group INTEGER NOT NULL,
+			question TEXT NOT NULL,
+			multiple_choice BOOLEAN NOT NULL DEFAULT 0,
+			anonymous BOOLEAN NOT NULL DEFAULT 0,
+			closes_at DATETIME,
+			closed_at DATETIME,
+			closed_event_id INTEGER,
+			FOREIGN KEY(message_id) REFERENCES group_messages (id) ON DELETE CASCADE,
+			FOREIGN KEY(id_group) REFERENCES groups (id_group) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS group_poll_options (
+			message_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			PRIMARY KEY (message_id, position),
+			FOREIGN KEY(message_id) REFERENCES group_polls (message_id) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS group_poll_votes (
+			message_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			voted_at DATETIME NOT NULL,
+			PRIMARY KEY (message_id, position, id_user),
+			FOREIGN KEY(message_id, position) REFERENCES group_poll_options (message_id, position) ON DELETE CASCADE,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS reports (
+			id_report INTEGER PRIMARY KEY AUTOINCREMENT,
+			reporter VARCHAR(16) NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			reported_user VARCHAR(16) NOT NULL,
+			content TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'open',
+			created_at DATETIME NOT NULL,
+			resolved_at DATETIME,
+			resolved_by VARCHAR(16),
+			FOREIGN KEY(reporter) REFERENCES users (id_user) ON DELETE CASCADE,
+			FOREIGN KEY(reported_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE INDEX IF NOT EXISTS reports_by_target ON reports (target_type, target_id, status);`,
+		`CREATE TABLE IF NOT EXISTS nickname_history (
+			id_user VARCHAR(16) NOT NULL,
+			old_nickname VARCHAR(16) NOT NULL,
+			new_nickname VARCHAR(16) NOT NULL,
+			changed_at DATETIME NOT NULL,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS data_exports (
+			id_user VARCHAR(16) NOT NULL PRIMARY KEY,
+			status TEXT NOT NULL,
+			requested_at DATETIME NOT NULL,
+			completed_at DATETIME,
+			archive_path TEXT NOT NULL DEFAULT '',
+			size INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		`CREATE TABLE IF NOT EXISTS moderation_actions (
+			id_action INTEGER PRIMARY KEY AUTOINCREMENT,
+			moderator VARCHAR(16) NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			id_report INTEGER,
+			note TEXT NOT NULL DEFAULT '',
+			date DATETIME NOT NULL
+			);`,
 	}
 
 	// Iteration to create all the needed sql schemas
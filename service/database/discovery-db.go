@@ -0,0 +1,98 @@
+package database
+
+import "time"
+
+// Weights of the follow suggestions ranking. The recent activity of a user counts up to maxSuggestionActivity
+const suggestionMutualWeight = 3
+const suggestionGroupWeight = 2
+const maxSuggestionActivity = 10
+
+// Weight of a comment in the trending photos ranking (a like weighs 1)
+const trendingCommentWeight = 2
+
+// Database function that retrieves the users suggested to a user. The candidates are the users followed by the users
+// he/she follows, the members of his/her groups and the users that posted photos or comments since the given date
+// (so that new users get suggestions too)
+func (db *appdbimpl) GetFollowSuggestions(u User, since time.Time, limit int) ([]Suggestion, error) {
+
+	rows, err := db.c.Query("WITH candidates (id_user, mutual, shared) AS ("+
+		"SELECT f2.followed, 1, 0 FROM followers f1 INNER JOIN followers f2 ON f2.follower = f1.followed WHERE f1.follower = ? "+
+		"UNION ALL SELECT g2.id_user, 0, 1 FROM group_members g1 INNER JOIN group_members g2 ON g2.id_group = g1.id_group "+
+		"WHERE g1.id_user = ? "+
+		"UNION ALL SELECT DISTINCT id_user, 0, 0 FROM photos WHERE date >= ? "+
+		"UNION ALL SELECT DISTINCT id_user, 0, 0 FROM comments WHERE date >= ?), "+
+		"ranked AS (SELECT id_user, SUM(mutual) AS mutual, SUM(shared) AS shared FROM candidates GROUP BY id_user) "+
+		"SELECT u.id_user, u.nickname, r.mutual, r.shared, "+
+		"(SELECT COUNT(*) FROM photos p WHERE p.id_user = u.id_user AND p.date >= ?) + "+
+		"(SELECT COUNT(*) FROM comments c WHERE c.id_user = u.id_user AND c.date >= ?) AS activity "+
+		"FROM ranked r INNER JOIN users u ON u.id_user = r.id_user "+
+		"WHERE u.id_user <> ? AND u.id_user <> ? AND u.suspended_at IS NULL "+
+		"AND u.id_user NOT IN (SELECT followed FROM followers WHERE follower = ?) "+
+		"AND u.id_user NOT IN (SELECT target FROM follow_requests WHERE requester = ?) "+
+		"AND u.id_user NOT IN (SELECT muted FROM muted_users WHERE muter = ?) "+
+		"AND u.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) "+
+		"AND u.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ?) "+
+		"ORDER BY ? * r.mutual + ? * r.shared + MIN(activity, ?) DESC, r.mutual DESC, u.nickname LIMIT ?",
+		u.IdUser, u.IdUser, since, since, since, since,
+		u.IdUser, DeletedUserId, u.IdUser, u.IdUser, u.IdUser, u.IdUser, u.IdUser,
+		suggestionMutualWeight, suggestionGroupWeight, maxSuggestionActivity, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		err = rows.Scan(&s.IdUser, &s.Nickname, &s.MutualFollows, &s.SharedGroups, &s.RecentActivity)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return suggestions, nil
+}
+
+// Database function that retrieves the trending photos: the photos of the other users ranked by the likes and the
+// approved comments (of users other than the owner) they got since the given date. Photos without any, and the photos
+// of the suspended users, are excluded
+func (db *appdbimpl) GetTrendingPhotos(requestingUser User, since time.Time, limit int) ([]Photo, error) {
+
+	rows, err := db.c.Query("SELECT id_photo, id_user, date, caption, media_type FROM ("+
+		"SELECT p.id_photo, p.id_user, p.date, p.caption, p.media_type, "+
+		"(SELECT COUNT(*) FROM likes l WHERE l.id_photo = p.id_photo AND l.date >= ?) + ? * "+
+		"(SELECT COUNT(*) FROM comments c WHERE c.id_photo = p.id_photo AND c.date >= ? AND c.approved = 1 "+
+		"AND c.id_user <> p.id_user) AS score "+
+		"FROM photos p WHERE p.id_user <> ? "+streamSuspendedClause+streamMuteClause+streamBanClause+privacyClause+
+		"AND p.id_photo IN (SELECT id_photo FROM likes WHERE date >= ? UNION SELECT id_photo FROM comments WHERE date >= ?)"+
+		") WHERE score > 0 ORDER BY score DESC, id_photo DESC LIMIT ?",
+		since, trendingCommentWeight, since, requestingUser.IdUser, requestingUser.IdUser,
+		requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser,
+		since, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	photos := make([]Photo, 0, limit)
+	for rows.Next() {
+		var photo Photo
+		err = rows.Scan(&photo.PhotoId, &photo.Owner, &photo.Date, &photo.Caption, &photo.MediaType)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	_ = rows.Close()
+
+	if err := db.attachPhotoMedia(photos); err != nil {
+		return nil, err
+	}
+	return photos, db.attachPhotoActivity(requestingUser, photos)
+}
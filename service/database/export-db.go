@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// ExportDirectMessages returns a batch of the whole history of a direct conversation, in chronological order,
+// starting after the message afterId (0 for the first batch). Deleted messages are included as tombstones (without
+// body) and every message comes with the list of its reactions.
+func (db *appdbimpl) ExportDirectMessages(a User, b User, afterId int64, limit int) ([]ExportedMessage, error) {
+	rows, err := db.c.Query(
+		"SELECT m.id, m.sender, u.nickname, m.body, m.date, d.deleted_at FROM messages m "+
+			"INNER JOIN users u ON u.id_user = m.sender "+
+			"LEFT JOIN direct_message_deletions d ON d.message_id = m.id "+
+			"WHERE ((m.sender=? AND m.receiver=?) OR (m.sender=? AND m.receiver=?)) AND m.id > ? "+
+			"ORDER BY m.id LIMIT ?",
+		a.IdUser, b.IdUser, b.IdUser, a.IdUser, afterId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := scanExportedMessages(rows, false)
+	if err != nil {
+		return nil, err
+	}
+	return msgs, db.attachExportedReactions("direct_message_reactions", msgs)
+}
+
+// ExportGroupMessages is the group counterpart of ExportDirectMessages.
+func (db *appdbimpl) ExportGroupMessages(groupId int64, afterId int64, limit int) ([]ExportedMessage, error) {
+	rows, err := db.c.Query(
+		"SELECT m.id, m.sender, u.nickname, m.body, m.date, d.deleted_at, m.type FROM group_messages m "+
+			"INNER JOIN users u ON u.id_user = m.sender "+
+			"LEFT JOIN group_message_deletions d ON d.message_id = m.id "+
+			"WHERE m.id_group = ? AND m.id > ? "+
+			"ORDER BY m.id LIMIT ?",
+		groupId, afterId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := scanExportedMessages(rows, true)
+	if err != nil {
+		return nil, err
+	}
+	return msgs, db.attachExportedReactions("group_message_reactions", msgs)
+}
+
+func scanExportedMessages(rows *sql.Rows, withType bool) ([]ExportedMessage, error) {
+	defer func() { _ = rows.Close() }()
+
+	var msgs []ExportedMessage
+	for rows.Next() {
+		var m ExportedMessage
+		var deletedAt sql.NullTime
+		dest := []interface{}{&m.Id, &m.Sender, &m.SenderNickname, &m.Body, &m.Date, &deletedAt}
+		if withType {
+			dest = append(dest, &m.Type)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if deletedAt.Valid {
+			m.Deleted = true
+			m.DeletedAt = &deletedAt.Time
+			m.Body = ""
+		}
+		msgs = append(msgs, m)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return msgs, nil
+}
+
+// Sets the reactions of the exported messages, in a single query
+func (db *appdbimpl) attachExportedReactions(table string, msgs []ExportedMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(msgs))
+	args := make([]interface{}, 0, len(msgs))
+	for i, m := range msgs {
+		index[m.Id] = i
+		args = append(args, m.Id)
+	}
+	rows, err := db.c.Query(
+		"SELECT r.message_id, r.id_user, u.nickname, r.reaction, r.created_at FROM "+table+" r "+
+			"INNER JOIN users u ON u.id_user = r.id_user "+
+			"WHERE r.message_id IN ("+placeholders(len(msgs))+") ORDER BY r.created_at",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var messageID int64
+		var mr MessageReaction
+		if err := rows.Scan(&messageID, &mr.UserID, &mr.Nickname, &mr.Reaction, &mr.CreatedAt); err != nil {
+			return err
+		}
+		i := index[messageID]
+		msgs[i].Reactions = append(msgs[i].Reactions, mr)
+	}
+	return rows.Err()
+}
@@ -1,81 +1,259 @@
 package database
 
-// Database function that retrieves the list of followers of a user
-func (db *appdbimpl) GetFollowers(requestinUser User) ([]User, error) {
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
 
-	rows, err := db.c.Query("SELECT follower FROM followers WHERE followed = ?", requestinUser.IdUser)
+// Database function that retrieves a page of the followers of a user, in nickname order
+func (db *appdbimpl) GetFollowers(requestingUser User, u User, afterNickname string, limit int) ([]UserSummary, error) {
+	return db.queryFollowPage(requestingUser, "f.follower", "f.followed", u, afterNickname, limit)
+}
+
+// Database function that retrieves a page of the users followed by a user, in nickname order
+func (db *appdbimpl) GetFollowing(requestingUser User, u User, afterNickname string, limit int) ([]UserSummary, error) {
+	return db.queryFollowPage(requestingUser, "f.followed", "f.follower", u, afterNickname, limit)
+}
+
+// Runs a keyset paginated query over the followers table, listing the listed column of the rows whose owner column is
+// the user. Nicknames are unique, so they're the key of the pages. Users that banned the requesting user, or that the
+// requesting user banned, are left out
+func (db *appdbimpl) queryFollowPage(requestingUser User, listed string, owner string, u User, afterNickname string,
+	limit int) ([]UserSummary, error) {
+
+	rows, err := db.c.Query("SELECT x.id_user, x.nickname, x.display_name, "+
+		"EXISTS (SELECT 1 FROM followers m WHERE m.follower = ? AND m.followed = x.id_user) "+
+		"FROM followers f INNER JOIN users x ON x.id_user = "+listed+" WHERE "+owner+" = ? "+
+		"AND x.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) "+
+		"AND x.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ?) "+
+		"AND x.nickname > ? ORDER BY x.nickname LIMIT ?",
+		requestingUser.IdUser, u.IdUser, requestingUser.IdUser, requestingUser.IdUser, afterNickname, limit)
 	if err != nil {
 		return nil, err
 	}
 	// Wait for the function to finish before closing rows.
 	defer func() { _ = rows.Close() }()
 
-	// Read all the users in the resulset (users that follow the requesting user)
-	var followers []User
+	users := make([]UserSummary, 0, limit)
 	for rows.Next() {
-		var folower User
-		err = rows.Scan(&folower.IdUser)
+		var user UserSummary
+		err = rows.Scan(&user.IdUser, &user.Nickname, &user.DisplayName, &user.FollowedByMe)
 		if err != nil {
 			return nil, err
 		}
-		followers = append(followers, folower)
+		users = append(users, user)
 	}
-
 	if rows.Err() != nil {
-		return nil, err
+		return nil, rows.Err()
+	}
+	return users, nil
+}
+
+// Visibility filter of the photos (aliased p) of private accounts: they're shown only to their owner and to the
+// approved followers. It needs the requesting user twice
+const privacyClause = "AND (p.id_user = ? OR p.id_user IN (SELECT id_user FROM users WHERE private = 0) " +
+	"OR p.id_user IN (SELECT followed FROM followers WHERE follower = ?)) "
+
+// Database function that adds a follower to a user, or a follow request if the user is private
+func (db *appdbimpl) FollowUser(follower User, followed User) (bool, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var private, following bool
+	err = tx.QueryRow("SELECT private, EXISTS (SELECT 1 FROM followers WHERE follower = ? AND followed = id_user) "+
+		"FROM users WHERE id_user = ?", follower.IdUser, followed.IdUser).Scan(&private, &following)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		return false, err
+	}
+
+	pending := private && !following
+	if pending {
+		_, err = tx.Exec("INSERT OR IGNORE INTO follow_requests (requester, target, created_at) VALUES (?, ?, ?)",
+			follower.IdUser, followed.IdUser, time.Now().UTC())
+	} else {
+		_, err = tx.Exec("INSERT OR IGNORE INTO followers (follower,followed) VALUES (?, ?)",
+			follower.IdUser, followed.IdUser)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return pending, tx.Commit()
+}
+
+// Database function that removes a follower (or a pending follow request) from a user
+func (db *appdbimpl) UnfollowUser(follower User, followed User) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("DELETE FROM followers WHERE(follower = ? AND followed = ?)",
+		follower.IdUser, followed.IdUser)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM follow_requests WHERE requester = ? AND target = ?",
+		follower.IdUser, followed.IdUser)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Database function that makes the account of a user private or public. The pending follow requests are approved when
+// the account becomes public
+func (db *appdbimpl) SetPrivate(user User, private bool) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("UPDATE users SET private = ? WHERE id_user = ?", private, user.IdUser)
+	if err != nil {
+		return err
+	}
+
+	if !private {
+		_, err = tx.Exec("INSERT OR IGNORE INTO followers (follower, followed) "+
+			"SELECT requester, target FROM follow_requests WHERE target = ?", user.IdUser)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM follow_requests WHERE target = ?", user.IdUser)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Database function that checks if the account of a user is private
+func (db *appdbimpl) IsPrivate(user User) (bool, error) {
+
+	var private bool
+	err := db.c.QueryRow("SELECT private FROM users WHERE id_user = ?", user.IdUser).Scan(&private)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
 	}
+	return private, err
+}
+
+// Database function that gets the follow status of a user towards another
+func (db *appdbimpl) GetFollowStatus(follower User, followed User) (string, error) {
+
+	var following, pending bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 FROM followers WHERE follower = ? AND followed = ?), "+
+		"EXISTS (SELECT 1 FROM follow_requests WHERE requester = ? AND target = ?)",
+		follower.IdUser, followed.IdUser, follower.IdUser, followed.IdUser).Scan(&following, &pending)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case following:
+		return FollowStatusFollowing, nil
+	case pending:
+		return FollowStatusPending, nil
+	}
+	return FollowStatusNone, nil
+}
+
+// Database function that checks if the requesting user can see the content of a user (see privacyClause)
+func (db *appdbimpl) CanSeeContent(requestingUser User, owner User) (bool, error) {
 
-	return followers, nil
+	var visible bool
+	err := db.c.QueryRow("SELECT ? = id_user OR private = 0 "+
+		"OR EXISTS (SELECT 1 FROM followers WHERE follower = ? AND followed = id_user) "+
+		"FROM users WHERE id_user = ?",
+		requestingUser.IdUser, requestingUser.IdUser, owner.IdUser).Scan(&visible)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Users that don't exist have no content
+		return true, nil
+	}
+	return visible, err
 }
 
-// Database function that retrieves the list of users followed by the user
-func (db *appdbimpl) GetFollowing(requestinUser User) ([]User, error) {
+// Database function that retrieves the pending follow requests of a user
+func (db *appdbimpl) GetFollowRequests(user User) ([]FollowRequest, error) {
 
-	rows, err := db.c.Query("SELECT followed FROM followers WHERE follower = ?", requestinUser.IdUser)
+	rows, err := db.c.Query("SELECT r.requester, u.nickname, r.created_at FROM follow_requests r "+
+		"INNER JOIN users u ON u.id_user = r.requester WHERE r.target = ? ORDER BY r.created_at",
+		user.IdUser)
 	if err != nil {
 		return nil, err
 	}
-	// Wait for the function to finish before closing rows.
 	defer func() { _ = rows.Close() }()
 
-	// Read all the users in the resulset (users followed by the requesting user)
-	var following []User
+	requests := []FollowRequest{}
 	for rows.Next() {
-		var folowed User
-		err = rows.Scan(&folowed.IdUser)
-		if err != nil {
+		var request FollowRequest
+		if err := rows.Scan(&request.IdUser, &request.Nickname, &request.Date); err != nil {
 			return nil, err
 		}
-		following = append(following, folowed)
+		requests = append(requests, request)
 	}
-
 	if rows.Err() != nil {
-		return nil, err
+		return nil, rows.Err()
 	}
-
-	return following, nil
+	return requests, nil
 }
 
-// Database function that adds a follower to a user
-func (db *appdbimpl) FollowUser(follower User, followed User) error {
+// Database function that approves a pending follow request: the requester becomes a follower
+func (db *appdbimpl) ApproveFollowRequest(owner User, requester User) error {
 
-	_, err := db.c.Exec("INSERT INTO followers (follower,followed) VALUES (?, ?)",
-		follower.IdUser, followed.IdUser)
+	tx, err := db.c.Begin()
 	if err != nil {
 		return err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	return nil
+	res, err := tx.Exec("DELETE FROM follow_requests WHERE requester = ? AND target = ?", requester.IdUser, owner.IdUser)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrFollowRequestNotFound
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO followers (follower, followed) VALUES (?, ?)", requester.IdUser, owner.IdUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Database function that removes a follower from a user
-func (db *appdbimpl) UnfollowUser(follower User, followed User) error {
+// Database function that removes a pending follow request (rejected by the owner or withdrawn by the requester)
+func (db *appdbimpl) RemoveFollowRequest(owner User, requester User) error {
 
-	_, err := db.c.Exec("DELETE FROM followers WHERE(follower = ? AND followed = ?)",
-		follower.IdUser, followed.IdUser)
+	res, err := db.c.Exec("DELETE FROM follow_requests WHERE requester = ? AND target = ?", requester.IdUser, owner.IdUser)
 	if err != nil {
 		return err
 	}
-
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrFollowRequestNotFound
+	}
 	return nil
 }
@@ -108,19 +108,24 @@ func (db *appdbimpl) SetGroupName(groupId int64, name string) error {
 	return nil
 }
 
-func (db *appdbimpl) SetGroupPhotoPath(groupId int64, photoPath string) error {
-	res, err := db.c.Exec("UPDATE groups SET photo_path = ? WHERE id_group = ?", photoPath, groupId)
+func (db *appdbimpl) SetGroupPhotoPath(groupId int64, photoPath string) (string, error) {
+	tx, err := db.c.Begin()
 	if err != nil {
-		return err
+		return "", err
 	}
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return err
+	defer func() { _ = tx.Rollback() }()
+
+	var previous string
+	err = tx.QueryRow("SELECT photo_path FROM groups WHERE id_group = ?", groupId).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrGroupNotFound
+	} else if err != nil {
+		return "", err
 	}
-	if affected == 0 {
-		return ErrGroupNotFound
+	if _, err := tx.Exec("UPDATE groups SET photo_path = ? WHERE id_group = ?", photoPath, groupId); err != nil {
+		return "", err
 	}
-	return nil
+	return previous, tx.Commit()
 }
 
 func (db *appdbimpl) GetGroup(groupId int64) (Group, error) {
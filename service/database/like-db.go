@@ -1,10 +1,13 @@
 package database
 
-// Database function that retrieves the list of users that liked a photo
+import "time"
+
+// Database function that retrieves the list of users that liked a photo, oldest like first
 func (db *appdbimpl) GetLikesList(requestingUser User, requestedUser User, photo PhotoId) ([]CompleteUser, error) {
 
-	rows, err := db.c.Query("SELECT id_user FROM likes WHERE id_photo = ? AND id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ? OR banner = ?) "+
-		"AND id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?)",
+	rows, err := db.c.Query("SELECT l.id_user, u.nickname FROM likes l INNER JOIN users u ON u.id_user = l.id_user "+
+		"WHERE l.id_photo = ? AND l.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ? OR banner = ?) "+
+		"AND l.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) ORDER BY l.date, l.id_user",
 		photo.IdPhoto, requestingUser.IdUser, requestedUser.IdUser, requestingUser.IdUser)
 	if err != nil {
 		return nil, err
@@ -13,26 +16,17 @@ func (db *appdbimpl) GetLikesList(requestingUser User, requestedUser User, photo
 	defer func() { _ = rows.Close() }()
 
 	// Read all the users in the resulset (users that liked the photo that didn't ban the requesting user).
-	var likes []CompleteUser
+	likes := []CompleteUser{}
 	for rows.Next() {
 		var user CompleteUser
-		err = rows.Scan(&user.IdUser)
-		if err != nil {
-			return nil, err
-		}
-
-		// Get the nickname of the user that liked the photo
-		nickname, err := db.GetNickname(User{IdUser: user.IdUser})
+		err = rows.Scan(&user.IdUser, &user.Nickname)
 		if err != nil {
 			return nil, err
 		}
-		user.Nickname = nickname
-
 		likes = append(likes, user)
 	}
-
 	if rows.Err() != nil {
-		return nil, err
+		return nil, rows.Err()
 	}
 
 	return likes, nil
@@ -41,7 +35,7 @@ func (db *appdbimpl) GetLikesList(requestingUser User, requestedUser User, photo
 // Database function that adds a like of a user to a photo
 func (db *appdbimpl) LikePhoto(p PhotoId, u User) error {
 
-	_, err := db.c.Exec("INSERT INTO likes (id_photo,id_user) VALUES (?, ?)", p.IdPhoto, u.IdUser)
+	_, err := db.c.Exec("INSERT INTO likes (id_photo,id_user,date) VALUES (?, ?, ?)", p.IdPhoto, u.IdUser, time.Now().UTC())
 	if err != nil {
 		return err
 	}
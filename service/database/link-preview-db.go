@@ -0,0 +1,59 @@
+package database
+
+import (
+	"time"
+)
+
+// SaveLinkPreview stores (or refreshes) the preview of a URL.
+func (db *appdbimpl) SaveLinkPreview(preview LinkPreview, failed bool) error {
+	_, err := db.c.Exec(
+		"INSERT OR REPLACE INTO link_previews (url, title, description, image, failed, fetched_at) VALUES (?,?,?,?,?,?)",
+		preview.URL, preview.Title, preview.Description, preview.Image, failed, time.Now().UTC(),
+	)
+	return err
+}
+
+// GetLinkPreviews returns the cached previews of the given URLs, in a single query. URLs without a preview (never
+// fetched, or whose fetch failed) are not included in the map.
+func (db *appdbimpl) GetLinkPreviews(urls []string) (map[string]LinkPreview, error) {
+	out := make(map[string]LinkPreview)
+	if len(urls) == 0 {
+		return out, nil
+	}
+
+	args := make([]interface{}, 0, len(urls))
+	for _, u := range urls {
+		args = append(args, u)
+	}
+	rows, err := db.c.Query(
+		"SELECT url, title, description, image FROM link_previews WHERE failed = 0 AND url IN ("+placeholders(len(urls))+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var p LinkPreview
+		if err := rows.Scan(&p.URL, &p.Title, &p.Description, &p.Image); err != nil {
+			return nil, err
+		}
+		out[p.URL] = p
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return out, nil
+}
+
+// IsLinkPreviewCached checks if the URL was fetched (successfully or not) less than maxAge ago.
+func (db *appdbimpl) IsLinkPreviewCached(url string, maxAge time.Duration) (bool, error) {
+	var cnt int
+	err := db.c.QueryRow("SELECT COUNT(*) FROM link_previews WHERE url = ? AND fetched_at >= ?",
+		url, time.Now().UTC().Add(-maxAge)).Scan(&cnt)
+	if err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+// Database function that lists the photos, the profile photos, the group photos and the data export archives, to
+// reconcile the media store against the database
+func (db *appdbimpl) ListMediaReferences() (MediaReferences, error) {
+	refs := MediaReferences{
+		Photos: make(map[string]map[int64][]int),
+		Paths:  make(map[string]bool),
+	}
+
+	// Photos without media items are from before multi-item posts: their only item is the photo itself
+	rows, err := db.c.Query("SELECT p.id_user, p.id_photo, COALESCE(m.position, 0) FROM photos p " +
+		"LEFT JOIN photo_media m ON m.id_photo = p.id_photo ORDER BY p.id_photo, m.position")
+	if err != nil {
+		return refs, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var owner string
+		var photoId int64
+		var position int
+		if err := rows.Scan(&owner, &photoId, &position); err != nil {
+			return refs, err
+		}
+		if refs.Photos[owner] == nil {
+			refs.Photos[owner] = make(map[int64][]int)
+		}
+		refs.Photos[owner][photoId] = append(refs.Photos[owner][photoId], position)
+	}
+	if rows.Err() != nil {
+		return refs, rows.Err()
+	}
+	_ = rows.Close()
+
+	pathRows, err := db.c.Query("SELECT photo_path FROM user_photos UNION SELECT photo_path FROM groups WHERE photo_path <> '' " +
+		"UNION SELECT archive_path FROM data_exports WHERE archive_path <> ''")
+	if err != nil {
+		return refs, err
+	}
+	defer func() { _ = pathRows.Close() }()
+
+	for pathRows.Next() {
+		var path string
+		if err := pathRows.Scan(&path); err != nil {
+			return refs, err
+		}
+		refs.Paths[path] = true
+	}
+	return refs, pathRows.Err()
+}
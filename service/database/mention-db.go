@@ -0,0 +1,173 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Returns the mentions (@nickname) of the given members contained in a message body. A mention must start at the
+// beginning of the body or after a whitespace, and must not be followed by a letter, digit or underscore. When more
+// nicknames match at the same position the longest one wins. Nicknames are matched case insensitively.
+func parseMentions(body string, members []CompleteUser) []Mention {
+	var mentions []Mention
+	runes := []rune(body)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && !unicode.IsSpace(runes[i-1])) {
+			continue
+		}
+
+		var best *CompleteUser
+		bestLen := 0
+		for m := range members {
+			nickname := []rune(members[m].Nickname)
+			end := i + 1 + len(nickname)
+			if len(nickname) <= bestLen || end > len(runes) {
+				continue
+			}
+			if !strings.EqualFold(string(runes[i+1:end]), members[m].Nickname) {
+				continue
+			}
+			if end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				continue
+			}
+			best = &members[m]
+			bestLen = len(nickname)
+		}
+		if best == nil {
+			continue
+		}
+
+		mentions = append(mentions, Mention{
+			UserID:   best.IdUser,
+			Nickname: best.Nickname,
+			Offset:   i,
+			Length:   bestLen + 1,
+		})
+		i += bestLen
+	}
+	return mentions
+}
+
+// ListGroupMessageMentions returns the mentions of the given group messages, in a single query. Messages without
+// mentions are not included in the map.
+func (db *appdbimpl) ListGroupMessageMentions(groupId int64, messageIds []int64) (map[int64][]Mention, error) {
+	out := make(map[int64][]Mention)
+	if len(messageIds) == 0 {
+		return out, nil
+	}
+
+	args := make([]interface{}, 0, len(messageIds)+1)
+	args = append(args, groupId)
+	for _, id := range messageIds {
+		args = append(args, id)
+	}
+	rows, err := db.c.Query(
+		"SELECT m.message_id, m.id_user, u.nickname, m.position, m.length FROM group_message_mentions m "+
+			"INNER JOIN users u ON u.id_user = m.id_user "+
+			"WHERE m.id_group = ? AND m.message_id IN ("+placeholders(len(messageIds))+") "+
+			"ORDER BY m.message_id, m.position",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var messageID int64
+		var mention Mention
+		if err := rows.Scan(&messageID, &mention.UserID, &mention.Nickname, &mention.Offset, &mention.Length); err != nil {
+			return nil, err
+		}
+		out[messageID] = append(out[messageID], mention)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return out, nil
+}
+
+// ListUserMentions returns the most recent group messages mentioning the user, newest first. Groups the user left,
+// groups where the user muted mentions and deleted messages are excluded.
+func (db *appdbimpl) ListUserMentions(user User, unreadOnly bool, limit int) ([]MentionNotification, error) {
+	query := "SELECT gm.id, gm.id_group, g.name, gm.sender, u.nickname, gm.body, gm.date, " +
+		"SUM(CASE WHEN m.read_at IS NULL THEN 1 ELSE 0 END) AS unread " +
+		"FROM group_message_mentions m " +
+		"INNER JOIN group_messages gm ON gm.id = m.message_id " +
+		"INNER JOIN groups g ON g.id_group = gm.id_group " +
+		"INNER JOIN users u ON u.id_user = gm.sender " +
+		"INNER JOIN group_members mb ON mb.id_group = gm.id_group AND mb.id_user = m.id_user " +
+		"WHERE m.id_user = ? " +
+		"AND gm.id NOT IN (SELECT message_id FROM group_message_deletions) " +
+		"AND gm.id_group NOT IN (SELECT id_group FROM group_mutes WHERE id_user = ? AND mute_mentions = 1) " +
+		"GROUP BY gm.id "
+	if unreadOnly {
+		query += "HAVING unread > 0 "
+	}
+	query += "ORDER BY gm.date DESC LIMIT ?"
+
+	rows, err := db.c.Query(query, user.IdUser, user.IdUser, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []MentionNotification
+	for rows.Next() {
+		var n MentionNotification
+		var groupID int64
+		var unread int
+		if err := rows.Scan(&n.MessageId, &groupID, &n.GroupName, &n.Sender, &n.SenderNickname, &n.Body, &n.Date, &unread); err != nil {
+			return nil, err
+		}
+		n.Peer = fmt.Sprintf("g-%d", groupID)
+		n.Read = unread == 0
+		out = append(out, n)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return out, nil
+}
+
+// SetGroupMute mutes a group for the user. Mentions still count as unread unless muteMentions is true.
+func (db *appdbimpl) SetGroupMute(groupId int64, user User, muteMentions bool) error {
+	_, err := db.c.Exec("INSERT OR REPLACE INTO group_mutes (id_group, id_user, mute_mentions) VALUES (?,?,?)",
+		groupId, user.IdUser, muteMentions)
+	return err
+}
+
+// RemoveGroupMute unmutes a group for the user.
+func (db *appdbimpl) RemoveGroupMute(groupId int64, user User) error {
+	_, err := db.c.Exec("DELETE FROM group_mutes WHERE id_group = ? AND id_user = ?", groupId, user.IdUser)
+	return err
+}
+
+// Returns the group mute settings of the user and the number of unread mentions (0 if mentions are muted)
+func (db *appdbimpl) groupNotificationState(groupId int64, user User) (muted bool, unreadMentions int, err error) {
+	var muteMentions bool
+	err = db.c.QueryRow("SELECT mute_mentions FROM group_mutes WHERE id_group = ? AND id_user = ?", groupId, user.IdUser).
+		Scan(&muteMentions)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, err
+	}
+	muted = err == nil
+	if muteMentions {
+		return muted, 0, nil
+	}
+
+	err = db.c.QueryRow(
+		"SELECT COUNT(DISTINCT message_id) FROM group_message_mentions "+
+			"WHERE id_group = ? AND id_user = ? AND read_at IS NULL "+
+			"AND message_id NOT IN (SELECT message_id FROM group_message_deletions WHERE id_group = ?)",
+		groupId, user.IdUser, groupId,
+	).Scan(&unreadMentions)
+	if err != nil {
+		return false, 0, err
+	}
+	return muted, unreadMentions, nil
+}
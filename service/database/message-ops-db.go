@@ -14,10 +14,22 @@ func (db *appdbimpl) CreateGroupMessage(groupId int64, from User, body string) (
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	now := time.Now().UTC()
+	messageID, err := insertGroupMessage(tx, groupId, from, body, GroupMessageText, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
+
+// Inserts a group message of the given type, with the receipts of the other members and the mentions (system events
+// don't mention anybody). Returns the message identifier.
+func insertGroupMessage(tx *sql.Tx, groupId int64, from User, body string, messageType string, date time.Time) (int64, error) {
 	res, err := tx.Exec(
-		"INSERT INTO group_messages (id_group, sender, body, date) VALUES (?,?,?,?)",
-		groupId, from.IdUser, body, now,
+		"INSERT INTO group_messages (id_group, sender, body, date, type) VALUES (?,?,?,?,?)",
+		groupId, from.IdUser, body, date, messageType,
 	)
 	if err != nil {
 		return 0, err
@@ -27,32 +39,53 @@ func (db *appdbimpl) CreateGroupMessage(groupId int64, from User, body string) (
 		return 0, err
 	}
 
-	// Create receipts for all members except the sender.
-	rows, err := tx.Query("SELECT id_user FROM group_members WHERE id_group = ? AND id_user <> ?", groupId, from.IdUser)
+	// Load the other members of the group (they receive the message and can be mentioned).
+	rows, err := tx.Query(
+		"SELECT gm.id_user, u.nickname FROM group_members gm INNER JOIN users u ON u.id_user = gm.id_user "+
+			"WHERE gm.id_group = ? AND gm.id_user <> ?",
+		groupId, from.IdUser,
+	)
 	if err != nil {
 		return 0, err
 	}
 	defer func() { _ = rows.Close() }()
 
+	var members []CompleteUser
 	for rows.Next() {
-		var uid string
-		if err := rows.Scan(&uid); err != nil {
+		var member CompleteUser
+		if err := rows.Scan(&member.IdUser, &member.Nickname); err != nil {
 			return 0, err
 		}
+		members = append(members, member)
+	}
+	if rows.Err() != nil {
+		return 0, rows.Err()
+	}
+
+	// Create receipts for all members except the sender.
+	for _, member := range members {
 		_, err = tx.Exec(
 			"INSERT OR IGNORE INTO group_message_receipts (message_id, id_group, id_user, received_at, read_at) VALUES (?,?,?,?,NULL)",
-			messageID, groupId, uid, now,
+			messageID, groupId, member.IdUser, date,
 		)
 		if err != nil {
 			return 0, err
 		}
 	}
-	if rows.Err() != nil {
-		return 0, rows.Err()
+
+	if messageType == GroupMessagePollClosed {
+		return messageID, nil
 	}
 
-	if err := tx.Commit(); err != nil {
-		return 0, err
+	// Store the @nickname mentions of the members
+	for _, mention := range parseMentions(body, members) {
+		_, err = tx.Exec(
+			"INSERT OR IGNORE INTO group_message_mentions (message_id, id_group, id_user, position, length, read_at) VALUES (?,?,?,?,?,NULL)",
+			messageID, groupId, mention.UserID, mention.Offset, mention.Length,
+		)
+		if err != nil {
+			return 0, err
+		}
 	}
 	return messageID, nil
 }
@@ -60,7 +93,7 @@ func (db *appdbimpl) CreateGroupMessage(groupId int64, from User, body string) (
 // ListGroupMessages returns group messages ordered by date descending (reverse chronological), excluding deleted messages.
 func (db *appdbimpl) ListGroupMessages(groupId int64, limit int, offset int) ([]GroupMessage, error) {
 	rows, err := db.c.Query(
-		"SELECT id, id_group, sender, body, date FROM group_messages "+
+		"SELECT id, id_group, sender, body, date, type FROM group_messages "+
 			"WHERE id_group = ? "+
 			"AND id NOT IN (SELECT message_id FROM group_message_deletions WHERE id_group = ?) "+
 			"ORDER BY date DESC LIMIT ? OFFSET ?",
@@ -75,7 +108,7 @@ func (db *appdbimpl) ListGroupMessages(groupId int64, limit int, offset int) ([]
 	for rows.Next() {
 		var m GroupMessage
 		var dt time.Time
-		if err := rows.Scan(&m.Id, &m.GroupID, &m.Sender, &m.Body, &dt); err != nil {
+		if err := rows.Scan(&m.Id, &m.GroupID, &m.Sender, &m.Body, &dt, &m.Type); err != nil {
 			return nil, err
 		}
 		m.Date = dt
@@ -109,9 +142,9 @@ func (db *appdbimpl) GetGroupMessageInGroup(groupId int64, messageId int64) (Gro
 	var m GroupMessage
 	var dt time.Time
 	err := db.c.QueryRow(
-		"SELECT id, id_group, sender, body, date FROM group_messages WHERE id = ? AND id_group = ?",
+		"SELECT id, id_group, sender, body, date, type FROM group_messages WHERE id = ? AND id_group = ?",
 		messageId, groupId,
-	).Scan(&m.Id, &m.GroupID, &m.Sender, &m.Body, &dt)
+	).Scan(&m.Id, &m.GroupID, &m.Sender, &m.Body, &dt, &m.Type)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return GroupMessage{}, ErrMessageNotFound
@@ -162,58 +195,66 @@ func (db *appdbimpl) DeleteGroupMessage(groupId int64, messageId int64, deletedB
 	return err
 }
 
+// SetDirectMessageReaction replaces every reaction of the user on the message with the given one.
 func (db *appdbimpl) SetDirectMessageReaction(messageId int64, user User, reaction string) error {
+	return db.replaceReaction("direct_message_reactions", messageId, user, reaction)
+}
+
+// AddDirectMessageReaction adds a reaction of the user to the message, keeping the ones already there.
+func (db *appdbimpl) AddDirectMessageReaction(messageId int64, user User, reaction string) error {
 	_, err := db.c.Exec(
-		"INSERT OR REPLACE INTO direct_message_reactions (message_id, id_user, reaction, created_at) VALUES (?,?,?,?)",
+		"INSERT OR IGNORE INTO direct_message_reactions (message_id, id_user, reaction, created_at) VALUES (?,?,?,?)",
 		messageId, user.IdUser, reaction, time.Now().UTC(),
 	)
 	return err
 }
 
-func (db *appdbimpl) RemoveDirectMessageReaction(messageId int64, user User) error {
-	_, err := db.c.Exec("DELETE FROM direct_message_reactions WHERE message_id = ? AND id_user = ?", messageId, user.IdUser)
+func (db *appdbimpl) RemoveDirectMessageReaction(messageId int64, user User, reaction string) error {
+	if reaction == "" {
+		_, err := db.c.Exec("DELETE FROM direct_message_reactions WHERE message_id = ? AND id_user = ?", messageId, user.IdUser)
+		return err
+	}
+	_, err := db.c.Exec("DELETE FROM direct_message_reactions WHERE message_id = ? AND id_user = ? AND reaction = ?",
+		messageId, user.IdUser, reaction)
 	return err
 }
 
+// ListDirectMessageReactions returns who reacted to a message, oldest reaction first.
 func (db *appdbimpl) ListDirectMessageReactions(messageId int64) ([]MessageReaction, error) {
-	rows, err := db.c.Query("SELECT id_user, reaction FROM direct_message_reactions WHERE message_id = ?", messageId)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
+	return db.listReactions("direct_message_reactions", messageId)
+}
 
-	var out []MessageReaction
-	for rows.Next() {
-		var mr MessageReaction
-		if err := rows.Scan(&mr.UserID, &mr.Reaction); err != nil {
-			return nil, err
-		}
-		out = append(out, mr)
-	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+func (db *appdbimpl) SetGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error {
+	// Validate membership of the message to this group
+	if _, err := db.GetGroupMessageInGroup(groupId, messageId); err != nil {
+		return err
 	}
-	return out, nil
+	return db.replaceReaction("group_message_reactions", messageId, user, reaction)
 }
 
-func (db *appdbimpl) SetGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error {
+func (db *appdbimpl) AddGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error {
 	// Validate membership of the message to this group
 	if _, err := db.GetGroupMessageInGroup(groupId, messageId); err != nil {
 		return err
 	}
 	_, err := db.c.Exec(
-		"INSERT OR REPLACE INTO group_message_reactions (message_id, id_user, reaction, created_at) VALUES (?,?,?,?)",
+		"INSERT OR IGNORE INTO group_message_reactions (message_id, id_user, reaction, created_at) VALUES (?,?,?,?)",
 		messageId, user.IdUser, reaction, time.Now().UTC(),
 	)
 	return err
 }
 
-func (db *appdbimpl) RemoveGroupMessageReaction(groupId int64, messageId int64, user User) error {
+func (db *appdbimpl) RemoveGroupMessageReaction(groupId int64, messageId int64, user User, reaction string) error {
 	// Validate membership of the message to this group
 	if _, err := db.GetGroupMessageInGroup(groupId, messageId); err != nil {
 		return err
 	}
-	_, err := db.c.Exec("DELETE FROM group_message_reactions WHERE message_id = ? AND id_user = ?", messageId, user.IdUser)
+	if reaction == "" {
+		_, err := db.c.Exec("DELETE FROM group_message_reactions WHERE message_id = ? AND id_user = ?", messageId, user.IdUser)
+		return err
+	}
+	_, err := db.c.Exec("DELETE FROM group_message_reactions WHERE message_id = ? AND id_user = ? AND reaction = ?",
+		messageId, user.IdUser, reaction)
 	return err
 }
 
@@ -222,23 +263,5 @@ func (db *appdbimpl) ListGroupMessageReactions(groupId int64, messageId int64) (
 	if _, err := db.GetGroupMessageInGroup(groupId, messageId); err != nil {
 		return nil, err
 	}
-
-	rows, err := db.c.Query("SELECT id_user, reaction FROM group_message_reactions WHERE message_id = ?", messageId)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-
-	var out []MessageReaction
-	for rows.Next() {
-		var mr MessageReaction
-		if err := rows.Scan(&mr.UserID, &mr.Reaction); err != nil {
-			return nil, err
-		}
-		out = append(out, mr)
-	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
-	}
-	return out, nil
+	return db.listReactions("group_message_reactions", messageId)
 }
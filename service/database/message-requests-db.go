@@ -0,0 +1,196 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Database function that checks if a user can send a direct message to another: the contacts of the receiver always
+// can, the others depend on the receiver's setting
+func (db *appdbimpl) CheckDirectMessage(from User, to User) (string, error) {
+
+	var messagesFrom string
+	var contact, followed bool
+	err := db.c.QueryRow("SELECT messages_from, "+
+		"EXISTS (SELECT 1 FROM chat_contacts WHERE id_user = u.id_user AND peer = ?), "+
+		"EXISTS (SELECT 1 FROM followers WHERE follower = u.id_user AND followed = ?) "+
+		"FROM users u WHERE id_user = ?",
+		from.IdUser, from.IdUser, to.IdUser).Scan(&messagesFrom, &contact, &followed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	switch {
+	case contact:
+		return DirectMessageAllowed, nil
+	case messagesFrom == MessagesFromNobody:
+		return "", ErrMessagesNotAllowed
+	case followed:
+		return DirectMessageAllowed, nil
+	case messagesFrom == MessagesFromFollowing:
+		return "", ErrMessagesNotAllowed
+	}
+	return DirectMessageRequest, nil
+}
+
+// Database function that sends a direct message from a stranger, adding it to the message requests of the receiver
+func (db *appdbimpl) CreateMessageRequest(from User, to User, body string) (int64, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec("INSERT INTO messages (sender, receiver, body, date) VALUES (?,?,?,?)", from.IdUser, to.IdUser, body, now)
+	if err != nil {
+		return 0, err
+	}
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO direct_message_receipts (message_id, receiver_id, received_at, read_at) VALUES (?,?,?,NULL)",
+		messageID, to.IdUser, now)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT OR IGNORE INTO message_requests (sender, receiver, created_at) VALUES (?, ?, ?)",
+		from.IdUser, to.IdUser, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// The sender accepts the replies: replying accepts the request
+	_, err = tx.Exec("INSERT OR IGNORE INTO chat_contacts (id_user, peer) VALUES (?, ?)", from.IdUser, to.IdUser)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
+
+// Database function that retrieves who can start a direct conversation with a user
+func (db *appdbimpl) GetMessagesFrom(user User) (string, error) {
+
+	var messagesFrom string
+	err := db.c.QueryRow("SELECT messages_from FROM users WHERE id_user = ?", user.IdUser).Scan(&messagesFrom)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return messagesFrom, err
+}
+
+// Database function that sets who can start a direct conversation with a user
+func (db *appdbimpl) SetMessagesFrom(user User, messagesFrom string) error {
+
+	_, err := db.c.Exec("UPDATE users SET messages_from = ? WHERE id_user = ?", messagesFrom, user.IdUser)
+	return err
+}
+
+// Database function that retrieves the pending message requests of a user, with the last message of each one
+func (db *appdbimpl) ListMessageRequests(user User) ([]MessageRequest, error) {
+
+	rows, err := db.c.Query("SELECT r.sender, u.nickname, "+
+		"(SELECT COUNT(*) FROM messages m WHERE m.sender = r.sender AND m.receiver = r.receiver "+
+		directMessageNotDeletedClause+"), "+
+		"(SELECT MAX(CAST(strftime('%s', m.date) AS INTEGER)) FROM messages m "+
+		"WHERE m.sender = r.sender AND m.receiver = r.receiver "+directMessageNotDeletedClause+"), "+
+		"(SELECT m.body FROM messages m WHERE m.sender = r.sender AND m.receiver = r.receiver "+
+		directMessageNotDeletedClause+"ORDER BY m.date DESC LIMIT 1) "+
+		"FROM message_requests r INNER JOIN users u ON u.id_user = r.sender "+
+		"WHERE r.receiver = ? ORDER BY r.created_at DESC",
+		user.IdUser)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	requests := []MessageRequest{}
+	for rows.Next() {
+		var request MessageRequest
+		var lastTs sql.NullInt64
+		var lastBody sql.NullString
+		if err := rows.Scan(&request.Peer, &request.Nickname, &request.Messages, &lastTs, &lastBody); err != nil {
+			return nil, err
+		}
+		if request.Messages == 0 {
+			// Every message of the request was deleted by its sender
+			continue
+		}
+		request.LastMessageAt = time.Unix(lastTs.Int64, 0).UTC()
+		request.LastMessagePreview = snippet(lastBody.String, 40)
+		requests = append(requests, request)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return requests, nil
+}
+
+// Database function that accepts a pending message request: the two users become contacts
+func (db *appdbimpl) AcceptMessageRequest(receiver User, sender User) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = removeMessageRequest(tx, receiver, sender)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR IGNORE INTO chat_contacts (id_user, peer) VALUES (?, ?), (?, ?)",
+		receiver.IdUser, sender.IdUser, sender.IdUser, receiver.IdUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Database function that deletes a pending message request together with its messages. The sender can send a new one
+func (db *appdbimpl) DeleteMessageRequest(receiver User, sender User) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = removeMessageRequest(tx, receiver, sender)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM messages WHERE sender = ? AND receiver = ?", sender.IdUser, receiver.IdUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Removes the message request of sender to receiver. It returns ErrMessageRequestNotFound if there's none
+func removeMessageRequest(tx *sql.Tx, receiver User, sender User) error {
+
+	res, err := tx.Exec("DELETE FROM message_requests WHERE sender = ? AND receiver = ?", sender.IdUser, receiver.IdUser)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrMessageRequestNotFound
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Applies the schema changes that can't be expressed with CREATE TABLE IF NOT EXISTS (new columns, new primary keys)
+// to databases created by an older version of the app. Every step is idempotent.
+func migrateDatabase(db *sql.DB) error {
+
+	// Reactions used to be limited to one per user: the primary key now includes the reaction itself.
+	for _, table := range []string{"direct_message_reactions", "group_message_reactions"} {
+		err := rebuildReactionsTable(db, table)
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", table, err)
+		}
+	}
+
+	// Group messages can be polls and system events
+	err := addColumnIfMissing(db, "group_messages", "type", "TEXT NOT NULL DEFAULT 'text'")
+	if err != nil {
+		return fmt.Errorf("migrating group_messages: %w", err)
+	}
+
+	// Photos can have a caption
+	err = addColumnIfMissing(db, "photos", "caption", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return fmt.Errorf("migrating photos: %w", err)
+	}
+
+	// Posts can be GIFs and videos too
+	err = addColumnIfMissing(db, "photos", "media_type", "TEXT NOT NULL DEFAULT 'image'")
+	if err != nil {
+		return fmt.Errorf("migrating photos: %w", err)
+	}
+
+	// Posts can contain several media items: the photos uploaded before have a single one
+	_, err = db.Exec("INSERT INTO photo_media (id_photo, position, media_type) " +
+		"SELECT id_photo, 0, media_type FROM photos WHERE id_photo NOT IN (SELECT id_photo FROM photo_media)")
+	if err != nil {
+		return fmt.Errorf("migrating photo_media: %w", err)
+	}
+
+	// Accounts can be private
+	err = addColumnIfMissing(db, "users", "private", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("migrating users: %w", err)
+	}
+
+	// Users choose who can message them
+	err = addMessagesFromColumn(db)
+	if err != nil {
+		return fmt.Errorf("migrating chat_contacts: %w", err)
+	}
+
+	// Users can be moderators, and can be suspended
+	for column, definition := range map[string]string{
+		"role":         "TEXT NOT NULL DEFAULT 'user'",
+		"suspended_at": "DATETIME",
+	} {
+		err = addColumnIfMissing(db, "users", column, definition)
+		if err != nil {
+			return fmt.Errorf("migrating users: %w", err)
+		}
+	}
+
+	// Comments can be replies, can be edited and can wait for approval. Comments written before have the date of their
+	// photo
+	for column, definition := range map[string]string{
+		"id_parent": "INTEGER REFERENCES comments (id_comment) ON DELETE CASCADE",
+		"date":      "DATETIME",
+		"edited_at": "DATETIME",
+		"approved":  "INTEGER NOT NULL DEFAULT 1",
+	} {
+		err = addColumnIfMissing(db, "comments", column, definition)
+		if err != nil {
+			return fmt.Errorf("migrating comments: %w", err)
+		}
+	}
+	_, err = db.Exec("UPDATE comments SET date = (SELECT date FROM photos WHERE photos.id_photo = comments.id_photo) " +
+		"WHERE date IS NULL")
+	if err != nil {
+		return fmt.Errorf("migrating comments: %w", err)
+	}
+
+	// Likes have a date (used to rank the trending photos). Likes left before have the date of their photo
+	err = addColumnIfMissing(db, "likes", "date", "DATETIME")
+	if err != nil {
+		return fmt.Errorf("migrating likes: %w", err)
+	}
+	_, err = db.Exec("UPDATE likes SET date = (SELECT date FROM photos WHERE photos.id_photo = likes.id_photo) " +
+		"WHERE date IS NULL")
+	if err != nil {
+		return fmt.Errorf("migrating likes: %w", err)
+	}
+
+	// The user search uses a folded copy of the nicknames and their trigrams: the users created before are indexed
+	err = addColumnIfMissing(db, "users", "search_name", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return fmt.Errorf("migrating users: %w", err)
+	}
+	err = indexUnsearchableUsers(db)
+	if err != nil {
+		return fmt.Errorf("migrating user_search_trigrams: %w", err)
+	}
+
+	// Profiles have a display name, a bio and a website
+	for _, column := range []string{"display_name", "bio", "website"} {
+		err = addColumnIfMissing(db, "users", column, "TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return fmt.Errorf("migrating users: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Adds the messages_from column to the users. The conversations that already exist are accepted ones: the two users
+// become contacts (unless the conversation is a pending message request). The contacts are filled only together with
+// the column, so that the messages aren't scanned again at every startup
+func addMessagesFromColumn(db *sql.DB) error {
+
+	columns, err := tableColumns(db, "users")
+	if err != nil {
+		return err
+	}
+	if _, exists := columns["messages_from"]; exists {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("ALTER TABLE users ADD COLUMN messages_from TEXT NOT NULL DEFAULT 'everyone'")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("WITH accepted (sender, receiver) AS (SELECT sender, receiver FROM messages m " +
+		"WHERE NOT EXISTS (SELECT 1 FROM message_requests r WHERE r.sender = m.sender AND r.receiver = m.receiver)) " +
+		"INSERT OR IGNORE INTO chat_contacts (id_user, peer) " +
+		"SELECT sender, receiver FROM accepted UNION SELECT receiver, sender FROM accepted")
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Builds the search index of the users that aren't indexed yet
+func indexUnsearchableUsers(db *sql.DB) error {
+
+	rows, err := db.Query("SELECT id_user, nickname FROM users WHERE search_name = '' AND id_user != ?", DeletedUserId)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	nicknames := make(map[string]string)
+	for rows.Next() {
+		var id, nickname string
+		if err := rows.Scan(&id, &nickname); err != nil {
+			return err
+		}
+		nicknames[id] = nickname
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	_ = rows.Close()
+	if len(nicknames) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for id, nickname := range nicknames {
+		if err := indexUserSearch(tx, User{IdUser: id}, nickname); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Adds a column to a table if it doesn't exist yet
+func addColumnIfMissing(db *sql.DB, table string, column string, definition string) error {
+
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if _, exists := columns[column]; exists {
+		return nil
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
+
+// Returns the columns of a table, mapped to their position in the primary key (0 if not part of it)
+func tableColumns(db *sql.DB, table string) (map[string]int, error) {
+
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns := make(map[string]int)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[strings.ToLower(name)] = pk
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return columns, nil
+}
+
+// Recreates a reactions table whose primary key doesn't include the reaction, keeping the existing rows
+func rebuildReactionsTable(db *sql.DB, table string) error {
+
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	if columns["reaction"] != 0 {
+		return nil
+	}
+
+	referenced := "messages"
+	if table == "group_message_reactions" {
+		referenced = "group_messages"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmts := []string{
+		"ALTER TABLE " + table + " RENAME TO " + table + "_old",
+		`CREATE TABLE ` + table + ` (
+			message_id INTEGER NOT NULL,
+			id_user VARCHAR(16) NOT NULL,
+			reaction TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (message_id, id_user, reaction),
+			FOREIGN KEY(message_id) REFERENCES ` + referenced + ` (id) ON DELETE CASCADE,
+			FOREIGN KEY(id_user) REFERENCES users (id_user) ON DELETE CASCADE
+			);`,
+		"INSERT INTO " + table + " (message_id, id_user, reaction, created_at) " +
+			"SELECT message_id, id_user, reaction, created_at FROM " + table + "_old",
+		"DROP TABLE " + table + "_old",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
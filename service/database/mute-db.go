@@ -0,0 +1,102 @@
+package database
+
+// Database function that mutes a user (muted) for another (muter)
+func (db *appdbimpl) MuteUser(muter User, muted User) error {
+	return db.addRelationship("INSERT OR IGNORE INTO muted_users (muter, muted) VALUES (?, ?)", muter, muted)
+}
+
+// Database function that unmutes a user (muted) for another (muter)
+func (db *appdbimpl) UnmuteUser(muter User, muted User) error {
+
+	_, err := db.c.Exec("DELETE FROM muted_users WHERE muter = ? AND muted = ?", muter.IdUser, muted.IdUser)
+	return err
+}
+
+// Database function that restricts a user (restricted) for another (restricter)
+func (db *appdbimpl) RestrictUser(restricter User, restricted User) error {
+	return db.addRelationship("INSERT OR IGNORE INTO restricted_users (restricter, restricted) VALUES (?, ?)",
+		restricter, restricted)
+}
+
+// Database function that unrestricts a user (restricted) for another (restricter). The comments of the restricted user
+// waiting for approval on the photos of the restricter are approved
+func (db *appdbimpl) UnrestrictUser(restricter User, restricted User) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("DELETE FROM restricted_users WHERE restricter = ? AND restricted = ?",
+		restricter.IdUser, restricted.IdUser)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE comments SET approved = 1 WHERE approved = 0 AND id_user = ? "+
+		"AND id_photo IN (SELECT id_photo FROM photos WHERE id_user = ?)",
+		restricted.IdUser, restricter.IdUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Database function that retrieves the users muted by a user, ordered by nickname
+func (db *appdbimpl) GetMutedUsers(muter User) ([]CompleteUser, error) {
+	return db.listRelationship("SELECT u.id_user, u.nickname FROM muted_users m "+
+		"INNER JOIN users u ON u.id_user = m.muted WHERE m.muter = ? ORDER BY u.nickname", muter)
+}
+
+// Database function that retrieves the users restricted by a user, ordered by nickname
+func (db *appdbimpl) GetRestrictedUsers(restricter User) ([]CompleteUser, error) {
+	return db.listRelationship("SELECT u.id_user, u.nickname FROM restricted_users r "+
+		"INNER JOIN users u ON u.id_user = r.restricted WHERE r.restricter = ? ORDER BY u.nickname", restricter)
+}
+
+// Database function that checks if a user muted and restricted another
+func (db *appdbimpl) GetMuteRestrict(a User, b User) (bool, bool, error) {
+
+	var muted, restricted bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 FROM muted_users WHERE muter = ? AND muted = ?), "+
+		"EXISTS (SELECT 1 FROM restricted_users WHERE restricter = ? AND restricted = ?)",
+		a.IdUser, b.IdUser, a.IdUser, b.IdUser).Scan(&muted, &restricted)
+	return muted, restricted, err
+}
+
+// Runs insert (with the two users as arguments) if the second user exists. It returns ErrUserNotFound otherwise
+func (db *appdbimpl) addRelationship(insert string, a User, b User) error {
+
+	exists, err := db.CheckUser(b)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	_, err = db.c.Exec(insert, a.IdUser, b.IdUser)
+	return err
+}
+
+// Runs query (with the user as argument) and scans the users it returns
+func (db *appdbimpl) listRelationship(query string, user User) ([]CompleteUser, error) {
+
+	rows, err := db.c.Query(query, user.IdUser)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	users := []CompleteUser{}
+	for rows.Next() {
+		var u CompleteUser
+		if err := rows.Scan(&u.IdUser, &u.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return users, nil
+}
@@ -1,5 +1,7 @@
 package database
 
+import "time"
+
 // Database function that gets a user's nickname
 func (db *appdbimpl) GetNickname(user User) (string, error) {
 
@@ -25,10 +27,34 @@ func (db *appdbimpl) ModifyNickname(user User, newNickname Nickname) error {
 		return ErrNicknameAlreadyTaken
 	}
 
-	_, err = db.c.Exec(`UPDATE users SET nickname = ? WHERE id_user = ?`, newNickname.Nickname, user.IdUser)
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var oldNickname string
+	err = tx.QueryRow(`SELECT nickname FROM users WHERE id_user = ?`, user.IdUser).Scan(&oldNickname)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE users SET nickname = ? WHERE id_user = ?`, newNickname.Nickname, user.IdUser)
 	if err != nil {
 		// Error during the execution of the query
 		return err
 	}
-	return nil
+	err = indexUserSearch(tx, user, newNickname.Nickname)
+	if err != nil {
+		return err
+	}
+
+	// The nickname history goes in the export of the user's data. The identifier set at the signup isn't a nickname
+	if oldNickname != newNickname.Nickname && oldNickname != user.IdUser {
+		_, err = tx.Exec("INSERT INTO nickname_history (id_user, old_nickname, new_nickname, changed_at) VALUES (?, ?, ?, ?)",
+			user.IdUser, oldNickname, newNickname.Nickname, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
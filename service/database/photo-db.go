@@ -1,66 +1,64 @@
 package database
 
-// Database function that retrieves the list of photos of a user (only if the requesting user is not banned by that user)
-func (db *appdbimpl) GetPhotosList(requestingUser User, targetUser User) ([]Photo, error) { // requestinUser User,
-
-	rows, err := db.c.Query("SELECT * FROM photos WHERE id_user = ? ORDER BY date DESC", targetUser.IdUser)
-	if err != nil {
-		return nil, err
-	}
-	// Wait for the function to finish before closing rows
-	defer func() { _ = rows.Close() }()
-
-	// Read all the photos in the resulset
-	var photos []Photo
-	for rows.Next() {
-		var photo Photo
-		err = rows.Scan(&photo.PhotoId, &photo.Owner, &photo.Date)
-		if err != nil {
-			return nil, err
-		}
-
-		comments, err := db.GetCompleteCommentsList(requestingUser, targetUser, PhotoId{IdPhoto: int64(photo.PhotoId)}) // Old: GetCommentsLen
-		if err != nil {
-			return nil, err
-		}
-		photo.Comments = comments
-
-		likes, err := db.GetLikesList(requestingUser, targetUser, PhotoId{IdPhoto: int64(photo.PhotoId)}) // Old: GetLikesLen
-		if err != nil {
-			return nil, err
-		}
-		photo.Likes = likes
-
-		photos = append(photos, photo)
-	}
-
-	if rows.Err() != nil {
-		return nil, err
-	}
-
-	return photos, nil
+import (
+	"database/sql"
+	"errors"
+)
+
+// Database function that retrieves a page of the photos of a user, newest first (only if the requesting user and the
+// owner didn't ban each other). The photos of private accounts are listed only to the approved followers
+func (db *appdbimpl) GetUserPhotos(requestingUser User, owner User, beforeId int64, limit int) ([]Photo, error) {
+	return db.queryPhotosPage(requestingUser, "p.id_user = ? ", []interface{}{owner.IdUser}, beforeId, limit)
 }
 
 // Database function that retrieves a specific photo (only if the requesting user is not banned by that owner of that photo).
+// Returns ErrPhotoDoesntExist if the photo doesn't exist, ErrUserBanned if the owner banned the requesting user and
+// ErrPrivateAccount if the owner is private and the requesting user isn't an approved follower. With the last two
+// errors, only the identifier and the owner of the photo are returned
 func (db *appdbimpl) GetPhoto(requestinUser User, targetPhoto PhotoId) (Photo, error) {
 
 	var photo Photo
-	err := db.c.QueryRow("SELECT * FROM photos WHERE (id_photo = ?) AND id_user NOT IN (SELECT banner FROM banned_user WHERE banned = ?)",
-		targetPhoto.IdPhoto, requestinUser.IdUser).Scan(&photo)
-
-	if err != nil {
-		return Photo{}, ErrUserBanned
+	var banned, visible bool
+	err := db.c.QueryRow("SELECT p.id_photo, p.id_user, p.date, p.caption, p.media_type, "+
+		"EXISTS (SELECT 1 FROM banned_users b WHERE b.banner = p.id_user AND b.banned = ?), "+
+		"EXISTS (SELECT 1 FROM photos p WHERE p.id_photo = ? "+privacyClause+") "+
+		"FROM photos p WHERE p.id_photo = ?",
+		requestinUser.IdUser, targetPhoto.IdPhoto, requestinUser.IdUser, requestinUser.IdUser, targetPhoto.IdPhoto).Scan(
+		&photo.PhotoId, &photo.Owner, &photo.Date, &photo.Caption, &photo.MediaType, &banned, &visible)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Photo{}, ErrPhotoDoesntExist
+	} else if err != nil {
+		return Photo{}, err
+	}
+	if banned {
+		return Photo{PhotoId: photo.PhotoId, Owner: photo.Owner}, ErrUserBanned
+	}
+	if !visible {
+		return Photo{PhotoId: photo.PhotoId, Owner: photo.Owner}, ErrPrivateAccount
 	}
 
-	return photo, nil
+	photos := []Photo{photo}
+	err = db.attachPhotoMedia(photos)
+	return photos[0], err
 
 }
 
-// Database function that creates a photo on the database and returns the unique photo id
+// Database function that creates a photo (with its caption, hashtags and media items) on the database and returns the
+// unique photo id
 func (db *appdbimpl) CreatePhoto(p Photo) (int64, error) {
 
-	res, err := db.c.Exec("INSERT INTO photos (id_user,date) VALUES (?,?)",
-		p.Owner, p.Date)
+	tx, err := db.c.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The media type of the photo is the one of its cover
+	if len(p.Media) > 0 {
+		p.MediaType = p.Media[0].MediaType
+	}
+	res, err := tx.Exec("INSERT INTO photos (id_user,date,caption,media_type) VALUES (?,?,?,?)",
+		p.Owner, p.Date, p.Caption, p.MediaType)
 
 	if err != nil {
 		// Error executing query
@@ -73,25 +71,89 @@ func (db *appdbimpl) CreatePhoto(p Photo) (int64, error) {
 		return -1, err
 	}
 
+	err = replacePhotoTags(tx, photoId, p.Caption)
+	if err != nil {
+		return -1, err
+	}
+
+	err = insertPhotoMedia(tx, photoId, p)
+	if err != nil {
+		return -1, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
 	return photoId, nil
 }
 
+// Database function that changes the caption of a photo of the owner (hashtags included). Returns ErrPhotoDoesntExist
+// if the owner has no such photo
+func (db *appdbimpl) SetPhotoCaption(owner User, p PhotoId, caption string) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.Exec("UPDATE photos SET caption = ? WHERE id_photo = ? AND id_user = ?", caption, p.IdPhoto, owner.IdUser)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPhotoDoesntExist
+	}
+
+	err = replacePhotoTags(tx, p.IdPhoto, caption)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 /*
 Adding the owner is an additional security measure to delete photos that are actually owned
 by that user
 */
 
-// Database function that removes a photo from the database
-func (db *appdbimpl) RemovePhoto(owner User, p PhotoId) error {
+// Database function that removes a photo from the database and returns the number of its media items
+func (db *appdbimpl) RemovePhoto(owner User, p PhotoId) (int, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var items int
+	err = tx.QueryRow("SELECT COUNT(*) FROM photo_media WHERE id_photo = ?", p.IdPhoto).Scan(&items)
+	if err != nil {
+		return 0, err
+	}
+	if items == 0 {
+		items = 1
+	}
 
-	_, err := db.c.Exec("DELETE FROM photos WHERE id_user = ? AND id_photo = ? ",
+	res, err := tx.Exec("DELETE FROM photos WHERE id_user = ? AND id_photo = ? ",
 		owner.IdUser, p.IdPhoto)
 	if err != nil {
 		// Error during the execution of the query
-		return err
+		return 0, err
 	}
 
-	return nil
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrPhotoDoesntExist
+	}
+	return items, tx.Commit()
 }
 
 // [Util] Database function that checks if a photo exists
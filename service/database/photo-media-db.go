@@ -0,0 +1,61 @@
+package database
+
+import "database/sql"
+
+// Inserts the media items of a new photo. A photo without items gets a single one of its media type
+func insertPhotoMedia(tx *sql.Tx, photoId int64, p Photo) error {
+	items := p.Media
+	if len(items) == 0 {
+		items = []MediaItem{{Position: 0, MediaType: p.MediaType}}
+	}
+	for _, item := range items {
+		_, err := tx.Exec("INSERT INTO photo_media (id_photo, position, media_type) VALUES (?,?,?)",
+			photoId, item.Position, item.MediaType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loads the media items of the photos with one query. Photos without items (never the case after the migration) get a
+// single one of their media type
+func (db *appdbimpl) attachPhotoMedia(photos []Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(photos))
+	args := make([]interface{}, 0, len(photos))
+	for i, p := range photos {
+		index[int64(p.PhotoId)] = i
+		args = append(args, p.PhotoId)
+	}
+
+	rows, err := db.c.Query("SELECT id_photo, position, media_type FROM photo_media "+
+		"WHERE id_photo IN ("+placeholders(len(photos))+") ORDER BY id_photo, position", args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var photoId int64
+		var item MediaItem
+		if err := rows.Scan(&photoId, &item.Position, &item.MediaType); err != nil {
+			return err
+		}
+		p := &photos[index[photoId]]
+		p.Media = append(p.Media, item)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	for i := range photos {
+		if len(photos[i].Media) == 0 {
+			photos[i].Media = []MediaItem{{Position: 0, MediaType: photos[i].MediaType}}
+		}
+	}
+	return nil
+}
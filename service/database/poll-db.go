@@ -0,0 +1,382 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CreateGroupPoll inserts a poll message into a group conversation. The question is used as message body.
+func (db *appdbimpl) CreateGroupPoll(groupId int64, from User, poll NewPoll) (int64, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	messageID, err := insertGroupMessage(tx, groupId, from, poll.Question, GroupMessagePoll, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	var closesAt interface{}
+	if poll.ClosesAt != nil {
+		closesAt = poll.ClosesAt.UTC()
+	}
+	_, err = tx.Exec(
+		"INSERT INTO group_polls (message_id, id_group, question, multiple_choice, anonymous, closes_at) VALUES (?,?,?,?,?,?)",
+		messageID, groupId, poll.Question, poll.MultipleChoice, poll.Anonymous, closesAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	for i, option := range poll.Options {
+		_, err = tx.Exec("INSERT INTO group_poll_options (message_id, position, text) VALUES (?,?,?)", messageID, i, option)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
+
+// ListGroupPolls returns the polls (with their tally) of the given group messages. Both the poll messages and the
+// "poll_closed" events are keys of the map, so that the event can show the final results.
+func (db *appdbimpl) ListGroupPolls(groupId int64, messageIds []int64, viewer User) (map[int64]Poll, error) {
+	out := make(map[int64]Poll)
+	if len(messageIds) == 0 {
+		return out, nil
+	}
+
+	args := make([]interface{}, 0, 2*len(messageIds)+1)
+	args = append(args, groupId)
+	for _, id := range messageIds {
+		args = append(args, id)
+	}
+	for _, id := range messageIds {
+		args = append(args, id)
+	}
+	rows, err := db.c.Query(
+		"SELECT message_id, question, multiple_choice, anonymous, closes_at, closed_at, closed_event_id FROM group_polls "+
+			"WHERE id_group = ? AND (message_id IN ("+placeholders(len(messageIds))+") "+
+			"OR closed_event_id IN ("+placeholders(len(messageIds))+"))",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	polls := make(map[int64]*Poll)
+	events := make(map[int64]int64)
+	var pollIds []int64
+	for rows.Next() {
+		var p Poll
+		var closesAt, closedAt sql.NullTime
+		var eventID sql.NullInt64
+		if err := rows.Scan(&p.MessageId, &p.Question, &p.MultipleChoice, &p.Anonymous, &closesAt, &closedAt, &eventID); err != nil {
+			return nil, err
+		}
+		if closesAt.Valid {
+			p.ClosesAt = &closesAt.Time
+		}
+		if closedAt.Valid {
+			p.Closed = true
+			p.ClosedAt = &closedAt.Time
+		}
+		if eventID.Valid {
+			events[eventID.Int64] = p.MessageId
+		}
+		polls[p.MessageId] = &p
+		pollIds = append(pollIds, p.MessageId)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	if len(pollIds) == 0 {
+		return out, nil
+	}
+
+	if err := db.loadPollOptions(polls, pollIds); err != nil {
+		return nil, err
+	}
+	if err := db.loadPollVotes(polls, pollIds, viewer); err != nil {
+		return nil, err
+	}
+
+	for id, p := range polls {
+		out[id] = *p
+	}
+	for eventID, pollID := range events {
+		out[eventID] = *polls[pollID]
+	}
+	return out, nil
+}
+
+func (db *appdbimpl) loadPollOptions(polls map[int64]*Poll, pollIds []int64) error {
+	args := make([]interface{}, 0, len(pollIds))
+	for _, id := range pollIds {
+		args = append(args, id)
+	}
+	rows, err := db.c.Query(
+		"SELECT message_id, position, text FROM group_poll_options "+
+			"WHERE message_id IN ("+placeholders(len(pollIds))+") ORDER BY message_id, position",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var pollID int64
+		var option PollOption
+		if err := rows.Scan(&pollID, &option.Option, &option.Text); err != nil {
+			return err
+		}
+		polls[pollID].Options = append(polls[pollID].Options, option)
+	}
+	return rows.Err()
+}
+
+func (db *appdbimpl) loadPollVotes(polls map[int64]*Poll, pollIds []int64, viewer User) error {
+	args := make([]interface{}, 0, len(pollIds))
+	for _, id := range pollIds {
+		args = append(args, id)
+	}
+	rows, err := db.c.Query(
+		"SELECT v.message_id, v.position, v.id_user, u.nickname FROM group_poll_votes v "+
+			"INNER JOIN users u ON u.id_user = v.id_user "+
+			"WHERE v.message_id IN ("+placeholders(len(pollIds))+") ORDER BY v.voted_at",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	voters := make(map[int64]map[string]bool)
+	for rows.Next() {
+		var pollID int64
+		var position int
+		var voter CompleteUser
+		if err := rows.Scan(&pollID, &position, &voter.IdUser, &voter.Nickname); err != nil {
+			return err
+		}
+		p := polls[pollID]
+		if position < 0 || position >= len(p.Options) {
+			continue
+		}
+		option := &p.Options[position]
+		option.Votes++
+		if voter.IdUser == viewer.IdUser {
+			option.VotedByMe = true
+		}
+		if !p.Anonymous {
+			option.VotedBy = append(option.VotedBy, voter)
+		}
+		if voters[pollID] == nil {
+			voters[pollID] = make(map[string]bool)
+		}
+		voters[pollID][voter.IdUser] = true
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	for pollID, users := range voters {
+		polls[pollID].Voters = len(users)
+	}
+	return nil
+}
+
+// VoteGroupPoll adds the vote of the user to an option. In single choice polls the previous vote of the user is
+// replaced.
+func (db *appdbimpl) VoteGroupPoll(groupId int64, messageId int64, user User, option int) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	multipleChoice, err := openPollOption(tx, groupId, messageId, option)
+	if err != nil {
+		return err
+	}
+	if !multipleChoice {
+		_, err = tx.Exec("DELETE FROM group_poll_votes WHERE message_id = ? AND id_user = ? AND position <> ?",
+			messageId, user.IdUser, option)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		"INSERT OR IGNORE INTO group_poll_votes (message_id, position, id_user, voted_at) VALUES (?,?,?,?)",
+		messageId, option, user.IdUser, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnvoteGroupPoll removes the vote of the user from an option.
+func (db *appdbimpl) UnvoteGroupPoll(groupId int64, messageId int64, user User, option int) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := openPollOption(tx, groupId, messageId, option); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM group_poll_votes WHERE message_id = ? AND id_user = ? AND position = ?",
+		messageId, user.IdUser, option)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Checks that a (not deleted) poll of the group is still open and has the given option. Returns whether the poll
+// is multiple choice.
+func openPollOption(tx *sql.Tx, groupId int64, messageId int64, option int) (bool, error) {
+	var multipleChoice bool
+	var closesAt, closedAt sql.NullTime
+	err := tx.QueryRow(
+		"SELECT multiple_choice, closes_at, closed_at FROM group_polls "+
+			"WHERE message_id = ? AND id_group = ? "+
+			"AND message_id NOT IN (SELECT message_id FROM group_message_deletions WHERE id_group = ?)",
+		messageId, groupId, groupId,
+	).Scan(&multipleChoice, &closesAt, &closedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrPollNotFound
+	} else if err != nil {
+		return false, err
+	}
+	if closedAt.Valid || (closesAt.Valid && !closesAt.Time.After(time.Now())) {
+		return false, ErrPollClosed
+	}
+
+	var cnt int
+	err = tx.QueryRow("SELECT COUNT(*) FROM group_poll_options WHERE message_id = ? AND position = ?", messageId, option).
+		Scan(&cnt)
+	if err != nil {
+		return false, err
+	}
+	if cnt == 0 {
+		return false, ErrPollOptionNotFound
+	}
+	return multipleChoice, nil
+}
+
+// CloseGroupPoll closes a poll before its close time. Only the creator of the poll can close it.
+func (db *appdbimpl) CloseGroupPoll(groupId int64, messageId int64, closedBy User) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var sender, question string
+	var closesAt, closedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT gm.sender, p.question, p.closes_at, p.closed_at FROM group_polls p "+
+			"INNER JOIN group_messages gm ON gm.id = p.message_id "+
+			"WHERE p.message_id = ? AND p.id_group = ? "+
+			"AND p.message_id NOT IN (SELECT message_id FROM group_message_deletions WHERE id_group = ?)",
+		messageId, groupId, groupId,
+	).Scan(&sender, &question, &closesAt, &closedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPollNotFound
+	} else if err != nil {
+		return err
+	}
+	if sender != closedBy.IdUser {
+		return ErrForbiddenMessageAction
+	}
+	if closedAt.Valid || (closesAt.Valid && !closesAt.Time.After(time.Now())) {
+		return ErrPollClosed
+	}
+
+	if _, err := closePoll(tx, groupId, messageId, User{IdUser: sender}, question, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CloseExpiredGroupPolls closes the polls of the group whose close time has passed. The "poll_closed" events are
+// dated at the close time of each poll, so they appear in the right place of the conversation.
+func (db *appdbimpl) CloseExpiredGroupPolls(groupId int64) error {
+	rows, err := db.c.Query(
+		"SELECT p.message_id, gm.sender, p.question, p.closes_at FROM group_polls p "+
+			"INNER JOIN group_messages gm ON gm.id = p.message_id "+
+			"WHERE p.id_group = ? AND p.closed_at IS NULL AND p.closes_at IS NOT NULL AND p.closes_at <= ? "+
+			"AND p.message_id NOT IN (SELECT message_id FROM group_message_deletions WHERE id_group = ?)",
+		groupId, time.Now().UTC(), groupId,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	type expiredPoll struct {
+		messageID int64
+		sender    string
+		question  string
+		closesAt  time.Time
+	}
+	var expired []expiredPoll
+	for rows.Next() {
+		var p expiredPoll
+		if err := rows.Scan(&p.messageID, &p.sender, &p.question, &p.closesAt); err != nil {
+			return err
+		}
+		expired = append(expired, p)
+	}
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+	_ = rows.Close()
+
+	for _, p := range expired {
+		tx, err := db.c.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := closePoll(tx, groupId, p.messageID, User{IdUser: p.sender}, p.question, p.closesAt.UTC()); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marks a poll as closed and adds the "poll_closed" event (sent on behalf of the poll creator). Returns false if the
+// poll was already closed by someone else in the meantime.
+func closePoll(tx *sql.Tx, groupId int64, messageId int64, creator User, question string, date time.Time) (bool, error) {
+	res, err := tx.Exec("UPDATE group_polls SET closed_at = ? WHERE message_id = ? AND closed_at IS NULL", date, messageId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	eventID, err := insertGroupMessage(tx, groupId, creator, "Poll closed: "+question, GroupMessagePollClosed, date)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE group_polls SET closed_event_id = ? WHERE message_id = ?", eventID, messageId)
+	return err == nil, err
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Database function that retrieves the profile of a user with the number of his/her followers, followed users and
+// photos
+func (db *appdbimpl) GetProfile(u User) (Profile, error) {
+
+	profile := Profile{IdUser: u.IdUser}
+	err := db.c.QueryRow("SELECT nickname, display_name, bio, website, "+
+		"(SELECT COUNT(*) FROM followers WHERE followed = users.id_user), "+
+		"(SELECT COUNT(*) FROM followers WHERE follower = users.id_user), "+
+		"(SELECT COUNT(*) FROM photos p WHERE p.id_user = users.id_user) "+
+		"FROM users WHERE id_user = ?", u.IdUser).Scan(&profile.Nickname, &profile.DisplayName, &profile.Bio,
+		&profile.Website, &profile.FollowersCount, &profile.FollowingCount, &profile.PhotosCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, ErrUserNotFound
+	}
+	return profile, err
+}
+
+// Database function that changes the display name, the bio and the website of a user
+func (db *appdbimpl) SetProfileInfo(u User, info ProfileInfo) error {
+
+	res, err := db.c.Exec("UPDATE users SET display_name = ?, bio = ?, website = ? WHERE id_user = ?",
+		info.DisplayName, info.Bio, info.Website, u.IdUser)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
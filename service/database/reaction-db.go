@@ -0,0 +1,135 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// SummarizeDirectMessageReactions aggregates the reactions of the given direct messages by emoji, in a single query.
+// Reactions of a message are sorted by first use. Messages without reactions are not included in the map.
+func (db *appdbimpl) SummarizeDirectMessageReactions(messageIds []int64, viewer User) (map[int64][]ReactionSummary, error) {
+	return db.summarizeReactions("direct_message_reactions", messageIds, viewer)
+}
+
+// SummarizeGroupMessageReactions is the group counterpart of SummarizeDirectMessageReactions. Messages that don't
+// belong to the group are ignored.
+func (db *appdbimpl) SummarizeGroupMessageReactions(groupId int64, messageIds []int64, viewer User) (map[int64][]ReactionSummary, error) {
+	var inGroup []int64
+	if len(messageIds) > 0 {
+		args := make([]interface{}, 0, len(messageIds)+1)
+		args = append(args, groupId)
+		for _, id := range messageIds {
+			args = append(args, id)
+		}
+		rows, err := db.c.Query("SELECT id FROM group_messages WHERE id_group = ? AND id IN ("+placeholders(len(messageIds))+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			inGroup = append(inGroup, id)
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+	}
+	return db.summarizeReactions("group_message_reactions", inGroup, viewer)
+}
+
+func (db *appdbimpl) summarizeReactions(table string, messageIds []int64, viewer User) (map[int64][]ReactionSummary, error) {
+	out := make(map[int64][]ReactionSummary)
+	if len(messageIds) == 0 {
+		return out, nil
+	}
+
+	args := make([]interface{}, 0, len(messageIds)+1)
+	args = append(args, viewer.IdUser)
+	for _, id := range messageIds {
+		args = append(args, id)
+	}
+	rows, err := db.c.Query(
+		"SELECT message_id, reaction, COUNT(*), MAX(CASE WHEN id_user = ? THEN 1 ELSE 0 END) "+
+			"FROM "+table+" WHERE message_id IN ("+placeholders(len(messageIds))+") "+
+			"GROUP BY message_id, reaction ORDER BY message_id, MIN(created_at)",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var messageID int64
+		var rs ReactionSummary
+		var mine int
+		if err := rows.Scan(&messageID, &rs.Reaction, &rs.Count, &mine); err != nil {
+			return nil, err
+		}
+		rs.ReactedByMe = mine == 1
+		out[messageID] = append(out[messageID], rs)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return out, nil
+}
+
+func (db *appdbimpl) listReactions(table string, messageId int64) ([]MessageReaction, error) {
+	rows, err := db.c.Query(
+		"SELECT r.id_user, u.nickname, r.reaction, r.created_at FROM "+table+" r "+
+			"INNER JOIN users u ON u.id_user = r.id_user "+
+			"WHERE r.message_id = ? ORDER BY r.created_at",
+		messageId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []MessageReaction
+	for rows.Next() {
+		var mr MessageReaction
+		if err := rows.Scan(&mr.UserID, &mr.Nickname, &mr.Reaction, &mr.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, mr)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return out, nil
+}
+
+func (db *appdbimpl) replaceReaction(table string, messageId int64, user User, reaction string) error {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("DELETE FROM "+table+" WHERE message_id = ? AND id_user = ?", messageId, user.IdUser)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO "+table+" (message_id, id_user, reaction, created_at) VALUES (?,?,?,?)",
+		messageId, user.IdUser, reaction, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Returns n comma separated SQL placeholders (e.g. "?,?,?")
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?,", n-1) + "?"
+}
@@ -7,21 +7,34 @@ import (
 )
 
 func (db *appdbimpl) MarkDirectConversationRead(reader User, peer User) error {
-	// Mark as read all messages sent by peer to reader.
+	// Mark as read all messages sent by peer to reader. The messages of a pending message request stay unread, so
+	// that the sender doesn't know whether it was seen
 	_, err := db.c.Exec(
 		"UPDATE direct_message_receipts SET read_at = ? "+
 			"WHERE receiver_id = ? AND read_at IS NULL "+
-			"AND message_id IN (SELECT id FROM messages WHERE sender = ? AND receiver = ?)",
-		time.Now().UTC(), reader.IdUser, peer.IdUser, reader.IdUser,
+			"AND message_id IN (SELECT id FROM messages WHERE sender = ? AND receiver = ?) "+
+			"AND NOT EXISTS (SELECT 1 FROM message_requests WHERE sender = ? AND receiver = ?)",
+		time.Now().UTC(), reader.IdUser, peer.IdUser, reader.IdUser, peer.IdUser, reader.IdUser,
 	)
 	return err
 }
 
 func (db *appdbimpl) MarkGroupConversationRead(groupId int64, reader User) error {
+	now := time.Now().UTC()
 	_, err := db.c.Exec(
 		"UPDATE group_message_receipts SET read_at = ? "+
 			"WHERE id_group = ? AND id_user = ? AND read_at IS NULL",
-		time.Now().UTC(), groupId, reader.IdUser,
+		now, groupId, reader.IdUser,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Reading the conversation also clears the unread mentions
+	_, err = db.c.Exec(
+		"UPDATE group_message_mentions SET read_at = ? "+
+			"WHERE id_group = ? AND id_user = ? AND read_at IS NULL",
+		now, groupId, reader.IdUser,
 	)
 	return err
 }
@@ -0,0 +1,322 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Columns of a Report (see scanReport). The query must select from reports (r)
+const reportColumns = "SELECT r.id_report, r.reporter, r.target_type, r.target_id, r.reported_user, r.content, r.reason, " +
+	"r.details, r.status, r.created_at, r.resolved_at, r.resolved_by, " +
+	"(SELECT COUNT(*) FROM reports o WHERE o.target_type = r.target_type AND o.target_id = r.target_id AND o.status = 'open') " +
+	"FROM reports r "
+
+// Scans a row of reportColumns
+func scanReport(row interface{ Scan(...interface{}) error }) (Report, error) {
+	var report Report
+	var resolvedAt sql.NullTime
+	var resolvedBy sql.NullString
+	err := row.Scan(&report.IdReport, &report.Reporter, &report.TargetType, &report.TargetId, &report.ReportedUser,
+		&report.Content, &report.Reason, &report.Details, &report.Status, &report.CreatedAt, &resolvedAt, &resolvedBy,
+		&report.OpenReports)
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+	if resolvedBy.Valid {
+		report.ResolvedBy = &resolvedBy.String
+	}
+	return report, err
+}
+
+// Database function that saves a report, or updates the open report of the same reporter about the same target
+func (db *appdbimpl) CreateReport(r Report) (int64, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	err = tx.QueryRow("SELECT id_report FROM reports WHERE reporter = ? AND target_type = ? AND target_id = ? AND status = ?",
+		r.Reporter, r.TargetType, r.TargetId, ReportOpen).Scan(&id)
+	if err == nil {
+		_, err = tx.Exec("UPDATE reports SET reason = ?, details = ?, content = ? WHERE id_report = ?",
+			r.Reason, r.Details, r.Content, id)
+		if err != nil {
+			return 0, err
+		}
+		return id, tx.Commit()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	res, err := tx.Exec("INSERT INTO reports (reporter, target_type, target_id, reported_user, content, reason, details, "+
+		"status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.Reporter, r.TargetType, r.TargetId, r.ReportedUser, r.Content, r.Reason, r.Details, ReportOpen, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	id, err = res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Database function that retrieves a page of the reports with a status, oldest first
+func (db *appdbimpl) ListReports(status string, targetType string, afterId int64, limit int) ([]Report, error) {
+
+	query := reportColumns + "WHERE r.status = ? AND r.id_report > ? "
+	args := []interface{}{status, afterId}
+	if targetType != "" {
+		query += "AND r.target_type = ? "
+		args = append(args, targetType)
+	}
+	rows, err := db.c.Query(query+"ORDER BY r.id_report LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	reports := []Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return reports, nil
+}
+
+// Database function that retrieves a report
+func (db *appdbimpl) GetReport(id int64) (Report, error) {
+
+	report, err := scanReport(db.c.QueryRow(reportColumns+"WHERE r.id_report = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+	return report, err
+}
+
+// Database function that resolves the open reports about the target of a report with a moderation action. Removed
+// messages are deleted for everyone (like their sender would), removed photos and comments are deleted with their
+// comments, replies and likes
+func (db *appdbimpl) ResolveReport(moderator User, id int64, action string, note string) (Report, int, error) {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return Report{}, 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	report, err := scanReport(tx.QueryRow(reportColumns+"WHERE r.id_report = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, 0, ErrReportNotFound
+	} else if err != nil {
+		return Report{}, 0, err
+	}
+	if report.Status != ReportOpen {
+		return Report{}, 0, ErrReportResolved
+	}
+
+	now := time.Now().UTC()
+	status := ReportActioned
+	var items int
+	switch action {
+	case ModerationDismiss:
+		status = ReportDismissed
+	case ModerationSuspend:
+		_, err = tx.Exec("UPDATE users SET suspended_at = COALESCE(suspended_at, ?) WHERE id_user = ?",
+			now, report.ReportedUser)
+	case ModerationRemoveContent:
+		items, err = removeReportedContent(tx, moderator, report, now)
+	default:
+		return Report{}, 0, ErrInvalidModerationAction
+	}
+	if err != nil {
+		return Report{}, 0, err
+	}
+
+	// The decision applies to every open report about the same target
+	_, err = tx.Exec("UPDATE reports SET status = ?, resolved_at = ?, resolved_by = ? "+
+		"WHERE target_type = ? AND target_id = ? AND status = ?",
+		status, now, moderator.IdUser, report.TargetType, report.TargetId, ReportOpen)
+	if err != nil {
+		return Report{}, 0, err
+	}
+	// A suspension is logged as an action on the reported user
+	logged := ModerationAction{Moderator: moderator.IdUser, Action: action, TargetType: report.TargetType,
+		TargetId: report.TargetId, IdReport: &report.IdReport, Note: note, Date: now}
+	if action == ModerationSuspend {
+		logged.TargetType, logged.TargetId = ReportUser, report.ReportedUser
+	}
+	err = logModerationAction(tx, logged)
+	if err != nil {
+		return Report{}, 0, err
+	}
+
+	report, err = scanReport(tx.QueryRow(reportColumns+"WHERE r.id_report = ?", id))
+	if err != nil {
+		return Report{}, 0, err
+	}
+	return report, items, tx.Commit()
+}
+
+// Removes the reported content (already removed content is fine). It returns the number of media items of the removed
+// photo, 0 for the other contents
+func removeReportedContent(tx *sql.Tx, moderator User, report Report, now time.Time) (int, error) {
+
+	var err error
+	switch report.TargetType {
+	case ReportPhoto:
+		var items int
+		err = tx.QueryRow("SELECT COUNT(*) FROM photo_media WHERE id_photo = ?", report.TargetId).Scan(&items)
+		if err != nil {
+			return 0, err
+		}
+		res, err := tx.Exec("DELETE FROM photos WHERE id_photo = ? AND id_user = ?", report.TargetId, report.ReportedUser)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil || affected == 0 {
+			return 0, err
+		}
+		if items == 0 {
+			items = 1
+		}
+		return items, nil
+	case ReportComment:
+		_, err = tx.Exec("DELETE FROM comments WHERE id_comment = ?", report.TargetId)
+	case ReportDirectMessage:
+		_, err = tx.Exec("INSERT OR IGNORE INTO direct_message_deletions (message_id, deleted_at, deleted_by) "+
+			"SELECT id, ?, ? FROM messages WHERE id = ?", now, moderator.IdUser, report.TargetId)
+	case ReportGroupMessage:
+		_, err = tx.Exec("INSERT OR IGNORE INTO group_message_deletions (message_id, id_group, deleted_at, deleted_by) "+
+			"SELECT id, id_group, ?, ? FROM group_messages WHERE id = ?", now, moderator.IdUser, report.TargetId)
+	default:
+		// A user isn't a content: it can only be suspended
+		return 0, ErrInvalidModerationAction
+	}
+	return 0, err
+}
+
+// Database function that suspends (reinstates) a user, recording it in the moderation log
+func (db *appdbimpl) SetSuspended(moderator User, u User, suspended bool, note string) error {
+
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	action := ModerationUnsuspend
+	var res sql.Result
+	if suspended {
+		action = ModerationSuspend
+		res, err = tx.Exec("UPDATE users SET suspended_at = COALESCE(suspended_at, ?) WHERE id_user = ?", now, u.IdUser)
+	} else {
+		res, err = tx.Exec("UPDATE users SET suspended_at = NULL WHERE id_user = ?", u.IdUser)
+	}
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	err = logModerationAction(tx, ModerationAction{Moderator: moderator.IdUser, Action: action,
+		TargetType: ReportUser, TargetId: u.IdUser, Note: note, Date: now})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Database function that checks if a user is suspended
+func (db *appdbimpl) IsSuspended(u User) (bool, error) {
+
+	var suspended bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id_user = ? AND suspended_at IS NOT NULL)",
+		u.IdUser).Scan(&suspended)
+	return suspended, err
+}
+
+// Database function that checks if a user is a moderator
+func (db *appdbimpl) IsModerator(u User) (bool, error) {
+
+	var moderator bool
+	err := db.c.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id_user = ? AND role = ?)",
+		u.IdUser, RoleModerator).Scan(&moderator)
+	return moderator, err
+}
+
+// Database function that makes moderators the users with the given identifiers, and regular users the others
+func (db *appdbimpl) SetModerators(ids []string) error {
+
+	args := make([]interface{}, 0, len(ids)+2)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, RoleModerator, RoleUser)
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+
+	_, err := db.c.Exec("UPDATE users SET role = CASE WHEN id_user IN ("+placeholders+") THEN ? ELSE ? END", args...)
+	return err
+}
+
+// Database function that retrieves a page of the moderation log, newest first
+func (db *appdbimpl) ListModerationActions(beforeId int64, limit int) ([]ModerationAction, error) {
+
+	query := "SELECT id_action, moderator, action, target_type, target_id, id_report, note, date FROM moderation_actions "
+	args := []interface{}{}
+	if beforeId > 0 {
+		query += "WHERE id_action < ? "
+		args = append(args, beforeId)
+	}
+	rows, err := db.c.Query(query+"ORDER BY id_action DESC LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	actions := []ModerationAction{}
+	for rows.Next() {
+		var action ModerationAction
+		var report sql.NullInt64
+		err := rows.Scan(&action.IdAction, &action.Moderator, &action.Action, &action.TargetType, &action.TargetId,
+			&report, &action.Note, &action.Date)
+		if err != nil {
+			return nil, err
+		}
+		if report.Valid {
+			action.IdReport = &report.Int64
+		}
+		actions = append(actions, action)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	return actions, nil
+}
+
+// Records an action in the moderation log. The log has no foreign keys: its entries outlive the users, contents and
+// reports they are about
+func logModerationAction(tx *sql.Tx, a ModerationAction) error {
+
+	_, err := tx.Exec("INSERT INTO moderation_actions (moderator, action, target_type, target_id, id_report, note, date) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?)", a.Moderator, a.Action, a.TargetType, a.TargetId, a.IdReport, a.Note, a.Date)
+	return err
+}
@@ -1,11 +1,127 @@
 package database
 
-// Database function that filters the users by a parameter. Any partial match is included in the result.
-// Returns a list of matching users (either by nickname or identifier)
-func (db *appdbimpl) SearchUser(searcher User, userToSearch User) ([]CompleteUser, error) {
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
 
-	rows, err := db.c.Query("SELECT * FROM users WHERE ((id_user LIKE ?) OR (nickname LIKE ?)) AND id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?)",
-		userToSearch.IdUser+"%", userToSearch.IdUser+"%", searcher.IdUser)
+// Relevance of a user search: a text match (exact, prefix, substring of the nickname or the identifier) plus the
+// trigram similarity (0-100) scaled to searchSimilarityWeight, plus searchFollowedBoost for the followed users
+const searchExactScore = 100
+const searchPrefixScore = 60
+const searchSubstringScore = 40
+const searchSimilarityWeight = 40
+const searchFollowedBoost = 30
+
+// Users without a text match need at least this trigram similarity (in percent) to be found: it tolerates a typo or
+// two in a nickname
+const minSearchSimilarity = 30
+
+// Accented letters and ligatures folded by foldSearchText
+var searchFolding = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	'æ': "ae", 'œ': "oe", 'þ': "th",
+}
+
+// Normalizes a text for the user search: lower case, without accents and without surrounding spaces
+func foldSearchText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		r = unicode.ToLower(r)
+		if folded, ok := searchFolding[r]; ok {
+			b.WriteString(folded)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Returns the distinct trigrams of a folded text, padded like pg_trgm (two spaces before, one after) so that the
+// beginning of a nickname weighs more than the rest
+func searchTrigrams(folded string) []string {
+	runes := []rune("  " + folded + " ")
+	seen := make(map[string]bool, len(runes))
+	trigrams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		t := string(runes[i : i+3])
+		if !seen[t] {
+			seen[t] = true
+			trigrams = append(trigrams, t)
+		}
+	}
+	return trigrams
+}
+
+// Updates the search index of a user (his/her folded nickname and its trigrams). ex is the database or the
+// transaction that changed the nickname
+func indexUserSearch(ex interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}, u User, nickname string) error {
+
+	folded := foldSearchText(nickname)
+	_, err := ex.Exec("UPDATE users SET search_name = ? WHERE id_user = ?", folded, u.IdUser)
+	if err != nil {
+		return err
+	}
+	_, err = ex.Exec("DELETE FROM user_search_trigrams WHERE id_user = ?", u.IdUser)
+	if err != nil {
+		return err
+	}
+	for _, t := range searchTrigrams(folded) {
+		_, err = ex.Exec("INSERT INTO user_search_trigrams (trigram, id_user) VALUES (?, ?)", t, u.IdUser)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Database function that searches the users by nickname (case insensitive, accent insensitive and tolerant to typos)
+// or by identifier (case insensitive prefix), best match first. Pages are keyset paginated on the relevance and the
+// identifier of the last user of the previous page (afterId is empty for the first page)
+func (db *appdbimpl) SearchUser(searcher User, query string, afterScore int, afterId string, limit int) ([]UserSearchResult, error) {
+
+	folded := foldSearchText(query)
+	trigrams := searchTrigrams(folded)
+
+	args := make([]interface{}, 0, len(trigrams)+20)
+	for _, t := range trigrams {
+		args = append(args, t)
+	}
+	args = append(args, folded, folded, searchExactScore, folded, folded, searchPrefixScore, folded, searchSubstringScore,
+		len(trigrams), searcher.IdUser, folded, folded, searcher.IdUser, searcher.IdUser, DeletedUserId,
+		searchSimilarityWeight, searchFollowedBoost, minSearchSimilarity, afterId, afterScore, afterScore, afterId, limit)
+
+	// Bans hide the users in both directions. The placeholder of the deleted users isn't a user to find
+	rows, err := db.c.Query("WITH matches (id_user, shared) AS ("+
+		"SELECT id_user, COUNT(*) FROM user_search_trigrams WHERE trigram IN ("+placeholders(len(trigrams))+") "+
+		"GROUP BY id_user), "+
+		"scored AS (SELECT u.id_user, u.nickname, "+
+		"CASE WHEN u.search_name = ? OR lower(u.id_user) = ? THEN ? "+
+		"WHEN instr(u.search_name, ?) = 1 OR instr(lower(u.id_user), ?) = 1 THEN ? "+
+		"WHEN instr(u.search_name, ?) > 0 THEN ? ELSE 0 END AS text_score, "+
+		"CAST(100.0 * COALESCE(m.shared, 0) / (? + (SELECT COUNT(*) FROM user_search_trigrams t WHERE t.id_user = u.id_user) "+
+		"- COALESCE(m.shared, 0)) AS INTEGER) AS similarity, "+
+		"EXISTS (SELECT 1 FROM followers f WHERE f.followed = u.id_user AND f.follower = ?) AS followed "+
+		"FROM users u LEFT JOIN matches m ON m.id_user = u.id_user "+
+		"WHERE (m.id_user IS NOT NULL OR instr(u.search_name, ?) > 0 OR instr(lower(u.id_user), ?) = 1) "+
+		"AND u.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) "+
+		"AND u.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ?) AND u.id_user != ?), "+
+		"ranked AS (SELECT id_user, nickname, followed, text_score + similarity * ? / 100 + followed * ? AS score "+
+		"FROM scored WHERE text_score > 0 OR similarity >= ?) "+
+		"SELECT id_user, nickname, followed, score FROM ranked "+
+		"WHERE ? = '' OR score < ? OR (score = ? AND id_user > ?) ORDER BY score DESC, id_user LIMIT ?",
+		args...)
 	if err != nil {
 		return nil, err
 	}
@@ -13,19 +129,17 @@ func (db *appdbimpl) SearchUser(searcher User, userToSearch User) ([]CompleteUse
 	defer func() { _ = rows.Close() }()
 
 	// Read all the users in the resulset.
-	var res []CompleteUser
+	res := make([]UserSearchResult, 0, limit)
 	for rows.Next() {
-		var user CompleteUser
-		err = rows.Scan(&user.IdUser, &user.Nickname)
+		var user UserSearchResult
+		err = rows.Scan(&user.IdUser, &user.Nickname, &user.FollowedByMe, &user.Score)
 		if err != nil {
 			return nil, err
 		}
 		res = append(res, user)
 	}
-
 	if rows.Err() != nil {
-		return nil, err
+		return nil, rows.Err()
 	}
-
 	return res, nil
 }
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldSearchText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"  Alice  ", "alice"},
+		{"ÉLODIE", "elodie"},
+		{"Zoë Łukasz", "zoe lukasz"},
+		{"Straße", "strasse"},
+		{"Æsir Œuvre Þór", "aesir oeuvre thor"},
+		{"Çağrı Şahin", "cagri sahin"},
+		{"Dvořák_99", "dvorak_99"},
+		{"日本 user", "日本 user"},
+		{"mIxEd.CaSe", "mixed.case"},
+	}
+	for _, tt := range tests {
+		if got := foldSearchText(tt.in); got != tt.want {
+			t.Errorf("foldSearchText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSearchTrigrams(t *testing.T) {
+	tests := []struct {
+		folded string
+		want   []string
+	}{
+		{"a", []string{"  a", " a "}},
+		{"bob", []string{"  b", " bo", "bob", "ob "}},
+		// Repeated trigrams are returned once
+		{"aaaa", []string{"  a", " aa", "aaa", "aa "}},
+		// Trigrams are made of characters, not bytes
+		{"zoë", []string{"  z", " zo", "zoë", "oë "}},
+		{"日本", []string{"  日", " 日本", "日本 "}},
+	}
+	for _, tt := range tests {
+		got := searchTrigrams(tt.folded)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("searchTrigrams(%q) = %q, want %q", tt.folded, got, tt.want)
+		}
+	}
+}
+
+// A typo keeps most of the trigrams of a nickname, so that the similarity stays above minSearchSimilarity
+func TestSearchTrigramsSimilarity(t *testing.T) {
+	similarity := func(a string, b string) int {
+		ta, tb := searchTrigrams(foldSearchText(a)), searchTrigrams(foldSearchText(b))
+		set := make(map[string]bool, len(ta))
+		for _, t := range ta {
+			set[t] = true
+		}
+		shared := 0
+		for _, t := range tb {
+			if set[t] {
+				shared++
+			}
+		}
+		return 100 * shared / (len(ta) + len(tb) - shared)
+	}
+
+	tests := []struct {
+		a, b  string
+		found bool
+	}{
+		{"Élodie", "elodie", true},
+		{"alessandro", "alesandro", true},
+		{"martina", "martnia", true},
+		{"alice", "bob", false},
+		{"giovanni", "gianna", false},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); (got >= minSearchSimilarity) != tt.found {
+			t.Errorf("similarity(%q, %q) = %d, found = %v, want %v", tt.a, tt.b, got, !tt.found, tt.found)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+// Ban filter of the stream: photos of users that banned the requesting user, or that the requesting user banned, are
+// never shown
+const streamBanClause = "AND p.id_user NOT IN (SELECT banner FROM banned_users WHERE banned = ?) " +
+	"AND p.id_user NOT IN (SELECT banned FROM banned_users WHERE banner = ?) "
+
+// Mute filter of the stream: the photos of the users muted by the requesting user aren't shown
+const streamMuteClause = "AND p.id_user NOT IN (SELECT muted FROM muted_users WHERE muter = ?) "
+
+// Suspension filter of the discover mode and of the trending photos: the photos of the suspended users aren't shown,
+// like the users themselves in the follow suggestions
+const streamSuspendedClause = "AND p.id_user NOT IN (SELECT id_user FROM users WHERE suspended_at IS NOT NULL) "
+
+// Database function that retrieves a page of the user's stream, newest photo first. The stream contains the photos of
+// the followed users or, in discover mode, the photos of every user except the requesting one and the suspended ones,
+// minus the muted users. Pages are keyset paginated: beforeId is the identifier of the last photo of the previous page
+// (0 for the first page).
+func (db *appdbimpl) GetStream(user User, discover bool, beforeId int64, limit int) ([]Photo, error) {
+	if discover {
+		return db.queryPhotosPage(user, "p.id_user <> ? "+streamSuspendedClause+streamMuteClause,
+			[]interface{}{user.IdUser, user.IdUser}, beforeId, limit)
+	}
+	return db.queryPhotosPage(user, "p.id_user IN (SELECT followed FROM followers WHERE follower = ?) "+streamMuteClause,
+		[]interface{}{user.IdUser, user.IdUser}, beforeId, limit)
+}
+
+// Runs a keyset paginated query over the photos matching filter (a condition on the photos table, aliased "p"),
+// applying the ban rules of the stream and the visibility of private accounts, and loads their likes and comments.
+func (db *appdbimpl) queryPhotosPage(user User, filter string, filterArgs []interface{}, beforeId int64, limit int) ([]Photo, error) {
+
+	query := "SELECT p.id_photo, p.id_user, p.date, p.caption, p.media_type FROM photos p WHERE " + filter +
+		streamBanClause + privacyClause
+	args := make([]interface{}, 0, len(filterArgs)+6)
+	args = append(args, filterArgs...)
+	args = append(args, user.IdUser, user.IdUser, user.IdUser, user.IdUser)
+	if beforeId > 0 {
+		query += "AND p.id_photo < ? "
+		args = append(args, beforeId)
+	}
+	query += "ORDER BY p.id_photo DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.c.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Wait for the function to finish before closing rows
+	defer func() { _ = rows.Close() }()
+
+	// Read all the photos in the resulset
+	photos := make([]Photo, 0, limit)
+	for rows.Next() {
+		var photo Photo
+		err = rows.Scan(&photo.PhotoId, &photo.Owner, &photo.Date, &photo.Caption, &photo.MediaType)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+	_ = rows.Close()
+
+	if err := db.attachPhotoMedia(photos); err != nil {
+		return nil, err
+	}
+	return photos, db.attachPhotoActivity(user, photos)
+}
+
+// Database function that counts the users followed by a user
+func (db *appdbimpl) CountFollowing(user User) (int, error) {
+	var cnt int
+	err := db.c.QueryRow("SELECT COUNT(*) FROM followers WHERE follower = ?", user.IdUser).Scan(&cnt)
+	return cnt, err
+}
+
+// Loads the counters of the likes and of the comments of the photos, and whether the requesting user liked them, with
+// one query. The counters apply the same ban rules of GetLikesList and GetCommentsPage
+func (db *appdbimpl) attachPhotoActivity(requestingUser User, photos []Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(photos))
+	args := []interface{}{requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser,
+		requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser, requestingUser.IdUser}
+	for i, p := range photos {
+		index[int64(p.PhotoId)] = i
+		args = append(args, p.PhotoId)
+	}
+
+	rows, err := db.c.Query(
+		"SELECT p.id_photo, "+
+			"(SELECT COUNT(*) FROM likes x WHERE x.id_photo = p.id_photo "+commentBanFilter+"), "+
+			"EXISTS (SELECT 1 FROM likes x WHERE x.id_photo = p.id_photo AND x.id_user = ?), "+
+			"(SELECT COUNT(*) FROM comments x WHERE x.id_photo = p.id_photo "+commentBanFilter+commentRestrictFilter+") "+
+			"FROM photos p WHERE p.id_photo IN ("+placeholders(len(photos))+")",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var photoID int64
+		var likes, comments int
+		var likedByMe bool
+		if err := rows.Scan(&photoID, &likes, &likedByMe, &comments); err != nil {
+			return err
+		}
+		p := &photos[index[photoID]]
+		p.LikesCount = likes
+		p.LikedByMe = likedByMe
+		p.CommentsCount = comments
+	}
+	return rows.Err()
+}
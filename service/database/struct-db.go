@@ -20,19 +20,111 @@ type Photo struct {
 	Owner    string            `json:"owner"`    // Unique id of the owner
 	PhotoId  int               `json:"photo_id"` // Unique id of the photo
 	Date     time.Time         `json:"date"`     // Date in which the photo was uploaded
+	Caption  string            `json:"caption"`  // Caption of the photo (may contain #hashtags)
+
+	MediaType string      `json:"media_type"` // Type of the first media item (the cover of the post)
+	Media     []MediaItem `json:"media"`      // Media items of the post, in carousel order
+
+	LikesCount    int  `json:"likes_count"`    // Number of likes of the photo
+	CommentsCount int  `json:"comments_count"` // Number of comments of the photo
+	LikedByMe     bool `json:"liked_by_me"`    // True if the requesting user liked the photo
 }
 
+// MediaItem structure for the database (one of the images, GIFs or videos of a photo post)
+type MediaItem struct {
+	Position  int    `json:"position"`   // Position of the item in the post, starting from 0
+	MediaType string `json:"media_type"` // One of MediaImage, MediaGIF, MediaVideo
+}
+
+// Media types of the photos
+const (
+	MediaImage = "image" // JPEG or PNG image
+	MediaGIF   = "gif"   // Animated GIF
+	MediaVideo = "video" // MP4 or WebM video
+)
+
 // User structure for the database
 type User struct {
 	IdUser string `json:"user_id"` // User's unique id
 }
 
+// Follow status of a user towards another
+const (
+	FollowStatusNone      = "none"
+	FollowStatusPending   = "pending"
+	FollowStatusFollowing = "following"
+)
+
+// FollowRequest is a pending request to follow a private account
+type FollowRequest struct {
+	IdUser   string    `json:"user_id"`  // Requester's unique id
+	Nickname string    `json:"nickname"` // Nickname of the requester
+	Date     time.Time `json:"date"`     // Date of the request
+}
+
+// Who can start a direct conversation with a user
+const (
+	MessagesFromEveryone  = "everyone"  // Anyone: the messages of strangers are message requests
+	MessagesFromFollowing = "following" // Only the users the receiver follows
+	MessagesFromNobody    = "nobody"    // Only the existing contacts
+)
+
+// Outcome of CheckDirectMessage
+const (
+	DirectMessageAllowed = "allowed"
+	DirectMessageRequest = "request"
+)
+
+// MessageRequest is a conversation started by a stranger, waiting to be accepted by the receiver
+type MessageRequest struct {
+	Peer               string    `json:"peer"`               // Sender's unique id
+	Nickname           string    `json:"nickname"`           // Nickname of the sender
+	Messages           int       `json:"messages"`           // Number of messages sent so far
+	LastMessageAt      time.Time `json:"lastMessageAt"`      // Date of the last message
+	LastMessagePreview string    `json:"lastMessagePreview"` // Beginning of the last message
+}
+
 // User structure for the database
 type CompleteUser struct {
 	IdUser   string `json:"user_id"`  // User's unique id
 	Nickname string `json:"nickname"` // Nickname of a user
 }
 
+// Profile structure for the database (the public information of a user, with the counters of his/her lists)
+type Profile struct {
+	IdUser         string
+	Nickname       string
+	DisplayName    string
+	Bio            string
+	Website        string
+	FollowersCount int
+	FollowingCount int
+	PhotosCount    int
+}
+
+// ProfileInfo structure for the database (the profile information chosen by the user)
+type ProfileInfo struct {
+	DisplayName string
+	Bio         string
+	Website     string
+}
+
+// UserSummary structure for the database (an entry of the lists of followers and followed users)
+type UserSummary struct {
+	IdUser       string `json:"user_id"`
+	Nickname     string `json:"nickname"`
+	DisplayName  string `json:"display_name"`
+	FollowedByMe bool   `json:"followed_by_me"`
+}
+
+// UserSearchResult structure for the database (a user found by SearchUser)
+type UserSearchResult struct {
+	IdUser       string `json:"user_id"`
+	Nickname     string `json:"nickname"`
+	FollowedByMe bool   `json:"followed_by_me"`
+	Score        int    `json:"-"` // Relevance of the match (part of the pagination cursor)
+}
+
 // PhotoId structure for the database
 type PhotoId struct {
 	IdPhoto int64 `json:"photo_id"` // Photo unique id
@@ -45,7 +137,8 @@ type Nickname struct {
 
 // Comment structure for the database
 type Comment struct {
-	Comment string `json:"comment"` // Comment content
+	Comment  string `json:"comment"`   // Comment content
+	ParentId int64  `json:"parent_id"` // Comment replied to (0 for top-level comments)
 }
 
 // CommentId structure for the database
@@ -60,17 +153,37 @@ type CompleteComment struct {
 	IdUser    string `json:"user_id"`    // User's unique id
 	Nickname  string `json:"nickname"`   // Nickname of a user
 	Comment   string `json:"comment"`    // Comment content
+
+	ParentId     *int64     `json:"parent_id"`     // Comment replied to (null for top-level comments)
+	Date         time.Time  `json:"date"`          // Date in which the comment was written
+	EditedAt     *time.Time `json:"edited_at"`     // Date of the last edit (null if never edited)
+	LikesCount   int        `json:"likes_count"`   // Number of likes of the comment
+	LikedByMe    bool       `json:"liked_by_me"`   // True if the requesting user liked the comment
+	RepliesCount int        `json:"replies_count"` // Number of replies (visible to the requesting user)
+	Pending      bool       `json:"pending"`       // True if the comment waits for the approval of the photo owner (shown to the owner only)
 }
 
 // Message structure for the database (direct chat message)
 type Message struct {
-	Id        int64             `json:"id"`
-	Sender    string            `json:"sender"`
-	Receiver  string            `json:"receiver"`
-	Body      string            `json:"body"`
-	Date      time.Time         `json:"date"`
-	Status    int               `json:"status,omitempty"`
-	Reactions []MessageReaction `json:"reactions,omitempty"`
+	Id          int64             `json:"id"`
+	Sender      string            `json:"sender"`
+	Receiver    string            `json:"receiver"`
+	Body        string            `json:"body"`
+	Date        time.Time         `json:"date"`
+	Status      int               `json:"status,omitempty"`
+	Reactions   []ReactionSummary `json:"reactions,omitempty"`
+	Mentions    []Mention         `json:"mentions,omitempty"`
+	LinkPreview *LinkPreview      `json:"link_preview,omitempty"`
+	Type        string            `json:"type,omitempty"` // Group messages only
+	Poll        *Poll             `json:"poll,omitempty"` // Poll (or closed poll) group messages only
+}
+
+// LinkPreview structure for the database (preview of the first URL of a message body)
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
 }
 
 // GroupMessage structure for the database
@@ -80,12 +193,187 @@ type GroupMessage struct {
 	Sender  string    `json:"sender"`
 	Body    string    `json:"body"`
 	Date    time.Time `json:"date"`
+	Type    string    `json:"type"` // One of GroupMessageText, GroupMessagePoll, GroupMessagePollClosed
+}
+
+// Types of group messages
+const (
+	GroupMessageText       = "text"
+	GroupMessagePoll       = "poll"
+	GroupMessagePollClosed = "poll_closed" // System event added when a poll closes
+)
+
+// NewPoll structure for the database (the data needed to create a poll)
+type NewPoll struct {
+	Question       string
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       *time.Time // nil if the poll stays open until closed by its creator
+}
+
+// Poll structure for the database (a poll with its live tally, as seen by a group member)
+type Poll struct {
+	MessageId      int64        `json:"message_id"` // Identifier of the poll message
+	Question       string       `json:"question"`
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at,omitempty"`
+	Closed         bool         `json:"closed"`
+	ClosedAt       *time.Time   `json:"closed_at,omitempty"`
+	Voters         int          `json:"voters"` // Number of members that voted
+}
+
+// PollOption structure for the database
+type PollOption struct {
+	Option    int            `json:"option"` // Index of the option, starting from 0
+	Text      string         `json:"text"`
+	Votes     int            `json:"votes"`
+	VotedByMe bool           `json:"voted_by_me"`
+	VotedBy   []CompleteUser `json:"voted_by,omitempty"` // Not reported for anonymous polls
+}
+
+// ExportedMessage structure for the database (a message of a conversation export, deleted ones included)
+type ExportedMessage struct {
+	Id             int64             `json:"id"`
+	Sender         string            `json:"sender"`
+	SenderNickname string            `json:"sender_nickname"`
+	Body           string            `json:"body,omitempty"` // Empty for deleted messages
+	Date           time.Time         `json:"date"`
+	Type           string            `json:"type,omitempty"` // Group messages only
+	Deleted        bool              `json:"deleted,omitempty"`
+	DeletedAt      *time.Time        `json:"deleted_at,omitempty"`
+	Reactions      []MessageReaction `json:"reactions,omitempty"`
+	Poll           *Poll             `json:"poll,omitempty"`
+}
+
+// Status of a data export
+const (
+	DataExportPending = "pending" // The archive is being generated
+	DataExportReady   = "ready"   // The archive can be downloaded
+	DataExportFailed  = "failed"  // The generation failed: a new export must be requested
+)
+
+// DataExport is the state of the export of a user's data
+type DataExport struct {
+	Status      string     `json:"status"`       // One of DataExportPending, DataExportReady, DataExportFailed
+	RequestedAt time.Time  `json:"requested_at"` // Date of the request
+	CompletedAt *time.Time `json:"completed_at"` // Date in which the archive was ready or the generation failed (null while pending)
+	Size        int64      `json:"size"`         // Size of the archive in bytes (0 unless ready)
+	ArchivePath string     `json:"-"`            // Media key of the archive (empty unless ready)
+}
+
+// NicknameChange is a change of nickname of a user
+type NicknameChange struct {
+	OldNickname string    `json:"old_nickname"`
+	NewNickname string    `json:"new_nickname"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// ExportedProfile is the profile of a user in the export of his/her data
+type ExportedProfile struct {
+	IdUser          string           `json:"user_id"`
+	Nickname        string           `json:"nickname"`
+	DisplayName     string           `json:"display_name"`
+	Bio             string           `json:"bio"`
+	Website         string           `json:"website"`
+	Private         bool             `json:"private"`
+	MessagesFrom    string           `json:"messages_from"`
+	Role            string           `json:"role"`
+	SuspendedAt     *time.Time       `json:"suspended_at"`
+	PhotoPath       string           `json:"-"` // Media key of the profile photo (empty if none)
+	NicknameHistory []NicknameChange `json:"nickname_history"`
+	Followers       []CompleteUser   `json:"followers"`
+	Following       []CompleteUser   `json:"following"`
+	FollowRequests  []CompleteUser   `json:"follow_requests_sent"` // Pending requests to follow private accounts
+	BannedUsers     []CompleteUser   `json:"banned_users"`
+	MutedUsers      []CompleteUser   `json:"muted_users"`
+	RestrictedUsers []CompleteUser   `json:"restricted_users"`
+}
+
+// ExportedLike is a like left by a user, in the export of his/her data
+type ExportedLike struct {
+	IdPhoto int64  `json:"photo_id"`
+	Owner   string `json:"owner"` // Owner of the liked photo
+}
+
+// ExportedReaction is a reaction to a message left by a user, in the export of his/her data
+type ExportedReaction struct {
+	Conversation string    `json:"conversation"` // Peer of the direct conversation, or g-<group id>
+	MessageId    int64     `json:"message_id"`
+	Reaction     string    `json:"reaction"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ExportedActivity is what a user did on other contents, in the export of his/her data
+type ExportedActivity struct {
+	Comments  []CompleteComment  `json:"comments"` // Comments written by the user (on any photo)
+	Likes     []ExportedLike     `json:"likes"`
+	Reactions []ExportedReaction `json:"reactions"`
+}
+
+// ExportedSentMessage is a message sent by a user, in the export of his/her data
+type ExportedSentMessage struct {
+	Id           int64      `json:"id"`
+	Conversation string     `json:"conversation"` // Receiver of the direct message, or g-<group id>
+	Body         string     `json:"body,omitempty"`
+	Date         time.Time  `json:"date"`
+	Type         string     `json:"type,omitempty"` // Group messages only
+	Deleted      bool       `json:"deleted,omitempty"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportedReceipt is the delivery receipt of a message received by a user, in the export of his/her data
+type ExportedReceipt struct {
+	MessageId    int64      `json:"message_id"`
+	Conversation string     `json:"conversation"` // Sender of the direct message, or g-<group id>
+	ReceivedAt   time.Time  `json:"received_at"`
+	ReadAt       *time.Time `json:"read_at"`
+}
+
+// Suggestion structure for the database (a user suggested to follow, with the reasons of the suggestion)
+type Suggestion struct {
+	IdUser         string `json:"user_id"`
+	Nickname       string `json:"nickname"`
+	MutualFollows  int    `json:"mutual_follows"`  // Users followed by the requesting user that follow the suggested one
+	SharedGroups   int    `json:"shared_groups"`   // Groups of both users
+	RecentActivity int    `json:"recent_activity"` // Photos and comments posted recently
+}
+
+// Mention structure for the database (a group member mentioned with @nickname in a message)
+type Mention struct {
+	UserID   string `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Offset   int    `json:"offset"` // Position of the '@' in the body (in characters)
+	Length   int    `json:"length"` // Length of the mention, '@' included (in characters)
+}
+
+// MentionNotification structure for the database (an entry of the user's mentions feed)
+type MentionNotification struct {
+	MessageId      int64     `json:"message_id"`
+	Peer           string    `json:"peer"`
+	GroupName      string    `json:"group_name"`
+	Sender         string    `json:"sender"`
+	SenderNickname string    `json:"sender_nickname"`
+	Body           string    `json:"body"`
+	Date           time.Time `json:"date"`
+	Read           bool      `json:"read"`
 }
 
 // MessageReaction structure for the database
 type MessageReaction struct {
-	UserID   string `json:"user_id"`
-	Reaction string `json:"reaction"`
+	UserID    string    `json:"user_id"`
+	Nickname  string    `json:"nickname"`
+	Reaction  string    `json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary structure for the database (reactions of a message aggregated by emoji)
+type ReactionSummary struct {
+	Reaction    string `json:"reaction"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
 }
 
 // Conversation structure for the database
@@ -96,6 +384,8 @@ type Conversation struct {
 	PhotoURL           string    `json:"photoUrl"`
 	LastMessageAt      time.Time `json:"lastMessageAt"`
 	LastMessagePreview string    `json:"lastMessagePreview"`
+	UnreadMentions     int       `json:"unreadMentions"`
+	Muted              bool      `json:"muted"`
 }
 
 // Group structure for the database
@@ -105,3 +395,79 @@ type Group struct {
 	PhotoPath string    `json:"photo_path"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// MediaReferences are the media files referenced by the database
+type MediaReferences struct {
+	// Photos maps the identifier of every user with photos to the identifiers of his/her photos, each with the
+	// positions of its media items
+	Photos map[string]map[int64][]int
+
+	// Paths are the media keys of the profile photos, of the group photos and of the data export archives
+	Paths map[string]bool
+}
+
+// Roles of the users
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator" // Triages the reports and takes the moderation actions
+)
+
+// Placeholder account that keeps the group messages of the deleted users when they are anonymized. Its identifier
+// can't be generated for a real user (identifiers are hexadecimal) and it's suspended, so nobody can use it
+const (
+	DeletedUserId       = "deleted"
+	DeletedUserNickname = "Deleted user"
+)
+
+// Types of the reported targets
+const (
+	ReportPhoto         = "photo"
+	ReportComment       = "comment"
+	ReportDirectMessage = "direct_message"
+	ReportGroupMessage  = "group_message"
+	ReportUser          = "user"
+)
+
+// Status of a report
+const (
+	ReportOpen      = "open"      // Waiting for a moderator
+	ReportDismissed = "dismissed" // A moderator found nothing wrong
+	ReportActioned  = "actioned"  // A moderator removed the content or suspended its author
+)
+
+// Actions of the moderators (recorded in the moderation log)
+const (
+	ModerationDismiss       = "dismiss"
+	ModerationRemoveContent = "remove_content"
+	ModerationSuspend       = "suspend"
+	ModerationUnsuspend     = "unsuspend"
+)
+
+// Report of a content (photo, comment, message) or of a user
+type Report struct {
+	IdReport     int64      `json:"report_id"`     // Identifier of the report
+	Reporter     string     `json:"reporter"`      // Unique id of the user that sent the report
+	TargetType   string     `json:"target_type"`   // One of ReportPhoto, ReportComment, ReportDirectMessage, ReportGroupMessage, ReportUser
+	TargetId     string     `json:"target_id"`     // Identifier of the reported photo, comment, message or user
+	ReportedUser string     `json:"reported_user"` // Unique id of the author of the content (the user itself for ReportUser)
+	Content      string     `json:"content"`       // Copy of the content when it was reported (caption, comment, message, nickname)
+	Reason       string     `json:"reason"`        // Reason code
+	Details      string     `json:"details"`       // Optional explanation of the reporter
+	Status       string     `json:"status"`        // One of ReportOpen, ReportDismissed, ReportActioned
+	CreatedAt    time.Time  `json:"created_at"`    // Date of the report
+	ResolvedAt   *time.Time `json:"resolved_at"`   // Date of the moderator's decision (null while open)
+	ResolvedBy   *string    `json:"resolved_by"`   // Moderator that took the decision (null while open)
+	OpenReports  int        `json:"open_reports"`  // Number of open reports about the same target
+}
+
+// ModerationAction is an entry of the moderation log
+type ModerationAction struct {
+	IdAction   int64     `json:"action_id"`   // Identifier of the action
+	Moderator  string    `json:"moderator"`   // Unique id of the moderator
+	Action     string    `json:"action"`      // One of ModerationDismiss, ModerationRemoveContent, ModerationSuspend, ModerationUnsuspend
+	TargetType string    `json:"target_type"` // Type of the target (see Report)
+	TargetId   string    `json:"target_id"`   // Identifier of the target
+	IdReport   *int64    `json:"report_id"`   // Report that led to the action (null for direct suspensions)
+	Note       string    `json:"note"`        // Note of the moderator
+	Date       time.Time `json:"date"`        // Date of the action
+}
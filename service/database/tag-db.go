@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Hashtags limits
+const MaxTagLength = 50
+const maxTagsPerPhoto = 30
+
+// Returns the hashtags (#tag) of a caption, lowercased and without duplicates, in order of appearance. A hashtag must
+// start at the beginning of the caption or after a character that can't be part of a tag, and is made of letters,
+// digits and underscores. Tags longer than MaxTagLength are ignored.
+func parseHashtags(caption string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	runes := []rune(caption)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '#' || (i > 0 && isTagRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isTagRune(runes[end]) {
+			end++
+		}
+		tag := strings.ToLower(string(runes[i+1 : end]))
+		i = end - 1
+
+		if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerPhoto {
+			break
+		}
+	}
+	return tags
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Replaces the hashtags of a photo with the ones of its caption
+func replacePhotoTags(tx *sql.Tx, photoId int64, caption string) error {
+	_, err := tx.Exec("DELETE FROM photo_tags WHERE id_photo = ?", photoId)
+	if err != nil {
+		return err
+	}
+	for _, tag := range parseHashtags(caption) {
+		_, err = tx.Exec("INSERT INTO photo_tags (id_photo, tag) VALUES (?,?)", photoId, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Database function that retrieves a page of the photos with a hashtag, newest first, hiding the photos of users
+// that banned the requesting user (or that the requesting user banned). beforeId works like in GetStream.
+func (db *appdbimpl) GetPhotosByTag(requestingUser User, tag string, beforeId int64, limit int) ([]Photo, error) {
+	return db.queryPhotosPage(requestingUser,
+		"p.id_photo IN (SELECT id_photo FROM photo_tags WHERE tag = ?) ",
+		[]interface{}{strings.ToLower(tag)}, beforeId, limit)
+}
+
+// Database function that retrieves a page of the photos whose caption contains the given text (case insensitive),
+// newest first, with the same ban rules of GetPhotosByTag.
+func (db *appdbimpl) SearchPhotosByCaption(requestingUser User, text string, beforeId int64, limit int) ([]Photo, error) {
+	return db.queryPhotosPage(requestingUser,
+		"p.caption LIKE ? ESCAPE '\\' ",
+		[]interface{}{"%" + escapeLike(text) + "%"}, beforeId, limit)
+}
+
+// Escapes the wildcards of a LIKE pattern (the escape character is the backslash)
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
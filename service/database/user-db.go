@@ -5,35 +5,6 @@ import (
 	"time"
 )
 
-// Database function that gets the stream of a user (photos of people that are followed by the latter)
-func (db *appdbimpl) GetStream(user User) ([]Photo, error) {
-
-	rows, err := db.c.Query(`SELECT * FROM photos WHERE id_user IN (SELECT followed FROM followers WHERE follower = ?) ORDER BY date DESC`,
-		user.IdUser)
-	if err != nil {
-		return nil, err
-	}
-	// Wait for the function to finish before closing rows
-	defer func() { _ = rows.Close() }()
-
-	// Read all the users in the resulset
-	var res []Photo
-	for rows.Next() {
-		var photo Photo
-		err = rows.Scan(&photo.PhotoId, &photo.Owner, &photo.Date) //  &photo.Comments, &photo.Likes,
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, photo)
-	}
-
-	if rows.Err() != nil {
-		return nil, err
-	}
-
-	return res, nil
-}
-
 // Database function that retrieves all users identifiers
 func (db *appdbimpl) GetAllUsers() ([]User, error) {
 	rows, err := db.c.Query("SELECT id_user FROM users")
@@ -83,6 +54,17 @@ func (db *appdbimpl) CreateMessage(from User, to User, body string) (int64, erro
 		return 0, err
 	}
 
+	// The two users are contacts now: replying to a message request accepts it
+	_, err = tx.Exec("INSERT OR IGNORE INTO chat_contacts (id_user, peer) VALUES (?, ?), (?, ?)",
+		from.IdUser, to.IdUser, to.IdUser, from.IdUser)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM message_requests WHERE sender = ? AND receiver = ?", to.IdUser, from.IdUser)
+	if err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
@@ -120,21 +102,32 @@ func (db *appdbimpl) ListMessages(a User, b User, limit int, offset int) ([]Mess
 // Database function that adds a new user in the database upon registration
 func (db *appdbimpl) CreateUser(u User) error {
 
-	_, err := db.c.Exec("INSERT INTO users (id_user,nickname) VALUES (?, ?)",
+	tx, err := db.c.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec("INSERT INTO users (id_user,nickname) VALUES (?, ?)",
 		u.IdUser, u.IdUser)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Until the nickname is set the user is found by identifier
+	err = indexUserSearch(tx, u, u.IdUser)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // FindUserByNickname returns the user identifier of the user that owns the given nickname.
 // It returns found=false if the nickname does not exist.
 func (db *appdbimpl) FindUserByNickname(nickname string) (User, bool, error) {
 	var id string
-	err := db.c.QueryRow("SELECT id_user FROM users WHERE nickname = ?", nickname).Scan(&id)
+	err := db.c.QueryRow("SELECT id_user FROM users WHERE nickname = ? AND id_user != ?", nickname, DeletedUserId).Scan(&id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, false, nil
@@ -5,10 +5,24 @@ import (
 	"errors"
 )
 
-func (db *appdbimpl) SetUserPhotoPath(user User, photoPath string) error {
+func (db *appdbimpl) SetUserPhotoPath(user User, photoPath string) (string, error) {
+	tx, err := db.c.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var previous string
+	err = tx.QueryRow("SELECT photo_path FROM user_photos WHERE id_user = ?", user.IdUser).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
 	// SQLite: replace to upsert by primary key.
-	_, err := db.c.Exec("INSERT OR REPLACE INTO user_photos (id_user, photo_path) VALUES (?,?)", user.IdUser, photoPath)
-	return err
+	_, err = tx.Exec("INSERT OR REPLACE INTO user_photos (id_user, photo_path) VALUES (?,?)", user.IdUser, photoPath)
+	if err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
 }
 
 func (db *appdbimpl) GetUserPhotoPath(user User) (string, error) {
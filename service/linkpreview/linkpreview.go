@@ -0,0 +1,290 @@
+/*
+Package linkpreview builds previews (title, description, image) of web pages linked in messages, so that clients don't
+have to fetch arbitrary sites themselves.
+
+The Fetcher uses an HTTP client that refuses to connect to loopback, private, link-local and other non-public addresses
+(SSRF protection). The check is done on the address actually dialed, so it also covers redirects and DNS rebinding.
+A custom client can be injected through Config (e.g., in tests, to reach a local httptest server).
+
+Example:
+
+	fetcher := linkpreview.New(linkpreview.Config{
+		Timeout:      5 * time.Second,
+		MaxBodyBytes: 512 * 1024,
+	})
+	preview, err := fetcher.Fetch(ctx, "https://example.com/article")
+*/
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Errors section
+var ErrUnsupportedURL = errors.New("unsupported url")
+var ErrForbiddenAddress = errors.New("address not allowed")
+var ErrNotHTML = errors.New("content is not html")
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// Default limits
+const DefaultTimeout = 5 * time.Second
+const DefaultMaxBodyBytes = 512 * 1024
+const maxRedirects = 3
+const maxTitleLength = 200
+const maxDescriptionLength = 500
+
+// Preview is the preview of a web page
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+}
+
+// Config is used to provide dependencies and configuration to the New function.
+type Config struct {
+	// Client used to download pages. If nil, a client created by NewSafeClient(Timeout) is used
+	Client *http.Client
+
+	// Timeout of a whole fetch (connection, redirects and body). Defaults to DefaultTimeout
+	Timeout time.Duration
+
+	// MaxBodyBytes is the maximum number of bytes read from a page. Defaults to DefaultMaxBodyBytes
+	MaxBodyBytes int64
+}
+
+// Fetcher downloads web pages and extracts their preview
+type Fetcher struct {
+	client       *http.Client
+	timeout      time.Duration
+	maxBodyBytes int64
+}
+
+// New returns a new Fetcher
+func New(cfg Config) *Fetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if cfg.Client == nil {
+		cfg.Client = NewSafeClient(cfg.Timeout)
+	}
+	return &Fetcher{
+		client:       cfg.Client,
+		timeout:      cfg.Timeout,
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+}
+
+// NewSafeClient returns an HTTP client that only connects to public addresses and follows at most a few redirects
+func NewSafeClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !IsPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedURL
+			}
+			return nil
+		},
+	}
+}
+
+// IsPublicIP returns false for loopback, private, link-local, multicast, unspecified and other reserved addresses
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, block := range reservedBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Address blocks not covered by the net.IP helpers
+var reservedBlocks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // TEST-NET-1
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // TEST-NET-2
+		"203.0.113.0/24",  // TEST-NET-3
+		"240.0.0.0/4",     // reserved
+		"64:ff9b::/96",    // NAT64 (could reach private IPv4 addresses)
+		"2001:db8::/32",   // documentation
+	}
+	blocks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}()
+
+// Fetch downloads the page at rawURL and returns its preview
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Preview{}, ErrUnsupportedURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "WASAphoto-LinkPreview/1.0")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Preview{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBodyBytes))
+	if err != nil {
+		return Preview{}, err
+	}
+
+	// Relative image URLs are resolved against the final URL (after redirects)
+	preview := parsePage(string(page), resp.Request.URL)
+	preview.URL = rawURL
+	return preview, nil
+}
+
+var titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+var metaRegexp = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+var attributeRegexp = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+var spacesRegexp = regexp.MustCompile(`\s+`)
+
+// Extracts the preview from the HTML of a page, preferring Open Graph and Twitter card metadata
+func parsePage(page string, base *url.URL) Preview {
+	meta := make(map[string]string)
+	for _, tag := range metaRegexp.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attributeRegexp.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, exists := meta[key]; key != "" && !exists {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	var preview Preview
+	preview.Title = firstNonEmpty(meta["og:title"], meta["twitter:title"])
+	if preview.Title == "" {
+		if m := titleRegexp.FindStringSubmatch(page); m != nil {
+			preview.Title = m[1]
+		}
+	}
+	preview.Description = firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"])
+	preview.Title = cleanText(preview.Title, maxTitleLength)
+	preview.Description = cleanText(preview.Description, maxDescriptionLength)
+
+	image := firstNonEmpty(meta["og:image"], meta["og:image:url"], meta["twitter:image"])
+	if image != "" {
+		if ref, err := url.Parse(html.UnescapeString(strings.TrimSpace(image))); err == nil {
+			abs := base.ResolveReference(ref)
+			if abs.Scheme == "http" || abs.Scheme == "https" {
+				preview.Image = abs.String()
+			}
+		}
+	}
+	return preview
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Decodes HTML entities, collapses whitespaces and truncates the text to max characters
+func cleanText(s string, max int) string {
+	s = strings.TrimSpace(spacesRegexp.ReplaceAllString(html.UnescapeString(s), " "))
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	if utf8.RuneCountInString(s) > max {
+		s = string([]rune(s)[:max])
+	}
+	return s
+}
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FirstURL returns the first http(s) URL contained in a text, without trailing punctuation. Returns an empty string if
+// there's none.
+func FirstURL(text string) string {
+	found := urlRegexp.FindString(text)
+	found = strings.TrimRight(found, ".,;:!?)]}'")
+	if _, err := url.Parse(found); err != nil {
+		return ""
+	}
+	return found
+}
@@ -0,0 +1,190 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"198.51.100.7", false},
+		{"224.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := IsPublicIP(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
+
+func TestFetchDeniesNonPublicAddresses(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, "<title>internal</title>")
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default client dials only public addresses, whatever the host name resolves to
+	fetcher := New(Config{Timeout: 2 * time.Second})
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"loopback address", srv.URL},
+		{"host name of a loopback address", "http://localhost:" + port + "/"},
+		{"unspecified address", "http://0.0.0.0:" + port + "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetcher.Fetch(context.Background(), tt.url)
+			if !errors.Is(err, ErrForbiddenAddress) {
+				t.Fatalf("Fetch(%s) error = %v, want %v", tt.url, err, ErrForbiddenAddress)
+			}
+		})
+	}
+	if hits != 0 {
+		t.Errorf("server reached %d times", hits)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = fmt.Fprint(w, `<html><head><title>Fallback</title>
+<meta property="og:title" content="Open &amp; Graph">
+<meta name="description" content="plain description">
+<meta property="og:description" content="  spaced
+	description ">
+<meta property="og:image" content="/img/cover.png">
+</head></html>`)
+	})
+	mux.HandleFunc("/title", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, `<TITLE lang="en">Only a title</TITLE><meta name='twitter:image' content='javascript:alert(1)'>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/dir/page", http.StatusFound)
+	})
+	mux.HandleFunc("/dir/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xhtml+xml")
+		_, _ = fmt.Fprint(w, `<meta property="og:image" content="cover.jpg"><title>Moved</title>`)
+	})
+	mux.HandleFunc("/long", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = fmt.Fprint(w, "<title>"+strings.Repeat("é", maxTitleLength+10)+"</title>")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// The client of the test server is injected to reach the loopback address
+	fetcher := New(Config{Client: srv.Client(), MaxBodyBytes: 64 * 1024})
+	tests := []struct {
+		name string
+		path string
+		want Preview
+		err  error
+	}{
+		{
+			name: "open graph metadata",
+			path: "/og",
+			want: Preview{Title: "Open & Graph", Description: "spaced description", Image: srv.URL + "/img/cover.png"},
+		},
+		{
+			name: "title element and unsafe image",
+			path: "/title",
+			want: Preview{Title: "Only a title"},
+		},
+		{
+			name: "image resolved against the redirect",
+			path: "/redirect",
+			want: Preview{Title: "Moved", Image: srv.URL + "/dir/cover.jpg"},
+		},
+		{
+			name: "truncated title",
+			path: "/long",
+			want: Preview{Title: strings.Repeat("é", maxTitleLength)},
+		},
+		{name: "not html", path: "/json", err: ErrNotHTML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fetcher.Fetch(context.Background(), srv.URL+tt.path)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Fetch error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch error = %v", err)
+			}
+			tt.want.URL = srv.URL + tt.path
+			if got != tt.want {
+				t.Errorf("Fetch = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), srv.URL+"/missing"); err == nil {
+		t.Error("Fetch of a missing page succeeded")
+	}
+	for _, u := range []string{"ftp://example.com/file", "javascript:alert(1)", "http://", "not a url"} {
+		if _, err := fetcher.Fetch(context.Background(), u); !errors.Is(err, ErrUnsupportedURL) {
+			t.Errorf("Fetch(%q) error = %v, want %v", u, err, ErrUnsupportedURL)
+		}
+	}
+}
+
+func TestFirstURL(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no links here", ""},
+		{"see https://example.com/a?b=c.", "https://example.com/a?b=c"},
+		{"(http://example.com/x) and https://example.org", "http://example.com/x"},
+		{"<https://example.com/tag>", "https://example.com/tag"},
+		{"ftp://example.com is not http", ""},
+		{"wow, http://example.com/!?", "http://example.com/"},
+	}
+	for _, tt := range tests {
+		if got := FirstURL(tt.text); got != tt.want {
+			t.Errorf("FirstURL(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Package mediagc reconciles the media store against the database: it removes the files that no row references anymore
+(e.g., left behind by a failed removal or by a crash during an upload) and reports the rows whose file is missing.
+
+A file is referenced if it's
+
+  - a file of a media item of a photo of the photos table: "<owner>/photos/<photo id>" (the original of the first
+    item), "<owner>/photos/<photo id>_item<position>" (the originals of the other items) or the same names followed
+    by "_<anything>" (renditions, posters and other derived files)
+  - the profile photo of a user (user_photos.photo_path) or the photo of a group (groups.photo_path)
+  - the archive of a data export (data_exports.archive_path)
+
+Files newer than Config.MinAge are never removed, since uploads save the files before or after their rows.
+
+Example:
+
+	report, err := mediagc.Run(ctx, db, store, mediagc.Config{MinAge: 24 * time.Hour, Logger: logger})
+*/
+package mediagc
+
+import (
+	"context"
+	"new-wasa/service/database"
+	"new-wasa/service/mediastore"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config is the configuration of a garbage collection
+type Config struct {
+	// MinAge is the minimum age of the orphan files to remove
+	MinAge time.Duration
+
+	// DryRun only reports the orphan files, without removing them
+	DryRun bool
+
+	// Logger where removed and missing files are logged
+	Logger logrus.FieldLogger
+}
+
+// Report is the result of a garbage collection
+type Report struct {
+	// Scanned is the number of files in the store
+	Scanned int
+
+	// Orphans is the number of files not referenced by the database (the recent ones included)
+	Orphans int
+
+	// Removed is the number of orphan files removed (in a dry run, the ones that would be removed) and RemovedBytes
+	// their size
+	Removed      int
+	RemovedBytes int64
+
+	// Missing is the number of media items of the photos, profile photos, group photos and export archives without
+	// their file
+	Missing int
+}
+
+// Run executes a garbage collection
+func Run(ctx context.Context, db database.AppDatabase, store mediastore.MediaStore, cfg Config) (Report, error) {
+	var report Report
+
+	// The references are read before listing: files of rows created in the meantime are recent, so they're kept
+	refs, err := db.ListMediaReferences()
+	if err != nil {
+		return report, err
+	}
+	now := time.Now()
+
+	var orphans []mediastore.ObjectInfo
+	foundItems := make(map[photoItem]bool)
+	foundPaths := make(map[string]bool)
+	err = store.List(ctx, "", func(info mediastore.ObjectInfo) error {
+		report.Scanned++
+		if refs.Paths[info.Key] {
+			foundPaths[info.Key] = true
+			return nil
+		}
+		if item, original, ok := parsePhotoKey(info.Key); ok && hasPosition(refs.Photos[item.owner][item.photoId], item.position) {
+			if original {
+				foundItems[item] = true
+			}
+			return nil
+		}
+
+		report.Orphans++
+		if now.Sub(info.ModTime) >= cfg.MinAge {
+			orphans = append(orphans, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, info := range orphans {
+		if !cfg.DryRun {
+			if err := store.Delete(ctx, info.Key); err != nil {
+				return report, err
+			}
+		}
+		report.Removed++
+		report.RemovedBytes += info.Size
+		cfg.Logger.WithField("key", info.Key).WithField("dry_run", cfg.DryRun).Info("orphan media file removed")
+	}
+
+	for owner, photos := range refs.Photos {
+		for photoId, positions := range photos {
+			for _, position := range positions {
+				if !foundItems[photoItem{owner: owner, photoId: photoId, position: position}] {
+					report.Missing++
+					cfg.Logger.WithField("owner", owner).WithField("photo_id", photoId).WithField("item", position).
+						Warning("photo file missing")
+				}
+			}
+		}
+	}
+	for path := range refs.Paths {
+		if !foundPaths[path] {
+			report.Missing++
+			cfg.Logger.WithField("key", path).Warning("profile or group photo file missing")
+		}
+	}
+	return report, nil
+}
+
+// photoItem identifies a media item of a photo
+type photoItem struct {
+	owner    string
+	photoId  int64
+	position int
+}
+
+// Parses the key of a file of a photo ("<owner>/photos/<photo id>[_item<position>][_<anything>]"). Returns the media
+// item, whether it's the original and whether the key is a photo key
+func parsePhotoKey(key string) (photoItem, bool, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[1] != "photos" {
+		return photoItem{}, false, false
+	}
+	fields := strings.SplitN(parts[2], "_", 3)
+	photoId, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return photoItem{}, false, false
+	}
+	item := photoItem{owner: parts[0], photoId: photoId}
+	derived := fields[1:]
+	if len(derived) > 0 && strings.HasPrefix(derived[0], "item") {
+		position, err := strconv.Atoi(strings.TrimPrefix(derived[0], "item"))
+		if err != nil || position <= 0 {
+			return photoItem{}, false, false
+		}
+		item.position = position
+		derived = derived[1:]
+	}
+	return item, len(derived) == 0, true
+}
+
+// Checks if a position is one of the positions of the media items of a photo
+func hasPosition(positions []int, position int) bool {
+	for _, p := range positions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
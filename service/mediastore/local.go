@@ -0,0 +1,171 @@
+package mediastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local is a MediaStore that keeps the files in a folder of the local filesystem
+type Local struct {
+	root string
+}
+
+// NewLocal returns a Local store rooted at the folder root, creating it if needed
+func NewLocal(root string) (*Local, error) {
+	if root == "" {
+		return nil, errors.New("media root is required")
+	}
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("creating media root: %w", err)
+	}
+	return &Local{root: root}, nil
+}
+
+func (s *Local) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file in a temporary file first, so that readers never see a partially written file
+func (s *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("media %s: wrote %d bytes, expected %d", key, n, size)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *Local) Open(ctx context.Context, key string) (Object, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		_ = f.Close()
+		return nil, ErrNotFound
+	}
+	return &localObject{File: f, info: info}, nil
+}
+
+func (s *Local) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *Local) Rename(ctx context.Context, from string, to string) error {
+	src, err := s.path(from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(to)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(src); errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// List walks only the folder of the prefix (e.g., "<user>" for "<user>/")
+func (s *Local) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	if err := validPrefix(prefix); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.root, filepath.FromSlash(prefix[:strings.LastIndex(prefix, "/")+1]))
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && p == dir {
+			// Nothing saved under the prefix
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return ctx.Err()
+		}
+		info, err := d.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed in the meantime
+			return nil
+		} else if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return fn(ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	})
+}
+
+type localObject struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (o *localObject) Size() int64 {
+	return o.info.Size()
+}
+
+func (o *localObject) ModTime() time.Time {
+	return o.info.ModTime()
+}
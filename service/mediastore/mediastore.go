@@ -0,0 +1,101 @@
+/*
+Package mediastore stores the media files (photos, their renditions, profile and group photos) of the application.
+
+Files are identified by slash-separated keys (e.g., "<user>/photos/<photo id>"), the same relative paths saved in the
+database. Two implementations are available:
+
+  - Local, which keeps the files in a folder of the local filesystem
+  - S3, which keeps the files in a bucket of an S3-compatible object storage (AWS S3, MinIO, ...), so that media
+    survive container restarts and can be shared between instances
+
+Example:
+
+	store, err := mediastore.NewLocal("/var/lib/wasa/media")
+	if err != nil {
+		return err
+	}
+	err = store.Put(ctx, "42/photos/7", bytes.NewReader(data), int64(len(data)))
+*/
+package mediastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Errors section
+var ErrNotFound = errors.New("media not found")
+var ErrInvalidKey = errors.New("invalid media key")
+
+// MediaStore is where media files are saved
+type MediaStore interface {
+	// Put saves size bytes read from r under key, replacing the existing file (if any)
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Open returns the file saved under key, or ErrNotFound. The caller must close it
+	Open(ctx context.Context, key string) (Object, error)
+
+	// Delete removes the file saved under key. Removing a missing file is not an error
+	Delete(ctx context.Context, key string) error
+
+	// Rename moves the file saved under from to the key to, replacing the existing file (if any). Returns ErrNotFound
+	// if there's no file under from
+	Rename(ctx context.Context, from string, to string) error
+
+	// List calls fn for every file of the store whose key starts with prefix ("" for all of them, "<user>/" for the
+	// files of a user), in no particular order. If fn returns an error, List stops and returns it
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// ObjectInfo describes a file of the store
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Object is a media file opened for reading. It can be served with http.ServeContent
+type Object interface {
+	io.ReadSeekCloser
+
+	// Size is the length of the file in bytes
+	Size() int64
+
+	// ModTime is the last time the file was saved
+	ModTime() time.Time
+}
+
+// Open returns the store selected by backend: "local" (files in the folder root) or "s3" (objects in the bucket
+// described by s3)
+func Open(backend string, root string, s3 S3Config) (MediaStore, error) {
+	switch backend {
+	case "local":
+		return NewLocal(root)
+	case "s3":
+		return NewS3(s3)
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", backend)
+	}
+}
+
+// Checks that a list prefix is empty or the beginning of a valid key
+func validPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	return validKey(prefix + "x")
+}
+
+// Checks that a key is a clean relative path that doesn't escape the store
+func validKey(key string) error {
+	if key == "" || key == "." || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") ||
+		path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return ErrInvalidKey
+	}
+	return nil
+}
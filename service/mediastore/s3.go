@@ -0,0 +1,468 @@
+package mediastore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config is the configuration of an S3 store
+type S3Config struct {
+	// Endpoint is the base URL of the object storage, e.g. "https://s3.eu-west-1.amazonaws.com" or
+	// "http://localhost:9000" for a local MinIO
+	Endpoint string
+
+	// Region of the bucket ("us-east-1" if empty)
+	Region string
+
+	// Bucket where the files are saved. It must already exist
+	Bucket string
+
+	// AccessKey and SecretKey are the credentials used to sign the requests
+	AccessKey string
+	SecretKey string
+
+	// PathStyle puts the bucket in the path of the URLs (endpoint/bucket/key) instead of the host name
+	// (bucket.endpoint/key). Most S3-compatible servers require it
+	PathStyle bool
+
+	// Client is the HTTP client used for the requests (defaultS3Client if nil)
+	Client *http.Client
+}
+
+// S3 is a MediaStore that keeps the files in a bucket of an S3-compatible object storage. Requests are signed with
+// AWS Signature Version 4
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// Time limit for the storage to start answering a request. There's no limit on the whole request: the body of a large
+// video can take long to be read by a slow client
+const s3ResponseTimeout = 30 * time.Second
+
+// Returns the HTTP client used when S3Config.Client is nil: the default transport (with its dial, TLS handshake and
+// idle connections timeouts) plus s3ResponseTimeout, so that an unresponsive storage can't block the requests forever
+func defaultS3Client() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = s3ResponseTimeout
+	return &http.Client{Transport: transport}
+}
+
+// Hash of the empty payload, used to sign requests without body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3 returns an S3 store. It doesn't contact the storage
+func NewS3(cfg S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, errors.New("s3 endpoint must be an http(s) URL")
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 credentials are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	client := cfg.Client
+	if client == nil {
+		client = defaultS3Client()
+	}
+	return &S3{cfg: cfg, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size < 0 {
+		return errors.New("s3: the size of the media is required")
+	}
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	} else {
+		req.Body = io.NopCloser(r)
+	}
+	s.sign(req, "UNSIGNED-PAYLOAD")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, "put", key)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (Object, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, "head", key)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &s3Object{ctx: ctx, store: s, key: key, size: resp.ContentLength, modTime: modTime}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp, "delete", key)
+	}
+	return nil
+}
+
+// Rename copies the object on the storage (CopyObject) and removes the original
+func (s *S3) Rename(ctx context.Context, from string, to string) error {
+	if err := validKey(from); err != nil {
+		return err
+	}
+	req, err := s.newRequest(ctx, http.MethodPut, to, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", uriEncode("/"+s.cfg.Bucket+"/"+from, false))
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return responseError(resp, "copy", from)
+	}
+
+	// A copy can fail after the status is sent: the error is then the body of the response
+	var body struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body); err == nil && body.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 copy %q: %s", from, body.Code)
+	}
+	return s.Delete(ctx, from)
+}
+
+// List pages through the objects of the prefix with ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	if err := validPrefix(prefix); err != nil {
+		return err
+	}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.newBucketRequest(ctx, http.MethodGet, "", query)
+		if err != nil {
+			return err
+		}
+		s.sign(req, emptyPayloadHash)
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp, "list", "")
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&page)
+		}
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page.Contents {
+			if err := fn(ObjectInfo{Key: c.Key, Size: c.Size, ModTime: c.LastModified}); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Sends a GET of the object starting from offset. The caller must close the body
+func (s *S3) get(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	s.sign(req, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, responseError(resp, "get", key)
+	}
+}
+
+// Builds an unsigned request for an object
+func (s *S3) newRequest(ctx context.Context, method string, key string, query url.Values) (*http.Request, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	return s.newBucketRequest(ctx, method, key, query)
+}
+
+// Builds an unsigned request without checking the key, which is empty for the requests of the bucket (e.g., listing)
+func (s *S3) newBucketRequest(ctx context.Context, method string, key string, query url.Values) (*http.Request, error) {
+
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		u.Path = base + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = base + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	return http.NewRequestWithContext(ctx, method, u.String(), nil)
+}
+
+// Adds the AWS Signature Version 4 to a request. The signed headers are the host, the range and the x-amz-* ones
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// Percent-encodes everything but the unreserved characters (and the slashes, unless encodeSlash is true), as required
+// by the signature
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Returns the query sorted and encoded as required by the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// Converts an error response of the storage into an error
+func responseError(resp *http.Response, operation string, key string) error {
+	var body struct {
+		Code string `xml:"Code"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	if body.Code != "" {
+		return fmt.Errorf("s3 %s %q: %s (%s)", operation, key, resp.Status, body.Code)
+	}
+	return fmt.Errorf("s3 %s %q: %s", operation, key, resp.Status)
+}
+
+// s3Object reads an object lazily: the download starts at the first Read, from the current offset, so that seeking
+// (e.g., to serve a range request) doesn't download the skipped bytes
+type s3Object struct {
+	ctx     context.Context
+	store   *S3
+	key     string
+	size    int64
+	modTime time.Time
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.store.get(o.ctx, o.key, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	if errors.Is(err, io.EOF) && o.offset < o.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("s3: negative position")
+	}
+	if offset != o.offset && o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+func (o *s3Object) Size() int64 {
+	return o.size
+}
+
+func (o *s3Object) ModTime() time.Time {
+	return o.modTime
+}
@@ -10,6 +10,7 @@ import PageNotFoundView from '../views/PageNotFoundView.vue'
 import SettingsView from '../views/SettingsView.vue'
 const ChatsView = () => import('../views/ChatsView.vue')
 const ConversationView = () => import('../views/ConversationView.vue')
+const ModerationView = () => import('../views/ModerationView.vue')
 
 const router = createRouter({
     history: createWebHashHistory(
@@ -48,6 +49,10 @@ const router = createRouter({
             path: '/chats/:peer',
             component: ConversationView
         },
+        {
+            path: '/moderation',
+            component: ModerationView
+        },
         {
             path: "/:catchAll(.*)",
             component: PageNotFoundView
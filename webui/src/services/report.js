@@ -0,0 +1,16 @@
+// Reason codes accepted by the report endpoints
+export const reportReasons = ['spam', 'harassment', 'hate_speech', 'nudity', 'violence', 'self_harm', 'impersonation', 'other']
+
+// Asks the reason (and optional details) of a report and sends it to the report endpoint at path. Returns true if the
+// report was sent
+export async function sendReport(axios, path){
+    const reason = window.prompt('Reason (' + reportReasons.join(', ') + '):', 'spam')
+    if (!reason) return false
+    if (!reportReasons.includes(reason.trim())){
+        window.alert('Unknown reason: ' + reason)
+        return false
+    }
+    const details = window.prompt('Details (optional):', '') || ''
+    await axios.post(path, { reason: reason.trim(), details: details })
+    return true
+}